@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"godb"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintln(flag.CommandLine.Output(), "Usage: godb [--new] <database file>")
+	flag.PrintDefaults()
+}
+
+func main() {
+	newDatabase := flag.Bool("new", false, "Replace the database file with a new, empty database")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := godb.Open(flag.Arg(0), &godb.Options{New: *newDatabase})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// REPL
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("> ")
+		// "SELECT * FROM TableDictionary WHERE Name = 'TableDictionary'"
+		sql, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if strings.HasPrefix(sql, "exit") {
+			break
+		}
+
+		err = execSQL(os.Stdout, db, sql)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	db.Close()
+}
+
+// Runs a statement and prints its rows or the number of rows it changed
+func execSQL(out io.Writer, db *godb.DB, sql string) error {
+	rows, err := db.Query(sql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Columns == nil {
+		if rows.RowsAffected >= 0 {
+			fmt.Fprintf(out, "%d rows affected\n", rows.RowsAffected)
+		}
+		return nil
+	}
+	return printRows(out, rows)
+}
+
+// Prints the column names followed by one line per row and the number of rows
+func printRows(out io.Writer, rows *godb.Rows) error {
+	names := make([]string, len(rows.Columns))
+	for i, col := range rows.Columns {
+		names[i] = col.Name
+	}
+	fmt.Fprintln(out, strings.Join(names, " | "))
+
+	count := 0
+	for rows.Next() {
+		values := make([]string, len(rows.Columns))
+		for i, val := range rows.Values() {
+			if val == nil {
+				values[i] = "NULL"
+			} else {
+				values[i] = fmt.Sprint(val)
+			}
+		}
+		fmt.Fprintln(out, strings.Join(values, " | "))
+		count++
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	if count == 1 {
+		fmt.Fprintln(out, "1 row")
+	} else {
+		fmt.Fprintf(out, "%d rows\n", count)
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+// Package driver makes godb databases available to database/sql under the
+// name "godb", with the path of the database file as data source name:
+//
+//	db, err := sql.Open("godb", "data.db")
+//
+// All connections to a file share one engine.Database, which runs a single
+// statement at a time. A transaction started by Begin holds the database
+// until it ends, statements of other connections wait for it unless their
+// context ends first. Transactions are only controlled through Begin, Commit
+// and Rollback, not by BEGIN, COMMIT or ROLLBACK statements. The rows of a
+// query are read completely before Query returns.
+//
+// Statements take ? placeholders. Arguments may be integers, strings, byte
+// slices or nil. LONG columns are returned as int64, STRING columns as string
+// and values of the catalog's internal types as their text.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"godb/engine"
+	"godb/table"
+	"godb/table/types"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+func init() {
+	types.InitializeTypeIds()
+	sql.Register("godb", &Driver{})
+}
+
+type Driver struct{}
+
+// A database opened by one or more connections
+type sharedDatabase struct {
+	db   *engine.Database
+	path string
+	// The number of open connections
+	refs int
+	// Held while a statement runs and by a connection for the whole of its
+	// transaction. A channel, so waiting for it can be cancelled.
+	lock chan struct{}
+}
+
+// Waits until no other statement or transaction holds the database and takes
+// it, unless the context ends first
+func (shared *sharedDatabase) acquire(ctx context.Context) error {
+	select {
+	case shared.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (shared *sharedDatabase) release() {
+	<-shared.lock
+}
+
+var openDatabases = map[string]*sharedDatabase{}
+var openDatabasesLock sync.Mutex
+
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	openDatabasesLock.Lock()
+	defer openDatabasesLock.Unlock()
+	shared, ok := openDatabases[path]
+	if !ok {
+		db, err := engine.OpenDatabase(path)
+		if err != nil {
+			return nil, err
+		}
+		shared = &sharedDatabase{db: db, path: path, lock: make(chan struct{}, 1)}
+		openDatabases[path] = shared
+	}
+	shared.refs++
+	return &Conn{shared: shared}, nil
+}
+
+type Conn struct {
+	shared *sharedDatabase
+	// Whether the connection runs a transaction and holds the database
+	inTx   bool
+	closed bool
+}
+
+func (conn *Conn) Prepare(query string) (driver.Stmt, error) {
+	if conn.closed {
+		return nil, driver.ErrBadConn
+	}
+	return &Stmt{conn: conn, query: query}, nil
+}
+
+func (conn *Conn) Close() error {
+	if conn.closed {
+		return nil
+	}
+	var err error
+	if conn.inTx {
+		err = conn.endTx("ROLLBACK")
+	}
+	conn.closed = true
+
+	openDatabasesLock.Lock()
+	defer openDatabasesLock.Unlock()
+	conn.shared.refs--
+	if conn.shared.refs == 0 {
+		delete(openDatabases, conn.shared.path)
+		if closeErr := conn.shared.db.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (conn *Conn) Begin() (driver.Tx, error) {
+	return conn.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (conn *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if conn.closed {
+		return nil, driver.ErrBadConn
+	}
+	if conn.inTx {
+		return nil, errors.New("Begin failed. There is already a transaction in progress")
+	}
+	if opts.ReadOnly || (opts.Isolation != driver.IsolationLevel(sql.LevelDefault) &&
+		opts.Isolation != driver.IsolationLevel(sql.LevelSerializable)) {
+		return nil, errors.New("Begin failed. Only serializable read-write transactions are supported")
+	}
+
+	err := conn.shared.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = conn.shared.db.Execute("BEGIN")
+	if err != nil {
+		conn.shared.release()
+		return nil, err
+	}
+	conn.inTx = true
+	return &Tx{conn: conn}, nil
+}
+
+// Runs COMMIT or ROLLBACK and releases the database
+func (conn *Conn) endTx(sql string) error {
+	if !conn.inTx {
+		return errors.New("Transaction has already been committed or rolled back")
+	}
+	_, _, err := conn.shared.db.Execute(sql)
+	conn.inTx = false
+	conn.shared.release()
+	return err
+}
+
+func (conn *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, affected, err := conn.execute(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if affected < 0 {
+		affected = 0
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (conn *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, _, err := conn.execute(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Binds the arguments to the placeholders and runs the statement.
+// Returns the rows of queries, empty ones for other statements, and the
+// number of changed rows.
+func (conn *Conn) execute(ctx context.Context, query string, args []driver.NamedValue) (*Rows, int64, error) {
+	if conn.closed {
+		return nil, -1, driver.ErrBadConn
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, -1, errors.New("Bind failed. Named arguments are not supported")
+		}
+		values[i] = arg.Value
+	}
+	sql, err := engine.BindArguments(query, values)
+	if err != nil {
+		return nil, -1, err
+	}
+	if engine.IsTransactionStatement(sql) {
+		return nil, -1, errors.New("Exec failed. Transactions are controlled with Begin, Commit and Rollback")
+	}
+
+	if !conn.inTx {
+		err = conn.shared.acquire(ctx)
+		if err != nil {
+			return nil, -1, err
+		}
+		defer conn.shared.release()
+	}
+	db := conn.shared.db
+	result, affected, err := db.Execute(sql)
+	// The transaction of the engine has to match the one of the connection
+	if !conn.inTx && db.SessionTx != nil {
+		db.Execute("ROLLBACK")
+		return nil, -1, errors.New("Exec failed. Transactions are started with Begin")
+	}
+	if conn.inTx && db.SessionTx == nil {
+		conn.inTx = false
+		conn.shared.release()
+		return nil, -1, errors.New("Exec failed. Transactions are ended with Commit or Rollback")
+	}
+	if err != nil {
+		return nil, -1, err
+	}
+
+	rows := &Rows{}
+	if result == nil {
+		return rows, affected, nil
+	}
+	defer result.Close()
+	for _, col := range result.Columns {
+		rows.columns = append(rows.columns, col.Name)
+	}
+	for result.Next() {
+		rows.rows = append(rows.rows, result.Row())
+	}
+	return rows, affected, result.Err()
+}
+
+// Converts a value of a result row
+func goValue(value table.ColumnValue) driver.Value {
+	switch value := value.(type) {
+	case types.Long:
+		return int64(value)
+	case types.String:
+		return string(value)
+	case nil:
+		return nil
+	}
+	return value.String()
+}
+
+type Tx struct {
+	conn *Conn
+}
+
+func (tx *Tx) Commit() error {
+	return tx.conn.endTx("COMMIT")
+}
+
+func (tx *Tx) Rollback() error {
+	return tx.conn.endTx("ROLLBACK")
+}
+
+type Stmt struct {
+	conn  *Conn
+	query string
+}
+
+func (stmt *Stmt) Close() error {
+	return nil
+}
+
+// The number of placeholders isn't known before binding, which checks it
+func (stmt *Stmt) NumInput() int {
+	return -1
+}
+
+func (stmt *Stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return stmt.conn.ExecContext(context.Background(), stmt.query, namedValues(args))
+}
+
+func (stmt *Stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return stmt.conn.QueryContext(context.Background(), stmt.query, namedValues(args))
+}
+
+func (stmt *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return stmt.conn.ExecContext(ctx, stmt.query, args)
+}
+
+func (stmt *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return stmt.conn.QueryContext(ctx, stmt.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// The rows of a query, read completely by the statement
+type Rows struct {
+	columns []string
+	rows    []table.Row
+	next    int
+}
+
+func (rows *Rows) Columns() []string {
+	return rows.columns
+}
+
+func (rows *Rows) Close() error {
+	rows.rows = nil
+	return nil
+}
+
+func (rows *Rows) Next(dest []driver.Value) error {
+	if rows.next >= len(rows.rows) {
+		return io.EOF
+	}
+	for i, value := range rows.rows[rows.next] {
+		dest[i] = goValue(value)
+	}
+	rows.next++
+	return nil
+}
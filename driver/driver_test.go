@@ -0,0 +1,188 @@
+package driver_test
+
+import (
+	"context"
+	"database/sql"
+	"godb/pager"
+	"os"
+	"testing"
+	"time"
+
+	_ "godb/driver"
+)
+
+const TEST_FILE = "test.db"
+
+func openTestDatabase(t *testing.T) *sql.DB {
+	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + pager.WAL_SUFFIX)
+	db, err := sql.Open("godb", TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func closeTestDatabase(db *sql.DB) {
+	db.Close()
+	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + pager.WAL_SUFFIX)
+}
+
+func TestDriver(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	_, err := db.Exec("CREATE TABLE Users (id INT PRIMARY KEY, name TEXT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Exec("INSERT INTO Users VALUES (?, ?), (?, ?)", 1, "Ann", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 2 {
+		t.Error("Insert affected", affected, "rows instead of 2", err)
+	}
+
+	stmt, err := db.Prepare("SELECT id, name FROM Users WHERE id >= ? ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := rows.Columns()
+	if err != nil || len(columns) != 2 || columns[0] != "id" || columns[1] != "name" {
+		t.Error("Unexpected columns", columns, err)
+	}
+	ids := []int64{}
+	names := []sql.NullString{}
+	for rows.Next() {
+		var id int64
+		var name sql.NullString
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		names = append(names, name)
+	}
+	if rows.Err() != nil {
+		t.Fatal(rows.Err())
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 || names[0].String != "Ann" || names[1].Valid {
+		t.Error("Unexpected rows", ids, names)
+	}
+
+	var schema sql.NullString
+	err = db.QueryRow("SELECT `Schema` FROM TableDictionary WHERE Name = ?", "Users").Scan(&schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.String != "id LONG PRIMARY KEY, name STRING" {
+		t.Errorf("Unexpected schema %q", schema.String)
+	}
+
+	_, err = db.Exec("INSERT INTO Users VALUES (?)", 3.5)
+	if err == nil {
+		t.Error("Float argument accepted")
+	}
+	_, err = db.Exec("INSERT INTO Users VALUES (?, ?)", 3)
+	if err == nil {
+		t.Error("Missing argument accepted")
+	}
+}
+
+func TestDriverTransactions(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	_, err := db.Exec("CREATE TABLE Test (id INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func() int {
+		var count int
+		err := db.QueryRow("SELECT count(*) FROM Test").Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("INSERT INTO Test VALUES (1), (2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count() != 0 {
+		t.Error("Rolled back rows are visible")
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("INSERT INTO Test VALUES (?)", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count() != 1 {
+		t.Error("Committed row is missing")
+	}
+
+	_, err = db.Exec("BEGIN")
+	if err == nil {
+		t.Error("Transaction started outside of Begin")
+	}
+
+	// Statements can't end the transaction of Begin
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{"COMMIT", "rollback", "BEGIN"} {
+		_, err = tx.Exec(sql)
+		if err == nil {
+			t.Error(sql, "accepted inside a transaction")
+		}
+	}
+	_, err = tx.Exec("INSERT INTO Test VALUES (2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting for the transaction ends with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = db.BeginTx(ctx, nil)
+	if err != context.DeadlineExceeded {
+		t.Error("Begin waiting for a transaction returned", err)
+	}
+	_, err = db.ExecContext(ctx, "INSERT INTO Test VALUES (3)")
+	if err != context.DeadlineExceeded {
+		t.Error("Exec waiting for a transaction returned", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count() != 2 {
+		t.Error("Expected 2 rows after the commit, found", count())
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"godb/exec"
+	"godb/table"
+	"godb/table/types"
+	"strings"
+	"testing"
+)
+
+func TestAggregates(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []table.ColumnValue{
+		types.String("a"), types.String("b"), nil, types.String("a"), types.String("c"), types.String("b"), types.String("a"),
+	}
+	for i, value := range values {
+		err = db.Insert(tbl, table.Row{types.Long(i + 1), value})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT COUNT(*), COUNT(value), COUNT(DISTINCT value), SUM(`key`), AVG(`key`), MIN(value), MAX(`key`) FROM Test",
+			"7 6 3 28 4 a 7"},
+		{"SELECT COUNT(*), SUM(`key`), MIN(value) FROM Test WHERE `key` > 10", "0 NULL NULL"},
+		{"SELECT value, COUNT(*), SUM(`key`) FROM Test GROUP BY value ORDER BY value", "NULL 1 3, a 3 12, b 2 8, c 1 5"},
+		{"SELECT value, COUNT(*) AS n FROM Test GROUP BY value HAVING COUNT(*) > 1 ORDER BY n DESC", "a 3, b 2"},
+		{"SELECT `key` % 2 AS odd, MAX(value) FROM Test GROUP BY `key` % 2 ORDER BY odd", "0 b, 1 c"},
+		{"SELECT SUM(`key`) * 2 + COUNT(*) FROM Test", "63"},
+		{"SELECT value FROM Test GROUP BY value HAVING value <> 'a' ORDER BY MIN(`key`)", "b, c"},
+		{"SELECT COUNT(*) FROM Test GROUP BY value HAVING SUM(`key`) > 100", ""},
+		{"SELECT DISTINCT value FROM Test ORDER BY value", "NULL, a, b, c"},
+		{"SELECT DISTINCT value, `key` % 2 AS odd FROM Test WHERE value <> 'c' ORDER BY value, odd", "a 0, a 1, b 0"},
+		{"SELECT DISTINCT COUNT(*) FROM Test GROUP BY value ORDER BY 1", "1, 2, 3"},
+		{"SELECT DISTINCT value FROM Test ORDER BY value LIMIT 1 OFFSET 1", "a"},
+	}
+	check := func() {
+		for _, test := range tests {
+			rows, err := exec.QueryRows(db, mustParseSelect(t, test.sql))
+			if err != nil {
+				t.Error(test.sql, err)
+				continue
+			}
+			lines := []string{}
+			for _, row := range rows {
+				values := []string{}
+				for _, value := range row {
+					if value == nil {
+						values = append(values, "NULL")
+					} else {
+						values = append(values, value.String())
+					}
+				}
+				lines = append(lines, strings.Join(values, " "))
+			}
+			if strings.Join(lines, ", ") != test.expected {
+				t.Error(test.sql, "returned", lines, "instead of", test.expected)
+			}
+		}
+	}
+	check()
+
+	// Groups beyond the first one are aggregated by sorting
+	defer func(maxGroups int) { exec.HASH_AGGREGATE_MAX_GROUPS = maxGroups }(exec.HASH_AGGREGATE_MAX_GROUPS)
+	exec.HASH_AGGREGATE_MAX_GROUPS = 1
+	check()
+
+	invalid := []string{
+		"SELECT value, COUNT(*) FROM Test",
+		"SELECT * FROM Test GROUP BY value",
+		"SELECT value FROM Test WHERE COUNT(*) > 1 GROUP BY value",
+		"SELECT SUM(value) FROM Test",
+		"SELECT MAX(COUNT(*)) FROM Test",
+		"SELECT COUNT(*) FROM Test GROUP BY 1",
+		"SELECT DISTINCT value FROM Test ORDER BY `key`",
+	}
+	for _, sql := range invalid {
+		_, err := exec.Query(db, mustParseSelect(t, sql))
+		if err == nil {
+			t.Error("Invalid aggregation", sql, "was accepted")
+		}
+	}
+}
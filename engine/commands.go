@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"errors"
+	"godb/exec"
+	"godb/table"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+func (db *Database) Insert(tbl *table.Table, row table.Row) error {
+	return db.atomically(func() error {
+		return db.insert(tbl, row)
+	})
+}
+
+func (db *Database) insert(tbl *table.Table, row table.Row) error {
+	err := db.insertRow(tbl, row)
+	if err != nil {
+		return err
+	}
+	return db.FlushTableDictionary(tbl)
+}
+
+// Stores a row and adds it to the indexes of its table.
+// The table's entry in the TableDictionary has to be flushed afterwards.
+func (db *Database) insertRow(tbl *table.Table, row table.Row) error {
+	err := tbl.Schema.Validate(row)
+	if err != nil {
+		return errors.New("Insert failed. " + err.Error())
+	}
+
+	err = db.checkUnique(tbl, table.RowId{PageIdx: -1, Slot: -1}, row)
+	if err != nil {
+		return err
+	}
+
+	rowId, err := tbl.InsertRow(row)
+	if err != nil {
+		return err
+	}
+
+	return db.indexInsert(tbl, rowId, row)
+}
+
+// Returns a cursor over all rows whose column has the given value
+func (db *Database) Select(tbl *table.Table, column string, targetValue table.ColumnValue) *Cursor {
+	colDef, _, err := tbl.Schema.FindColumnByName(column)
+	if err != nil {
+		return failedCursor(err)
+	}
+
+	if colDef.Type != targetValue.Type() {
+		return failedCursor(errors.New("Select failed. Value type doesn't match"))
+	}
+
+	preds := []exec.Predicate{{Column: column, Operator: sqlparser.EqualStr, Value: targetValue}}
+	return db.openCursor(tbl, exec.ChooseAccessPath(db.TableIndexes(tbl.Name), preds), exec.PredicateOf(tbl, preds))
+}
+
+// Returns the first row whose column has the given value
+func (db *Database) SelectOne(tbl *table.Table, column string, targetValue table.ColumnValue) (table.Row, error) {
+	cursor := db.Select(tbl, column, targetValue)
+	defer cursor.Close()
+	if cursor.Next() {
+		return cursor.Row(), nil
+	}
+	if cursor.Err() != nil {
+		return nil, cursor.Err()
+	}
+	return nil, errors.New("Select failed. Key not found!")
+}
+
+func (db *Database) Update(tbl *table.Table, targetColumn string, targetValue table.ColumnValue, newRow table.Row) error {
+	return db.atomically(func() error {
+		return db.update(tbl, targetColumn, targetValue, newRow)
+	})
+}
+
+func (db *Database) update(tbl *table.Table, targetColumn string, targetValue table.ColumnValue, newRow table.Row) error {
+	err := tbl.Schema.Validate(newRow)
+	if err != nil {
+		return errors.New("Update failed. " + err.Error())
+	}
+
+	colDef, _, err := tbl.Schema.FindColumnByName(targetColumn)
+	if err != nil {
+		return err
+	}
+
+	if colDef.Type != targetValue.Type() {
+		return errors.New("Update failed. Target value type doesn't match")
+	}
+
+	preds := []exec.Predicate{{Column: targetColumn, Operator: sqlparser.EqualStr, Value: targetValue}}
+
+	cursor := db.openCursor(tbl, exec.ChooseAccessPath(db.TableIndexes(tbl.Name), preds), exec.PredicateOf(tbl, preds))
+	defer cursor.Close()
+	if !cursor.Next() {
+		if cursor.Err() != nil {
+			return cursor.Err()
+		}
+		return errors.New("Update failed. Key not found!")
+	}
+	rowId, oldRow := cursor.RowId(), cursor.Row()
+	cursor.Close()
+
+	return db.updateRow(tbl, rowId, oldRow, newRow)
+}
+
+// Replaces the row at the given location, keeping the indexes up to date
+func (db *Database) updateRow(tbl *table.Table, rowId table.RowId, oldRow table.Row, newRow table.Row) error {
+	err := db.checkUnique(tbl, rowId, newRow)
+	if err != nil {
+		return err
+	}
+
+	err = db.indexDelete(tbl, rowId, oldRow)
+	if err != nil {
+		return err
+	}
+
+	lastPageIdx, freeSpaceMapIdx := tbl.LastPageIdx, tbl.FreeSpaceMapIdx
+	err = tbl.UpdateRow(rowId, newRow)
+	if err != nil {
+		return err
+	}
+	if tbl.LastPageIdx != lastPageIdx || tbl.FreeSpaceMapIdx != freeSpaceMapIdx {
+		// The row was moved to a new page
+		err = db.FlushTableDictionary(tbl)
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.indexInsert(tbl, rowId, newRow)
+}
+
+// Deletes all rows matching the predicate and returns the number of deleted rows
+func (db *Database) Delete(tbl *table.Table, predicate table.Predicate) (int, error) {
+	deleted := 0
+	err := db.atomically(func() error {
+		var err error
+		deleted, err = db.delete(tbl, exec.AccessPath{}, predicate)
+		return err
+	})
+	return deleted, err
+}
+
+func (db *Database) delete(tbl *table.Table, path exec.AccessPath, predicate table.Predicate) (int, error) {
+	type deletion struct {
+		rowId table.RowId
+		row   table.Row
+	}
+
+	// Collect first, deleting compacts the pages being scanned
+	// A nil predicate deletes all rows
+	deletions := []deletion{}
+	cursor := db.openCursor(tbl, path, predicate)
+	for cursor.Next() {
+		deletions = append(deletions, deletion{rowId: cursor.RowId(), row: cursor.Row()})
+	}
+	cursor.Close()
+	if cursor.Err() != nil {
+		return 0, cursor.Err()
+	}
+
+	for _, d := range deletions {
+		err := db.indexDelete(tbl, d.rowId, d.row)
+		if err != nil {
+			return 0, err
+		}
+		err = tbl.DeleteRow(d.rowId)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(deletions), nil
+}
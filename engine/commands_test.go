@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateIndex("TestKey", tbl, []string{"key"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		err = db.Insert(tbl, table.Row{types.Long(i), types.String(strings.Repeat("x", i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := tbl.FetchDataPage(tbl.FirstPageIdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeBefore := page.AvailableSpace()
+
+	deleted, err := db.Delete(tbl, func(row table.Row) (bool, error) {
+		return row[0].(types.Long)%2 == 0, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 25 {
+		t.Error("Deleted", deleted, "rows instead of 25")
+	}
+
+	page, err = tbl.FetchDataPage(tbl.FirstPageIdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.AvailableSpace() <= freeBefore {
+		t.Error("Space of deleted rows not reclaimed")
+	}
+
+	_, err = db.SelectOne(tbl, "key", types.Long(2))
+	if err == nil {
+		t.Error("Deleted row still found through index")
+	}
+
+	err = execSQL(db, "DELETE FROM Test WHERE `key` >= 40")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := 0
+	err = tbl.ForEachRow(func(rowId table.RowId, row table.Row) (bool, error) {
+		if row[1].(types.String) != types.String(strings.Repeat("x", int(row[0].(types.Long)))) {
+			t.Error("Row corrupted by compaction")
+		}
+		remaining++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 20 {
+		t.Error(remaining, "rows remaining instead of 20")
+	}
+}
+
+func TestVariableLengthUpdate(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := db.CreateIndex("TestKey", tbl, []string{"key"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const count = 40
+	for i := 0; i < count; i++ {
+		err = db.Insert(tbl, table.Row{types.Long(i), types.String("short")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rowIds, err := idx.Tree.Search(table.Row{types.Long(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Grow every row until the first page can't hold them anymore
+	for round := 1; round <= 4; round++ {
+		for i := 0; i < count; i++ {
+			value := types.String(strings.Repeat("y", round*30+i))
+			err = db.Update(tbl, "key", types.Long(i), table.Row{types.Long(i), value})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tbl.FirstPageIdx == tbl.LastPageIdx {
+		t.Fatal("No row was moved to another page")
+	}
+
+	// Shrink them again, moving forwarded rows back home
+	for i := 0; i < count; i++ {
+		err = db.Update(tbl, "key", types.Long(i), table.Row{types.Long(i), types.String("tiny")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := 0
+	err = tbl.ForEachRow(func(rowId table.RowId, row table.Row) (bool, error) {
+		if row[1] != types.String("tiny") {
+			t.Error("Row", row[0], "has wrong value", row[1])
+		}
+		seen++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != count {
+		t.Error("Scan returned", seen, "rows instead of", count)
+	}
+
+	newRowIds, err := idx.Tree.Search(table.Row{types.Long(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newRowIds) != 1 || newRowIds[0] != rowIds[0] {
+		t.Error("Row identity changed by update")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := types.String(strings.Repeat("large value ", 2000))
+	err = db.Insert(tbl, table.Row{types.Long(1), large})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(tbl, table.Row{types.Long(2), types.String("small")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := db.SelectOne(tbl, "key", types.Long(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[1] != large {
+		t.Error("Large value not read back correctly")
+	}
+
+	larger := types.String(strings.Repeat("larger value ", 3000))
+	err = db.Update(tbl, "key", types.Long(2), table.Row{types.Long(2), larger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err = db.SelectOne(tbl, "key", types.Long(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[1] != larger {
+		t.Error("Large updated value not read back correctly")
+	}
+
+	// The overflow pages of deleted values are reused
+	fileInfo, err := db.Pager.File.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSize := fileInfo.Size()
+	_, err = db.Delete(tbl, func(row table.Row) (bool, error) { return row[0] == types.Long(1), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(tbl, table.Row{types.Long(3), large})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, err = db.Pager.File.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Size() != fileSize {
+		t.Error("Overflow pages of the deleted row not reused")
+	}
+
+	// A failed update outside of a transaction keeps the old overflow pages.
+	// Too many values which can't overflow don't fit on any page.
+	wide := table.TableSchema{Columns: []table.ColumnDef{{Name: "value", Type: types.TypeString}}}
+	for i := 0; i < 1000; i++ {
+		wide.Columns = append(wide.Columns, table.ColumnDef{Name: "n" + strconv.Itoa(i), Type: types.TypeLong})
+	}
+	tbl, err = db.CreateTable("Wide", wide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row = make(table.Row, len(wide.Columns))
+	row[0] = large
+	rowId, err := tbl.InsertRow(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooWide := make(table.Row, len(wide.Columns))
+	for i := range tooWide {
+		tooWide[i] = types.Long(i)
+	}
+	err = tbl.UpdateRow(rowId, tooWide)
+	if err == nil {
+		t.Fatal("Row larger than a page stored")
+	}
+	other := make(table.Row, len(wide.Columns))
+	other[0] = types.String(strings.Repeat("other value ", 2000))
+	_, err = tbl.InsertRow(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err = tbl.FetchRow(rowId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[0] != large {
+		t.Error("Overflow pages freed by the failed update")
+	}
+}
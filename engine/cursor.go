@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"godb/exec"
+	"godb/table"
+)
+
+// Streams the rows of an access path matching a predicate.
+//
+//	cursor := db.openCursor(tbl, path, predicate)
+//	defer cursor.Close()
+//	for cursor.Next() {
+//		row := cursor.Row()
+//	}
+//	err := cursor.Err()
+type Cursor struct {
+	// nil for failed cursors
+	scan   exec.Scan
+	opened bool
+	closed bool
+
+	row table.Row
+	err error
+}
+
+// Opens a cursor over the rows of the access path matching the predicate
+func (db *Database) openCursor(tbl *table.Table, path exec.AccessPath, predicate table.Predicate) *Cursor {
+	return &Cursor{scan: exec.NewScan(tbl, path, predicate)}
+}
+
+// A cursor that returns no rows, only the given error
+func failedCursor(err error) *Cursor {
+	return &Cursor{err: err}
+}
+
+// Advances to the next matching row, returns false once there are no more
+// rows or an error occurred.
+func (cursor *Cursor) Next() bool {
+	if cursor.err != nil || cursor.closed {
+		return false
+	}
+	if !cursor.opened {
+		cursor.opened = true
+		cursor.err = cursor.scan.Open()
+		if cursor.err != nil {
+			return false
+		}
+	}
+	cursor.row, cursor.err = cursor.scan.Next()
+	return cursor.row != nil && cursor.err == nil
+}
+
+// The current row
+func (cursor *Cursor) Row() table.Row {
+	return cursor.row
+}
+
+// The location of the current row
+func (cursor *Cursor) RowId() table.RowId {
+	return cursor.scan.RowId()
+}
+
+func (cursor *Cursor) Err() error {
+	return cursor.err
+}
+
+func (cursor *Cursor) Close() {
+	if cursor.opened && !cursor.closed {
+		cursor.scan.Close()
+	}
+	cursor.closed = true
+	cursor.row = nil
+}
+
+// Calls fn with every row of the access path
+func (db *Database) scan(tbl *table.Table, path exec.AccessPath, fn func(table.RowId, table.Row) (bool, error)) error {
+	cursor := db.openCursor(tbl, path, nil)
+	defer cursor.Close()
+	for cursor.Next() {
+		cont, err := fn(cursor.RowId(), cursor.Row())
+		if err != nil || !cont {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,385 @@
+package engine
+
+import (
+	"errors"
+	"godb/index"
+	"godb/pager"
+	"godb/table"
+	"godb/table/types"
+	"log"
+	"math"
+)
+
+type Database struct {
+	Pager           *pager.Pager
+	TableDictionary *table.Table
+	// The transaction started by a BEGIN statement, nil outside of one
+	SessionTx *Tx
+	// Maps table names to the indexes of the table
+	Indexes map[string][]*index.TableIndex
+	// Maps table names to the statistics recorded by ANALYZE
+	Statistics map[string]*table.Statistics
+}
+
+var TABLE_DICTIONARY_SCHEMA = table.TableSchema{
+	Columns: []table.ColumnDef{
+		{Name: "Name", Type: types.TypeString},
+		{Name: "FirstPageIdx", Type: types.TypeLong},
+		{Name: "LastPageIdx", Type: types.TypeLong},
+		{Name: "FreeSpaceMapIdx", Type: types.TypeLong},
+		{Name: "Schema", Type: types.TypeColDefs},
+	},
+}
+
+// The catalog of all indexes.
+// Columns holds the definitions of the indexed columns in key order.
+var INDEX_DICTIONARY_SCHEMA = table.TableSchema{
+	Columns: []table.ColumnDef{
+		{Name: "Name", Type: types.TypeString},
+		{Name: "TableName", Type: types.TypeString},
+		{Name: "Columns", Type: types.TypeColDefs},
+		{Name: "Unique", Type: types.TypeLong},
+		{Name: "RootPageIdx", Type: types.TypeLong},
+	},
+}
+
+// The statistics recorded by ANALYZE, one row per column of the analyzed
+// tables. Rows and Pages describe the whole table.
+// Min, Max and the bounds of the Histogram are SQL literals, the bounds are
+// separated by commas.
+var STATISTICS_SCHEMA = table.TableSchema{
+	Columns: []table.ColumnDef{
+		{Name: "TableName", Type: types.TypeString},
+		{Name: "ColumnName", Type: types.TypeString},
+		{Name: "Rows", Type: types.TypeLong},
+		{Name: "Pages", Type: types.TypeLong},
+		{Name: "Distinct", Type: types.TypeLong},
+		{Name: "NullFraction", Type: types.TypeString},
+		{Name: "Min", Type: types.TypeString},
+		{Name: "Max", Type: types.TypeString},
+		{Name: "Histogram", Type: types.TypeString},
+	},
+}
+
+func TableToDictionaryEntry(tbl *table.Table) table.Row {
+	entry := make([]table.ColumnValue, len(TABLE_DICTIONARY_SCHEMA.Columns))
+	entry[0] = types.String(tbl.Name)
+	entry[1] = types.Long(tbl.FirstPageIdx)
+	entry[2] = types.Long(tbl.LastPageIdx)
+	entry[3] = types.Long(tbl.FreeSpaceMapIdx)
+	entry[4] = types.ColDefs(tbl.Schema.Columns)
+	return entry
+}
+
+// Write table information back to disk
+func (db *Database) FlushTableDictionary(table *table.Table) error {
+	entry := TableToDictionaryEntry(table)
+	err := db.Update(db.TableDictionary, "Name", types.String(table.Name), entry)
+	if err != nil {
+		return err
+	}
+
+	// Update in-memory TableDictionary
+	dict, err := db.OpenTable("TableDictionary")
+	if err != nil {
+		return err
+	}
+
+	db.TableDictionary = dict
+
+	return nil
+}
+
+func (db *Database) OpenTable(tableName string) (*table.Table, error) {
+	cursor := db.Select(db.TableDictionary, "Name", types.String(tableName))
+	defer cursor.Close()
+	if !cursor.Next() {
+		if cursor.Err() != nil {
+			return nil, cursor.Err()
+		}
+		return nil, errors.New("Table '" + tableName + "' not found")
+	}
+	tableDictEntry := cursor.Row()
+
+	if !TABLE_DICTIONARY_SCHEMA.CheckSchema(tableDictEntry) {
+		return nil, errors.New("OpenTable called with a row that doesn't belong to the TableDictionary")
+	}
+	var firstPageIdx int64
+	var lastPageIdx int64
+	var freeSpaceMapIdx int64
+	var schema table.TableSchema
+
+	for i, col := range TABLE_DICTIONARY_SCHEMA.Columns {
+		switch col.Name {
+		case "FirstPageIdx":
+			firstPageIdx = int64(tableDictEntry[i].(types.Long))
+		case "LastPageIdx":
+			lastPageIdx = int64(tableDictEntry[i].(types.Long))
+		case "FreeSpaceMapIdx":
+			freeSpaceMapIdx = int64(tableDictEntry[i].(types.Long))
+		case "Schema":
+			schema = table.TableSchema{Columns: tableDictEntry[i].(types.ColDefs)}
+		}
+	}
+
+	return &table.Table{
+		Name:            tableName,
+		Pager:           db.Pager,
+		FirstPageIdx:    firstPageIdx,
+		LastPageIdx:     lastPageIdx,
+		FreeSpaceMapIdx: freeSpaceMapIdx,
+		Schema:          schema,
+	}, nil
+}
+
+func (db *Database) CreateTable(name string, schema table.TableSchema) (*table.Table, error) {
+	var tbl *table.Table
+	err := db.atomically(func() error {
+		var err error
+		tbl, err = db.createTable(name, schema)
+		return err
+	})
+	return tbl, err
+}
+
+func (db *Database) createTable(name string, schema table.TableSchema) (*table.Table, error) {
+	if _, err := db.OpenTable(name); err == nil {
+		return nil, errors.New("CreateTable failed. Table '" + name + "' already exists")
+	}
+	err := checkColumnDefs(schema.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	row := table.Row{
+		types.String(name),
+		types.Long(-1),
+		types.Long(-1),
+		types.Long(-1),
+		types.ColDefs(schema.Columns),
+	}
+
+	err = db.Insert(db.TableDictionary, row)
+	if err != nil {
+		return nil, err
+	}
+
+	tbl, err := db.OpenTable(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Primary keys and unique columns are enforced by unique indexes
+	for _, col := range schema.Columns {
+		indexName := constraintIndexName(name, col)
+		if indexName == "" {
+			continue
+		}
+		_, err = db.createIndex(indexName, tbl, []string{col.Name}, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tbl, nil
+}
+
+// The name of the unique index enforcing the primary key or unique constraint
+// of a column, empty for columns without such a constraint
+func constraintIndexName(tableName string, col table.ColumnDef) string {
+	if col.PrimaryKey {
+		return tableName + "_pkey"
+	}
+	if col.Unique {
+		return tableName + "_" + col.Name + "_key"
+	}
+	return ""
+}
+
+// Checks the column definitions of a new table
+func checkColumnDefs(columns []table.ColumnDef) error {
+	if len(columns) == 0 {
+		return errors.New("CreateTable failed. A table needs at least one column")
+	}
+	names := make(map[string]bool)
+	hasPrimaryKey := false
+	for _, col := range columns {
+		if names[col.Name] {
+			return errors.New("CreateTable failed. Duplicate column '" + col.Name + "'")
+		}
+		names[col.Name] = true
+
+		if col.PrimaryKey {
+			if hasPrimaryKey {
+				return errors.New("CreateTable failed. Only one primary key column is supported")
+			}
+			hasPrimaryKey = true
+		}
+		if col.Default != nil && col.Default.Type() != col.Type {
+			return errors.New("CreateTable failed. Default value of column '" + col.Name + "' doesn't match its type")
+		}
+	}
+	return nil
+}
+
+// Opens the database stored in the given file.
+// The catalog of an existing database is loaded from its root page, a new
+// database is bootstrapped.
+func OpenDatabase(filename string) (*Database, error) {
+	if pager.PAGE_SIZE > math.MaxInt16 {
+		log.Fatal("Page size is greater than the range of int16. In page pointers would overflow.")
+	}
+
+	pager, err := pager.OpenPager(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{Pager: pager}
+
+	header, err := pager.ReadHeader()
+	if err == nil {
+		if header.CatalogRootIdx >= 0 {
+			err = db.reloadCatalog()
+		} else {
+			err = db.bootstrap()
+		}
+	}
+	if err != nil {
+		pager.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Creates the catalog of a new database
+func (db *Database) bootstrap() error {
+	db.TableDictionary = &table.Table{
+		Name:            "TableDictionary",
+		Pager:           db.Pager,
+		FirstPageIdx:    -1,
+		LastPageIdx:     -1,
+		FreeSpaceMapIdx: -1,
+		Schema:          TABLE_DICTIONARY_SCHEMA,
+	}
+
+	// Insert the TableDictionary table into the table dictionary.
+	// This forces the pager to actually allocate the first page of the
+	// TableDictionary, which becomes the root of the catalog.
+	row := table.Row{
+		types.String("TableDictionary"),
+		types.Long(-1),
+		types.Long(-1),
+		types.Long(-1),
+		types.ColDefs(TABLE_DICTIONARY_SCHEMA.Columns),
+	}
+
+	err := db.atomically(func() error {
+		err := db.insert(db.TableDictionary, row)
+		if err != nil {
+			return err
+		}
+
+		header, err := db.Pager.ReadHeader()
+		if err != nil {
+			return err
+		}
+		header.CatalogRootIdx = db.TableDictionary.FirstPageIdx
+		err = db.Pager.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.createTable("IndexDictionary", INDEX_DICTIONARY_SCHEMA)
+		if err != nil {
+			return err
+		}
+		_, err = db.createTable("TableStatistics", STATISTICS_SCHEMA)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = db.loadIndexes()
+	if err != nil {
+		return err
+	}
+	return db.loadStatistics()
+}
+
+// Runs fn inside a pager transaction, so either all pages modified by fn are
+// committed or none are.
+// If a transaction is already running fn simply becomes part of it.
+func (db *Database) atomically(fn func() error) error {
+	if db.Pager.InTransaction() {
+		return fn()
+	}
+
+	err := db.Pager.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		db.Pager.Rollback()
+		// The in-memory catalog may reference rolled back pages
+		if reloadErr := db.reloadCatalog(); reloadErr != nil {
+			return reloadErr
+		}
+		return err
+	}
+
+	err = db.Pager.Commit()
+	if err != nil {
+		db.Pager.Rollback()
+		db.reloadCatalog()
+		return err
+	}
+	return nil
+}
+
+// Reads the in-memory parts of the catalog back from disk.
+// The TableDictionary starts at the catalog root page recorded in the file header.
+func (db *Database) reloadCatalog() error {
+	header, err := db.Pager.ReadHeader()
+	if err != nil {
+		return err
+	}
+
+	db.TableDictionary = &table.Table{
+		Name:            "TableDictionary",
+		Pager:           db.Pager,
+		FirstPageIdx:    header.CatalogRootIdx,
+		LastPageIdx:     header.CatalogRootIdx,
+		FreeSpaceMapIdx: -1,
+		Schema:          TABLE_DICTIONARY_SCHEMA,
+	}
+
+	dict, err := db.OpenTable("TableDictionary")
+	if err != nil {
+		return err
+	}
+
+	db.TableDictionary = dict
+	err = db.loadIndexes()
+	if err != nil {
+		return err
+	}
+	return db.loadStatistics()
+}
+
+// Rolls back the transaction started by BEGIN, if any, and closes the file
+func (db *Database) Close() error {
+	var err error
+	if db.SessionTx != nil {
+		err = db.SessionTx.Rollback()
+		db.SessionTx = nil
+	}
+	if pagerErr := db.Pager.Close(); err == nil {
+		err = pagerErr
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"godb/table"
+	"godb/table/types"
+	"strings"
+	"testing"
+)
+
+func TestReopenDatabase(t *testing.T) {
+	db := openTestDatabase(t)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateIndex("TestValue", tbl, []string{"value"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		err = db.Insert(tbl, table.Row{types.Long(i), types.String("value " + string(rune('a'+i%26)))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	db, err = OpenDatabase(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeTestDatabase(db)
+
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.IndexByName("TestValue") == nil {
+		t.Fatal("Index not loaded from the catalog")
+	}
+	row, err := db.SelectOne(tbl, "key", types.Long(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[1] != types.String("value q") {
+		t.Error("Wrong row read after reopening", row)
+	}
+
+	// The existing catalog is used instead of bootstrapping a new one
+	count := 0
+	err = db.TableDictionary.ForEachRow(func(table.RowId, table.Row) (bool, error) {
+		count++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Error("TableDictionary has", count, "entries instead of 4")
+	}
+
+	err = db.Insert(tbl, table.Row{types.Long(100), types.String("value a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rowIds, err := db.IndexByName("TestValue").Tree.Search(table.Row{types.String("value a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowIds) != 5 {
+		t.Error("Index has", len(rowIds), "entries for 'value a' instead of 5")
+	}
+}
+
+func TestCreateTableStatement(t *testing.T) {
+	db := openTestDatabase(t)
+
+	err := execSQL(db, "CREATE TABLE Users (id INT PRIMARY KEY, name VARCHAR(50) NOT NULL, "+
+		"email TEXT UNIQUE, age INTEGER DEFAULT -1, note TEXT DEFAULT 'none')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "CREATE TABLE Users (id INT)")
+	if err == nil {
+		t.Error("Duplicate table created")
+	}
+	err = execSQL(db, "CREATE TABLE Other (id INT, id TEXT)")
+	if err == nil {
+		t.Error("Table with duplicate columns created")
+	}
+	err = execSQL(db, "CREATE TABLE Other (id BLOB)")
+	if err == nil {
+		t.Error("Table with unknown type created")
+	}
+	err = execSQL(db, "CREATE TABLE Other (id INT DEFAULT 'one')")
+	if err == nil {
+		t.Error("Default value of the wrong type accepted")
+	}
+
+	// The constraints are part of the stored schema
+	db.Close()
+	db, err = OpenDatabase(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeTestDatabase(db)
+
+	tbl, err := db.OpenTable("Users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []table.ColumnDef{
+		{Name: "id", Type: types.TypeLong, PrimaryKey: true},
+		{Name: "name", Type: types.TypeString, NotNull: true},
+		{Name: "email", Type: types.TypeString, Unique: true},
+		{Name: "age", Type: types.TypeLong, Default: types.Long(-1)},
+		{Name: "note", Type: types.TypeString, Default: types.String("none")},
+	}
+	if types.ColDefs(tbl.Schema.Columns).String() != types.ColDefs(expected).String() {
+		t.Error("Unexpected schema", types.ColDefs(tbl.Schema.Columns))
+	}
+
+	err = db.Insert(tbl, table.Row{types.Long(1), types.String("Ann"), nil, nil, types.String("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NULLs don't violate unique constraints
+	err = db.Insert(tbl, table.Row{types.Long(2), types.String("Bob"), nil, types.Long(30), nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(tbl, table.Row{types.Long(1), types.String("Cid"), nil, nil, nil})
+	if err == nil {
+		t.Error("Primary key violated")
+	}
+	err = db.Insert(tbl, table.Row{types.Long(3), nil, nil, nil, nil})
+	if err == nil {
+		t.Error("NOT NULL constraint violated")
+	}
+
+	row, err := db.SelectOne(tbl, "id", types.Long(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[2] != nil || row[3] != types.Long(30) || row[4] != nil {
+		t.Error("NULL values not stored correctly", row)
+	}
+
+	// Constraints without an enforcing index are reported instead of ignored
+	db.Indexes["Users"] = nil
+	err = db.Insert(tbl, table.Row{types.Long(1), types.String("Dan"), nil, nil, nil})
+	if err == nil || !strings.Contains(err.Error(), "has no unique index") {
+		t.Error("Insert without the primary key index:", err)
+	}
+	err = db.reloadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Formatted schemas parse back, quotes in defaults included
+	err = execSQL(db, "CREATE TABLE Quoted (s STRING DEFAULT 'O''Brien\\\\')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl, err = db.OpenTable("Quoted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "CREATE TABLE Copy ("+types.ColDefs(tbl.Schema.Columns).String()+")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl, err = db.OpenTable("Copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Schema.Columns[0].Default != types.String("O'Brien\\") {
+		t.Error("Unexpected default after formatting", tbl.Schema.Columns[0].Default)
+	}
+}
+
+func TestCloseError(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	// Closing the file a second time fails
+	db.Pager.File.Close()
+	if db.Close() == nil {
+		t.Error("Close didn't report the failure")
+	}
+}
+
+func TestMissingTable(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	for _, sql := range []string{
+		"SELECT * FROM nosuch",
+		"DELETE FROM nosuch",
+		"INSERT INTO nosuch VALUES (1)",
+		"CREATE INDEX Idx ON nosuch (id)",
+		"ANALYZE nosuch",
+	} {
+		err := execSQL(db, sql)
+		if err == nil || err.Error() != "Table 'nosuch' not found" {
+			t.Error(sql, "failed with", err)
+		}
+	}
+}
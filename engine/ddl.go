@@ -0,0 +1,356 @@
+package engine
+
+// The sqlparser only recognizes index statements and drops the index name and
+// columns. It also only keeps one key option per column in CREATE TABLE,
+// doesn't keep the statement following EXPLAIN and doesn't parse ANALYZE.
+// These statements are parsed here using its tokenizer.
+
+import (
+	"errors"
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+	"unicode"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// CREATE TABLE name (column type [NOT NULL] [PRIMARY KEY] [UNIQUE] [DEFAULT value], ...)
+type CreateTableStmt struct {
+	Name    string
+	Columns []table.ColumnDef
+}
+
+// CREATE [UNIQUE] INDEX name ON table (column, ...)
+type CreateIndexStmt struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+}
+
+// DROP INDEX name [ON table]
+type DropIndexStmt struct {
+	Name string
+	// Optional, empty if not given
+	Table string
+}
+
+// ANALYZE [[TABLE] name]
+type AnalyzeStmt struct {
+	// Empty to analyze all tables
+	Table string
+}
+
+// EXPLAIN [ANALYZE] select
+type ExplainStmt struct {
+	Analyze bool
+	Select  *sqlparser.Select
+}
+
+type tokenReader struct {
+	sql       string
+	tokenizer *sqlparser.Tokenizer
+	token     int
+	value     []byte
+	// The offset in sql up to which the tokens before the current one were
+	// read, the current token follows after blanks and comments
+	offset int
+}
+
+func newTokenReader(sql string) *tokenReader {
+	reader := &tokenReader{sql: sql, tokenizer: sqlparser.NewStringTokenizer(sql, sqlparser.SQLMode)}
+	reader.advance()
+	return reader
+}
+
+// Reads the next token, skipping comments
+func (reader *tokenReader) advance() {
+	for {
+		// The tokenizer has already read the character following the last token
+		reader.offset = reader.tokenizer.Position - 1
+		if reader.offset < 0 {
+			reader.offset = 0
+		}
+		reader.token, reader.value = reader.tokenizer.Scan()
+		if reader.token != sqlparser.COMMENT {
+			return
+		}
+	}
+}
+
+// The rest of the statement, starting with the current token
+func (reader *tokenReader) rest() string {
+	return reader.sql[reader.offset:]
+}
+
+// Consumes the current token if it is of the given type
+func (reader *tokenReader) accept(token int) bool {
+	if reader.token != token {
+		return false
+	}
+	reader.advance()
+	return true
+}
+
+func (reader *tokenReader) expect(token int, description string) error {
+	if !reader.accept(token) {
+		return errors.New("Syntax error. Expected " + description)
+	}
+	return nil
+}
+
+// Reads an identifier.
+// Keywords are accepted as well, as long as they are used unambiguously.
+// Like in the sqlparser, these are lowercased by the tokenizer.
+func (reader *tokenReader) identifier() (string, error) {
+	isKeyword := reader.token > 0 && reader.token != sqlparser.STRING && len(reader.value) > 0 &&
+		unicode.IsLetter(rune(reader.value[0]))
+	if reader.token != sqlparser.ID && !isKeyword {
+		return "", errors.New("Syntax error. Expected identifier")
+	}
+	name := string(reader.value)
+	reader.advance()
+	return name, nil
+}
+
+// Whether the end of the statement was reached
+func (reader *tokenReader) atEnd() bool {
+	return reader.token == 0 || reader.token == ';'
+}
+
+// Parses the statements the sqlparser doesn't handle.
+// Returns nil without error if the statement is not one of them.
+func parseDDLStatement(sql string) (interface{}, error) {
+	reader := newTokenReader(sql)
+	switch {
+	case reader.accept(sqlparser.CREATE):
+		if reader.accept(sqlparser.TABLE) {
+			return parseCreateTable(reader)
+		}
+		unique := reader.accept(sqlparser.UNIQUE)
+		if !reader.accept(sqlparser.INDEX) {
+			return nil, nil
+		}
+		return parseCreateIndex(reader, unique)
+	case reader.accept(sqlparser.DROP):
+		if !reader.accept(sqlparser.INDEX) {
+			return nil, nil
+		}
+		return parseDropIndex(reader)
+	case reader.accept(sqlparser.ANALYZE):
+		return parseAnalyze(reader)
+	case reader.accept(sqlparser.EXPLAIN):
+		return parseExplain(reader)
+	}
+	return nil, nil
+}
+
+func parseCreateTable(reader *tokenReader) (*CreateTableStmt, error) {
+	stmt := &CreateTableStmt{}
+
+	var err error
+	stmt.Name, err = reader.identifier()
+	if err != nil {
+		return nil, err
+	}
+	err = reader.expect('(', "(")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		column, err := parseColumnDef(reader)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, column)
+		if !reader.accept(',') {
+			break
+		}
+	}
+	err = reader.expect(')', ")")
+	if err != nil {
+		return nil, err
+	}
+	if !reader.atEnd() {
+		return nil, errors.New("Syntax error. Unexpected input after CREATE TABLE")
+	}
+
+	return stmt, nil
+}
+
+func parseColumnDef(reader *tokenReader) (table.ColumnDef, error) {
+	var column table.ColumnDef
+
+	var err error
+	column.Name, err = reader.identifier()
+	if err != nil {
+		return column, err
+	}
+	typeName, err := reader.identifier()
+	if err != nil {
+		return column, err
+	}
+	column.Type, err = types.TypeBySqlName(typeName)
+	if err != nil {
+		return column, err
+	}
+	// The length of a type, as in VARCHAR(255), is not enforced
+	if reader.accept('(') {
+		err = reader.expect(sqlparser.INTEGRAL, "type length")
+		if err != nil {
+			return column, err
+		}
+		err = reader.expect(')', ")")
+		if err != nil {
+			return column, err
+		}
+	}
+
+	for {
+		switch {
+		case reader.accept(sqlparser.NOT):
+			err = reader.expect(sqlparser.NULL, "NULL")
+			if err != nil {
+				return column, err
+			}
+			column.NotNull = true
+		case reader.accept(sqlparser.NULL):
+			// Columns are nullable by default
+		case reader.accept(sqlparser.PRIMARY):
+			err = reader.expect(sqlparser.KEY, "KEY")
+			if err != nil {
+				return column, err
+			}
+			column.PrimaryKey = true
+		case reader.accept(sqlparser.UNIQUE):
+			reader.accept(sqlparser.KEY)
+			column.Unique = true
+		case reader.accept(sqlparser.DEFAULT):
+			column.Default, err = reader.literal()
+			if err != nil {
+				return column, err
+			}
+			if column.Default != nil && column.Default.Type() != column.Type {
+				return column, errors.New("Default value of column '" + column.Name + "' doesn't match its type")
+			}
+		default:
+			return column, nil
+		}
+	}
+}
+
+// Reads a constant value, nil for NULL
+func (reader *tokenReader) literal() (table.ColumnValue, error) {
+	negative := reader.accept('-')
+	value := string(reader.value)
+	switch {
+	case reader.accept(sqlparser.INTEGRAL):
+		num, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if negative {
+			num = -num
+		}
+		return types.Long(num), nil
+	case negative:
+		return nil, errors.New("Syntax error. Expected number")
+	case reader.accept(sqlparser.STRING):
+		return types.String(value), nil
+	case reader.accept(sqlparser.NULL):
+		return nil, nil
+	}
+	return nil, errors.New("Syntax error. Expected value")
+}
+
+func parseCreateIndex(reader *tokenReader, unique bool) (*CreateIndexStmt, error) {
+	stmt := &CreateIndexStmt{Unique: unique}
+
+	var err error
+	stmt.Name, err = reader.identifier()
+	if err != nil {
+		return nil, err
+	}
+	err = reader.expect(sqlparser.ON, "ON")
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table, err = reader.identifier()
+	if err != nil {
+		return nil, err
+	}
+	err = reader.expect('(', "(")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		column, err := reader.identifier()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, column)
+		if !reader.accept(',') {
+			break
+		}
+	}
+	err = reader.expect(')', ")")
+	if err != nil {
+		return nil, err
+	}
+	if !reader.atEnd() {
+		return nil, errors.New("Syntax error. Unexpected input after CREATE INDEX")
+	}
+
+	return stmt, nil
+}
+
+func parseDropIndex(reader *tokenReader) (*DropIndexStmt, error) {
+	stmt := &DropIndexStmt{}
+
+	var err error
+	stmt.Name, err = reader.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if reader.accept(sqlparser.ON) {
+		stmt.Table, err = reader.identifier()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !reader.atEnd() {
+		return nil, errors.New("Syntax error. Unexpected input after DROP INDEX")
+	}
+
+	return stmt, nil
+}
+
+func parseAnalyze(reader *tokenReader) (*AnalyzeStmt, error) {
+	stmt := &AnalyzeStmt{}
+	if reader.accept(sqlparser.TABLE) || !reader.atEnd() {
+		var err error
+		stmt.Table, err = reader.identifier()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !reader.atEnd() {
+		return nil, errors.New("Syntax error. Unexpected input after ANALYZE")
+	}
+	return stmt, nil
+}
+
+func parseExplain(reader *tokenReader) (*ExplainStmt, error) {
+	analyze := reader.accept(sqlparser.ANALYZE)
+	// The explained statement follows the keywords
+	stmt, err := sqlparser.Parse(reader.rest())
+	if err != nil {
+		return nil, err
+	}
+	selectStmt, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, errors.New("EXPLAIN failed. Only SELECT statements can be explained")
+	}
+	return &ExplainStmt{Analyze: analyze, Select: selectStmt}, nil
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"godb/exec"
+	"godb/table"
+	"godb/table/types"
+	"testing"
+)
+
+func TestWhereExpressions(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []table.ColumnValue{
+		types.String("apple"), types.String("banana"), types.String("cherry"), nil, types.String("a_b"),
+	}
+	for i, value := range values {
+		err = db.Insert(tbl, table.Row{types.Long(i), value})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		where    string
+		expected int
+	}{
+		{"`key` = 1 OR `key` = 3", 2},
+		{"NOT (`key` < 2 AND value LIKE 'a%')", 4},
+		{"`key` IN (0, 2, 7)", 2},
+		{"`key` NOT IN (0, NULL)", 0},
+		{"`key` BETWEEN 1 AND 3", 3},
+		{"`key` NOT BETWEEN 1 AND 3", 2},
+		{"value LIKE '%an%'", 1},
+		{"value LIKE '_pp%e'", 1},
+		{"value LIKE 'a!_%' ESCAPE '!'", 1},
+		{"value NOT LIKE 'a%'", 2},
+		{"value IS NULL", 1},
+		{"value IS NOT NULL AND `key` * 2 + 1 > 4", 2},
+		{"value = NULL OR NOT value = 'apple'", 3},
+		{"(`key` - 1) % 2 = 0 AND value <> 'cherry'", 1},
+		{"-`key` >= -1", 2},
+	}
+	for _, test := range tests {
+		rows, err := exec.QueryRows(db, mustParseSelect(t, "SELECT * FROM Test WHERE "+test.where))
+		if err != nil {
+			t.Error(test.where, err)
+			continue
+		}
+		if len(rows) != test.expected {
+			t.Error(test.where, "selected", len(rows), "rows instead of", test.expected)
+		}
+	}
+
+	invalid := []string{
+		"`key` = 'one'",
+		"value + 1 = 2",
+		"`key` LIKE 'a%'",
+		"missing = 1",
+		"`key`",
+	}
+	for _, where := range invalid {
+		_, err := exec.Query(db, mustParseSelect(t, "SELECT * FROM Test WHERE "+where))
+		if err == nil {
+			t.Error("Invalid WHERE", where, "was accepted")
+		}
+	}
+
+	_, err = exec.QueryRows(db, mustParseSelect(t, "SELECT * FROM Test WHERE `key` / 0 = 1"))
+	if err == nil {
+		t.Error("Division by zero didn't fail")
+	}
+
+	for _, sql := range []string{
+		"SELECT `key` + 9223372036854775807 FROM Test",
+		"SELECT -`key` - 9223372036854775807 - 2 FROM Test",
+		"SELECT COUNT(DISTINCT `key` * 3000000000000000000) FROM Test",
+		"SELECT (-9223372036854775807 - 1) / -1 FROM Test",
+		"SELECT abs(-9223372036854775807 - `key`) FROM Test",
+		"SELECT SUM(`key` + 9223372036854775800) FROM Test",
+	} {
+		_, err = exec.QueryRows(db, mustParseSelect(t, sql))
+		if err == nil {
+			t.Error("Overflow didn't fail:", sql)
+		}
+	}
+}
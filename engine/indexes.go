@@ -0,0 +1,335 @@
+package engine
+
+import (
+	"errors"
+	"godb/index"
+	"godb/table"
+	"godb/table/types"
+)
+
+func IndexToDictionaryEntry(idx *index.TableIndex, columns []table.ColumnDef) table.Row {
+	unique := types.Long(0)
+	if idx.Unique {
+		unique = types.Long(1)
+	}
+	return table.Row{
+		types.String(idx.Name),
+		types.String(idx.TableName),
+		types.ColDefs(columns),
+		unique,
+		types.Long(idx.Tree.RootPageIdx),
+	}
+}
+
+func (db *Database) indexFromDictionaryEntry(entry table.Row) *index.TableIndex {
+	columnDefs := entry[2].(types.ColDefs)
+	columns := make([]string, len(columnDefs))
+	keyTypes := make([]*table.DataType, len(columnDefs))
+	for i, colDef := range columnDefs {
+		columns[i] = colDef.Name
+		keyTypes[i] = colDef.Type
+	}
+
+	return &index.TableIndex{
+		Name:      string(entry[0].(types.String)),
+		TableName: string(entry[1].(types.String)),
+		Columns:   columns,
+		Unique:    entry[3].(types.Long) != 0,
+		Tree:      index.Open(db.Pager, int64(entry[4].(types.Long)), keyTypes),
+	}
+}
+
+// Reads all indexes from the IndexDictionary
+func (db *Database) loadIndexes() error {
+	dict, err := db.OpenTable("IndexDictionary")
+	if err != nil {
+		return err
+	}
+
+	db.Indexes = make(map[string][]*index.TableIndex)
+	return dict.ForEachRow(func(rowId table.RowId, entry table.Row) (bool, error) {
+		idx := db.indexFromDictionaryEntry(entry)
+		db.Indexes[idx.TableName] = append(db.Indexes[idx.TableName], idx)
+		return true, nil
+	})
+}
+
+// Rows with NULL in a key column are not indexed.
+// NULL is neither equal to nor ordered with any value, so these rows could
+// never be found through the index anyway.
+func hasNull(key table.Row) bool {
+	for _, val := range key {
+		if val == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// The indexes of a table
+func (db *Database) TableIndexes(tableName string) []*index.TableIndex {
+	return db.Indexes[tableName]
+}
+
+// Finds an index by name, regardless of its table
+func (db *Database) IndexByName(name string) *index.TableIndex {
+	for _, indexes := range db.Indexes {
+		for _, idx := range indexes {
+			if idx.Name == name {
+				return idx
+			}
+		}
+	}
+	return nil
+}
+
+// Creates an index over the given columns and adds all existing rows to it
+func (db *Database) CreateIndex(name string, tbl *table.Table, columns []string, unique bool) (*index.TableIndex, error) {
+	var idx *index.TableIndex
+	err := db.atomically(func() error {
+		var err error
+		idx, err = db.createIndex(name, tbl, columns, unique)
+		return err
+	})
+	return idx, err
+}
+
+func (db *Database) createIndex(name string, tbl *table.Table, columns []string, unique bool) (*index.TableIndex, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("CreateIndex failed. No columns given")
+	}
+	if db.IndexByName(name) != nil {
+		return nil, errors.New("CreateIndex failed. Index '" + name + "' already exists")
+	}
+
+	columnDefs := make([]table.ColumnDef, len(columns))
+	keyTypes := make([]*table.DataType, len(columns))
+	for i, column := range columns {
+		colDef, _, err := tbl.Schema.FindColumnByName(column)
+		if err != nil {
+			return nil, err
+		}
+		columnDefs[i] = *colDef
+		keyTypes[i] = colDef.Type
+	}
+
+	tree, err := index.Create(db.Pager, keyTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &index.TableIndex{
+		Name:      name,
+		TableName: tbl.Name,
+		Columns:   columns,
+		Unique:    unique,
+		Tree:      tree,
+	}
+
+	err = tbl.ForEachRow(func(rowId table.RowId, row table.Row) (bool, error) {
+		key, err := idx.Key(tbl, row)
+		if err != nil || hasNull(key) {
+			return err == nil, err
+		}
+		if unique {
+			rowIds, err := tree.Search(key)
+			if err != nil {
+				return false, err
+			}
+			if len(rowIds) > 0 {
+				return false, errors.New("CreateIndex failed. Duplicate values for unique index '" + name + "'")
+			}
+		}
+		return true, tree.Insert(key, rowId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dict, err := db.OpenTable("IndexDictionary")
+	if err != nil {
+		return nil, err
+	}
+	err = db.insert(dict, IndexToDictionaryEntry(idx, columnDefs))
+	if err != nil {
+		return nil, err
+	}
+
+	db.Indexes[tbl.Name] = append(db.Indexes[tbl.Name], idx)
+
+	return idx, nil
+}
+
+// Removes an index from the catalog and frees its pages.
+// If tableName is not empty, the index must belong to that table.
+func (db *Database) DropIndex(name string, tableName string) error {
+	return db.atomically(func() error {
+		return db.dropIndex(name, tableName)
+	})
+}
+
+func (db *Database) dropIndex(name string, tableName string) error {
+	idx := db.IndexByName(name)
+	if idx == nil || (tableName != "" && idx.TableName != tableName) {
+		return errors.New("DropIndex failed. Index '" + name + "' not found")
+	}
+
+	tbl, err := db.OpenTable(idx.TableName)
+	if err != nil {
+		return err
+	}
+	for _, col := range tbl.Schema.Columns {
+		if constraintIndexName(tbl.Name, col) == name {
+			return errors.New("DropIndex failed. Index '" + name + "' enforces a constraint of column '" + col.Name + "'")
+		}
+	}
+
+	dict, err := db.OpenTable("IndexDictionary")
+	if err != nil {
+		return err
+	}
+
+	var entryRowId *table.RowId
+	err = dict.ForEachRow(func(rowId table.RowId, entry table.Row) (bool, error) {
+		if entry[0] == types.String(name) {
+			entryRowId = &rowId
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if entryRowId == nil {
+		return errors.New("DropIndex failed. Index '" + name + "' missing from the IndexDictionary")
+	}
+
+	err = dict.DeleteRow(*entryRowId)
+	if err != nil {
+		return err
+	}
+
+	err = idx.Tree.Drop()
+	if err != nil {
+		return err
+	}
+
+	indexes := db.Indexes[idx.TableName]
+	for i, other := range indexes {
+		if other == idx {
+			db.Indexes[idx.TableName] = append(indexes[:i], indexes[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Finds an index whose leading columns are the given ones
+func (db *Database) FindIndex(tableName string, columns []string) *index.TableIndex {
+	for _, idx := range db.Indexes[tableName] {
+		if len(idx.Columns) < len(columns) {
+			continue
+		}
+		matches := true
+		for i, column := range columns {
+			if idx.Columns[i] != column {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return idx
+		}
+	}
+	return nil
+}
+
+// Checks that storing the row at the given location doesn't violate any
+// unique index of its table.
+// Entries of the row itself are ignored, so this works for updates as well.
+func (db *Database) checkUnique(tbl *table.Table, rowId table.RowId, row table.Row) error {
+	err := db.checkConstraintIndexes(tbl)
+	if err != nil {
+		return err
+	}
+	for _, idx := range db.Indexes[tbl.Name] {
+		if !idx.Unique {
+			continue
+		}
+		key, err := idx.Key(tbl, row)
+		if err != nil {
+			return err
+		}
+		if hasNull(key) {
+			continue
+		}
+		rowIds, err := idx.Tree.Search(key)
+		if err != nil {
+			return err
+		}
+		for _, other := range rowIds {
+			if other != rowId {
+				return errors.New("Unique index '" + idx.Name + "' violated")
+			}
+		}
+	}
+	return nil
+}
+
+// Checks that the primary key and unique columns of a table have a unique
+// index over just that column, which enforces their constraint
+func (db *Database) checkConstraintIndexes(tbl *table.Table) error {
+	for _, col := range tbl.Schema.Columns {
+		if !col.PrimaryKey && !col.Unique {
+			continue
+		}
+		enforced := false
+		for _, idx := range db.Indexes[tbl.Name] {
+			if idx.Unique && len(idx.Columns) == 1 && idx.Columns[0] == col.Name {
+				enforced = true
+				break
+			}
+		}
+		if !enforced {
+			return errors.New("Constraint of column '" + col.Name + "' of table '" + tbl.Name + "' has no unique index")
+		}
+	}
+	return nil
+}
+
+// Adds a newly stored row to all indexes of its table
+func (db *Database) indexInsert(tbl *table.Table, rowId table.RowId, row table.Row) error {
+	for _, idx := range db.Indexes[tbl.Name] {
+		key, err := idx.Key(tbl, row)
+		if err != nil {
+			return err
+		}
+		if hasNull(key) {
+			continue
+		}
+		err = idx.Tree.Insert(key, rowId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes a row from all indexes of its table
+func (db *Database) indexDelete(tbl *table.Table, rowId table.RowId, row table.Row) error {
+	for _, idx := range db.Indexes[tbl.Name] {
+		key, err := idx.Key(tbl, row)
+		if err != nil {
+			return err
+		}
+		if hasNull(key) {
+			continue
+		}
+		err = idx.Tree.Delete(key, rowId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
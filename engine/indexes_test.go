@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"godb/exec"
+	"godb/table"
+	"godb/table/types"
+	"strings"
+	"testing"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+func TestIndexMaintenance(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(tbl, table.Row{types.Long(1), types.String("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := db.CreateIndex("TestValue", tbl, []string{"value"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Insert(tbl, table.Row{types.Long(2), types.String("two")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(tbl, "key", types.Long(1), table.Row{types.Long(1), types.String("uno")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rowIds, err := idx.Tree.Search(table.Row{types.String("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowIds) != 0 {
+		t.Error("Updated value still indexed")
+	}
+
+	row, err := db.SelectOne(tbl, "value", types.String("uno"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[0] != types.Long(1) {
+		t.Error("Wrong row found through index")
+	}
+
+	row, err = db.SelectOne(tbl, "value", types.String("two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[0] != types.Long(2) {
+		t.Error("Inserted row not indexed")
+	}
+}
+
+func TestIndexStatements(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err = db.Insert(tbl, table.Row{types.Long(i), types.String("value")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execSQL(db, "CREATE UNIQUE INDEX TestValue ON Test (value)")
+	if err == nil {
+		t.Error("Unique index created over duplicate values")
+	}
+	err = execSQL(db, "CREATE UNIQUE INDEX TestKey ON Test (key)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Insert(tbl, table.Row{types.Long(3), types.String("duplicate")})
+	if err == nil {
+		t.Error("Unique index violated by insert")
+	}
+
+	tbl, _ = db.OpenTable("Test")
+	var preds []exec.Predicate
+	preds, err = exec.ExtractPredicates(mustParseWhere(t, "SELECT * FROM Test WHERE `key` >= 4 AND `key` < 7"), tbl.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := exec.ChooseAccessPath(db.TableIndexes(tbl.Name), preds)
+	if path.Index == nil || path.Index.Name != "TestKey" {
+		t.Fatal("Index not chosen for range predicate")
+	}
+	count := 0
+	err = db.scan(tbl, path, func(rowId table.RowId, row table.Row) (bool, error) {
+		count++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Error("Index range scan returned", count, "rows")
+	}
+
+	// The catalog survives a reload
+	err = db.reloadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.IndexByName("TestKey") == nil {
+		t.Error("Index missing from the IndexDictionary")
+	}
+
+	err = execSQL(db, "DROP INDEX TestKey ON Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.reloadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.IndexByName("TestKey") != nil {
+		t.Error("Dropped index still in the IndexDictionary")
+	}
+
+	// The indexes enforcing constraints can't be dropped
+	err = execSQL(db, "CREATE TABLE Keyed (id LONG PRIMARY KEY, s STRING UNIQUE)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Keyed_pkey", "Keyed_s_key"} {
+		err = execSQL(db, "DROP INDEX "+name)
+		if err == nil || !strings.Contains(err.Error(), "enforces a constraint") {
+			t.Error("Constraint index", name, "dropped:", err)
+		}
+	}
+	err = execSQL(db, "INSERT INTO Keyed VALUES (1, 'a')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "INSERT INTO Keyed VALUES (1, 'dup')")
+	if err == nil {
+		t.Error("Primary key violated after DROP INDEX")
+	}
+}
+
+func mustParseWhere(t *testing.T, sql string) sqlparser.Expr {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmt.(*sqlparser.Select).Where.Expr
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"errors"
+	"godb/exec"
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// Executes INSERT INTO ... VALUES and INSERT INTO ... SELECT.
+// Either all rows are inserted or none. Returns the number of inserted rows.
+func (db *Database) execInsert(stmt *sqlparser.Insert) (int, error) {
+	if stmt.Action != sqlparser.InsertStr || stmt.OnDup != nil {
+		return 0, errors.New("Insert failed. Only plain INSERT is supported")
+	}
+
+	tbl, err := db.OpenTable(stmt.Table.Name.String())
+	if err != nil {
+		return 0, err
+	}
+
+	// The positions of the given values within the table's rows
+	colIdxs, err := insertColumns(tbl, stmt.Columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []table.Row
+	switch source := stmt.Rows.(type) {
+	case sqlparser.Values:
+		for _, tuple := range source {
+			if len(tuple) != len(colIdxs) {
+				return 0, errors.New("Insert failed. " + strconv.Itoa(len(tuple)) + " values given for " +
+					strconv.Itoa(len(colIdxs)) + " columns")
+			}
+			values := make(table.Row, len(tuple))
+			for i, expr := range tuple {
+				values[i], err = literalValue(expr, tbl.Schema.Columns[colIdxs[i]])
+				if err != nil {
+					return 0, err
+				}
+			}
+			rows = append(rows, values)
+		}
+	case *sqlparser.Select:
+		// The source is read completely first, so it may be the target table itself
+		rows, err = exec.QueryRows(db, source)
+		if err != nil {
+			return 0, err
+		}
+		for _, values := range rows {
+			if len(values) != len(colIdxs) {
+				return 0, errors.New("Insert failed. SELECT returns " + strconv.Itoa(len(values)) +
+					" columns for " + strconv.Itoa(len(colIdxs)) + " target columns")
+			}
+		}
+	default:
+		return 0, errors.New("Insert failed. Only VALUES and SELECT are supported as source")
+	}
+
+	err = db.atomically(func() error {
+		for _, values := range rows {
+			// Columns without a value get their default
+			row := make(table.Row, len(tbl.Schema.Columns))
+			for i, col := range tbl.Schema.Columns {
+				row[i] = col.Default
+			}
+			for i, colIdx := range colIdxs {
+				row[colIdx] = values[i]
+			}
+
+			err := db.insertRow(tbl, row)
+			if err != nil {
+				return err
+			}
+		}
+		return db.FlushTableDictionary(tbl)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// Resolves the column list of an INSERT into column positions.
+// Without a column list, values are given for all columns in order.
+func insertColumns(tbl *table.Table, columns sqlparser.Columns) ([]int, error) {
+	if len(columns) == 0 {
+		colIdxs := make([]int, len(tbl.Schema.Columns))
+		for i := range colIdxs {
+			colIdxs[i] = i
+		}
+		return colIdxs, nil
+	}
+
+	colIdxs := make([]int, len(columns))
+	seen := make(map[int]bool)
+	for i, column := range columns {
+		_, colIdx, err := tbl.Schema.FindColumnByName(column.String())
+		if err != nil {
+			return nil, err
+		}
+		if seen[colIdx] {
+			return nil, errors.New("Insert failed. Column '" + column.String() + "' given more than once")
+		}
+		seen[colIdx] = true
+		colIdxs[i] = colIdx
+	}
+	return colIdxs, nil
+}
+
+// Converts a literal into a value of the column's type, nil for NULL
+func literalValue(expr sqlparser.Expr, colDef table.ColumnDef) (table.ColumnValue, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.NullVal:
+		return nil, nil
+	case *sqlparser.SQLVal:
+		switch {
+		case colDef.Type == types.TypeLong && expr.Type == sqlparser.IntVal:
+			num, err := strconv.ParseInt(string(expr.Val), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			return types.Long(num), nil
+		case colDef.Type == types.TypeString && expr.Type == sqlparser.StrVal:
+			return types.String(expr.Val), nil
+		}
+		return nil, errors.New("Value '" + string(expr.Val) + "' doesn't match the type " +
+			colDef.Type.Name + " of column '" + colDef.Name + "'")
+	default:
+		return nil, errors.New("Only literal values are supported in VALUES")
+	}
+}
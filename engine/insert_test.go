@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"godb/table"
+	"godb/table/types"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInsertStatement(t *testing.T) {
+	db := openTestDatabase(t)
+	defer func() { closeTestDatabase(db) }()
+
+	err := execSQL(db, "CREATE TABLE Users (id INT PRIMARY KEY, name TEXT NOT NULL, age INT DEFAULT 18)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "INSERT INTO Users VALUES (1, 'Ann', 30), (2, 'Bob', -4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "INSERT INTO Users (name, id) VALUES ('Cid', 3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "INSERT INTO Users (id, name, age) VALUES (4, 'Dan', NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "INSERT INTO Users VALUES (9223372036854775807, 'Max', -9223372036854775807)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, err := db.OpenTable("Users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[types.Long]table.Row{
+		1:             {types.Long(1), types.String("Ann"), types.Long(30)},
+		2:             {types.Long(2), types.String("Bob"), types.Long(-4)},
+		3:             {types.Long(3), types.String("Cid"), types.Long(18)},
+		4:             {types.Long(4), types.String("Dan"), nil},
+		math.MaxInt64: {types.Long(math.MaxInt64), types.String("Max"), types.Long(-math.MaxInt64)},
+	}
+	for id, expectedRow := range expected {
+		row, err := db.SelectOne(tbl, "id", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range row {
+			if row[i] != expectedRow[i] {
+				t.Error("Row", id, "is", row, "instead of", expectedRow)
+				break
+			}
+		}
+	}
+
+	// A failing row rolls back the whole statement
+	err = execSQL(db, "INSERT INTO Users VALUES (5, 'Eve', 1), (1, 'Ann', 2)")
+	if err == nil {
+		t.Error("Duplicate primary key inserted")
+	}
+	_, err = db.SelectOne(tbl, "id", types.Long(5))
+	if err == nil {
+		t.Error("Statement not inserted atomically")
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO Users VALUES (5, 'Eve')",
+		"INSERT INTO Users (id) VALUES (5)",
+		"INSERT INTO Users (id, id, name) VALUES (5, 6, 'Eve')",
+		"INSERT INTO Users VALUES ('five', 'Eve', 1)",
+		"INSERT INTO Users VALUES (5, 5, 1)",
+		"INSERT INTO Missing VALUES (1)",
+		"INSERT INTO Users VALUES (9223372036854775808, 'Eve', 1)",
+	} {
+		if execSQL(db, sql) == nil {
+			t.Error("Invalid insert succeeded:", sql)
+		}
+	}
+
+	err = execSQL(db, "CREATE TABLE Copies (name TEXT, id INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "INSERT INTO Copies SELECT name, id FROM Users WHERE id >= 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reading from the target table itself
+	err = execSQL(db, "INSERT INTO Copies (name) SELECT name FROM Copies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies, err := db.OpenTable("Copies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, withoutId := 0, 0
+	err = copies.ForEachRow(func(rowId table.RowId, row table.Row) (bool, error) {
+		count++
+		if row[1] == nil {
+			withoutId++
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 8 || withoutId != 4 {
+		t.Error("Copies has", count, "rows,", withoutId, "without id, instead of 8 and 4")
+	}
+
+	// Rows of one statement filling several pages are all found after reopening
+	values := []string{}
+	for i := 0; i < 300; i++ {
+		values = append(values, "('"+strings.Repeat("x", 50)+"', "+strconv.Itoa(i)+")")
+	}
+	err = execSQL(db, "INSERT INTO Copies VALUES "+strings.Join(values, ", "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = OpenDatabase(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "INSERT INTO Copies VALUES ('last', -1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies, err = db.OpenTable("Copies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count = 0
+	err = copies.ForEachRow(func(rowId table.RowId, row table.Row) (bool, error) {
+		count++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 309 {
+		t.Error("Copies has", count, "rows after reopening instead of 309")
+	}
+}
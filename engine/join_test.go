@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"godb/exec"
+	"godb/table"
+	"godb/table/types"
+	"strings"
+	"testing"
+)
+
+func TestJoins(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	owners, err := db.CreateTable("Owners", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pets, err := db.CreateTable("Pets", table.TableSchema{
+		Columns: []table.ColumnDef{
+			{Name: "name", Type: types.TypeString},
+			{Name: "owner", Type: types.TypeLong},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []table.Row{
+		{types.Long(1), types.String("ann")},
+		{types.Long(2), types.String("bob")},
+		{types.Long(3), types.String("cid")},
+	} {
+		err = db.Insert(owners, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, row := range []table.Row{
+		{types.String("rex"), types.Long(1)},
+		{types.String("tom"), types.Long(1)},
+		{types.String("kit"), types.Long(2)},
+		{types.String("fox"), nil},
+		{types.String("owl"), types.Long(9)},
+	} {
+		err = db.Insert(pets, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT o.value, p.name FROM Owners o JOIN Pets p ON o.`key` = p.owner ORDER BY p.name",
+			"bob kit, ann rex, ann tom"},
+		{"SELECT Owners.value, name FROM Owners INNER JOIN Pets ON `key` = owner AND name <> 'rex' ORDER BY name",
+			"bob kit, ann tom"},
+		{"SELECT o.value, p.name FROM Owners o LEFT JOIN Pets p ON o.`key` = p.owner ORDER BY o.value, p.name",
+			"ann rex, ann tom, bob kit, cid NULL"},
+		{"SELECT o.value, p.name FROM Owners o RIGHT JOIN Pets p ON o.`key` = p.owner ORDER BY p.name",
+			"NULL fox, bob kit, NULL owl, ann rex, ann tom"},
+		{"SELECT o.value, p.name FROM Owners o LEFT JOIN Pets p ON o.`key` = p.owner WHERE p.name IS NULL",
+			"cid NULL"},
+		{"SELECT o.value, p.name FROM Owners o LEFT JOIN Pets p ON o.`key` = p.owner AND p.name = 'kit' ORDER BY o.value",
+			"ann NULL, bob kit, cid NULL"},
+		{"SELECT COUNT(*) FROM Owners CROSS JOIN Pets", "15"},
+		{"SELECT a.value, b.value FROM Owners a, Owners b WHERE a.`key` + 1 = b.`key` ORDER BY a.value",
+			"ann bob, bob cid"},
+		{"SELECT a.value, b.value FROM Owners a JOIN Owners b ON a.`key` < b.`key` WHERE b.value = 'cid' ORDER BY a.value",
+			"ann cid, bob cid"},
+		{"SELECT o.value, COUNT(p.name) FROM Owners o LEFT JOIN Pets p ON o.`key` = p.owner GROUP BY o.value ORDER BY o.value",
+			"ann 2, bob 1, cid 0"},
+		{"SELECT a.value, p.name FROM Owners a JOIN (Pets p, Owners b) ON a.`key` = p.owner AND b.`key` = p.owner WHERE a.value = 'bob'",
+			"bob kit"},
+	}
+	check := func() {
+		for _, test := range tests {
+			rows, err := exec.QueryRows(db, mustParseSelect(t, test.sql))
+			if err != nil {
+				t.Error(test.sql, err)
+				continue
+			}
+			lines := []string{}
+			for _, row := range rows {
+				values := []string{}
+				for _, value := range row {
+					if value == nil {
+						values = append(values, "NULL")
+					} else {
+						values = append(values, value.String())
+					}
+				}
+				lines = append(lines, strings.Join(values, " "))
+			}
+			if strings.Join(lines, ", ") != test.expected {
+				t.Error(test.sql, "returned", lines, "instead of", test.expected)
+			}
+		}
+	}
+	check()
+
+	// Sides which don't fit into memory are merged
+	defer func(budget int) { exec.HASH_JOIN_MEMORY_BUDGET = budget }(exec.HASH_JOIN_MEMORY_BUDGET)
+	exec.HASH_JOIN_MEMORY_BUDGET = 0
+	check()
+
+	// Indexes of large inner tables are used to look up the matching rows of
+	// few outer rows
+	visits, err := db.CreateTable("Visits", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		err = db.Insert(visits, table.Row{types.Long(i % 1000), types.String("visit")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.CreateIndex("OwnersKey", owners, []string{"key"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateIndex("VisitsKey", visits, []string{"key"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, struct {
+		sql      string
+		expected string
+	}{"SELECT o.value, v.`key` FROM Owners o JOIN Visits v ON o.`key` = v.`key` WHERE o.`key` = 2", "bob 2, bob 2"})
+	check()
+
+	invalid := []string{
+		"SELECT * FROM Owners JOIN Owners ON `key` = `key`",
+		"SELECT value FROM Owners a JOIN Owners b ON a.`key` = b.`key`",
+		"SELECT * FROM Owners JOIN Pets USING (name)",
+		"SELECT * FROM Owners NATURAL JOIN Pets",
+		"SELECT * FROM Owners o JOIN Pets p ON Owners.`key` = p.owner",
+	}
+	for _, sql := range invalid {
+		_, err := exec.QueryRows(db, mustParseSelect(t, sql))
+		if err == nil {
+			t.Error("Expected an error for", sql)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"errors"
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+	"strings"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// Replaces the ? placeholders of a statement by the given values, in order,
+// written as SQL literals. Placeholders inside string literals are left alone.
+func BindPlaceholders(sql string, args []table.ColumnValue) (string, error) {
+	tokenizer := sqlparser.NewStringTokenizer(sql, sqlparser.SQLMode)
+	var bound strings.Builder
+	last, argIdx := 0, 0
+	for {
+		token, value := tokenizer.Scan()
+		if token == 0 || token == sqlparser.LEX_ERROR {
+			break
+		}
+		if token != sqlparser.VALUE_ARG {
+			continue
+		}
+		// The tokenizer has already read one character past the placeholder
+		pos := tokenizer.Position - 2
+		if pos < last || sql[pos] != '?' {
+			return "", errors.New("Bind failed. Only ? placeholders are supported, found " + string(value))
+		}
+		if argIdx == len(args) {
+			return "", errors.New("Bind failed. Got " + strconv.Itoa(len(args)) + " arguments for more placeholders")
+		}
+
+		literal := "NULL"
+		if args[argIdx] != nil {
+			literal = sqlLiteral(args[argIdx])
+		}
+		bound.WriteString(sql[last:pos])
+		if strings.HasPrefix(literal, "-") {
+			// Keeps a minus in front of the placeholder from starting a comment
+			bound.WriteString(" ")
+		}
+		bound.WriteString(literal)
+		last = pos + 1
+		argIdx++
+	}
+	if argIdx != len(args) {
+		return "", errors.New("Bind failed. Got " + strconv.Itoa(len(args)) + " arguments for " +
+			strconv.Itoa(argIdx) + " placeholders")
+	}
+	bound.WriteString(sql[last:])
+	return bound.String(), nil
+}
+
+// Binds the arguments of a statement to its ? placeholders.
+// Arguments may be integers, strings, byte slices or nil for NULL.
+func BindArguments(sql string, args []interface{}) (string, error) {
+	values := make([]table.ColumnValue, len(args))
+	for i, arg := range args {
+		var err error
+		values[i], err = argumentValue(arg)
+		if err != nil {
+			return "", err
+		}
+	}
+	return BindPlaceholders(sql, values)
+}
+
+func argumentValue(arg interface{}) (table.ColumnValue, error) {
+	switch arg := arg.(type) {
+	case nil:
+		return nil, nil
+	case int:
+		return types.Long(arg), nil
+	case int32:
+		return types.Long(arg), nil
+	case int64:
+		return types.Long(arg), nil
+	case string:
+		return types.String(arg), nil
+	case []byte:
+		return types.String(arg), nil
+	}
+	return nil, errors.New("Bind failed. Only integer, string and NULL arguments are supported")
+}
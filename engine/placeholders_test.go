@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"godb/table"
+	"godb/table/types"
+	"testing"
+)
+
+func TestBindPlaceholders(t *testing.T) {
+	sql, err := BindPlaceholders("SELECT * FROM t WHERE a = ? AND b = '?' AND c IN (?, ?) AND d = ?",
+		[]table.ColumnValue{types.Long(-3), types.String("it's"), nil, types.Long(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "SELECT * FROM t WHERE a =  -3 AND b = '?' AND c IN ('it\\'s', NULL) AND d = 7"
+	if sql != expected {
+		t.Errorf("Unexpected statement %q", sql)
+	}
+
+	for _, args := range [][]table.ColumnValue{{}, {types.Long(1), types.Long(2)}} {
+		_, err = BindPlaceholders("INSERT INTO t VALUES (?)", args)
+		if err == nil {
+			t.Error("Bound", len(args), "arguments to one placeholder")
+		}
+	}
+	_, err = BindPlaceholders("SELECT * FROM t WHERE a = :a", []table.ColumnValue{types.Long(1)})
+	if err == nil {
+		t.Error("Bound a named placeholder")
+	}
+}
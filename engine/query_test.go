@@ -0,0 +1,308 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"godb/exec"
+	"godb/table"
+	"godb/table/types"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+func mustParseSelect(t *testing.T, sql string) *sqlparser.Select {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmt.(*sqlparser.Select)
+}
+
+func TestSelectCursor(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough rows to span several pages
+	for i := 0; i < 500; i++ {
+		err = db.Insert(tbl, table.Row{types.Long(i % 10), types.String(strings.Repeat("v", 20))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tbl.FirstPageIdx == tbl.LastPageIdx {
+		t.Fatal("Rows don't span several pages")
+	}
+
+	count := 0
+	cursor := db.Select(tbl, "key", types.Long(3))
+	for cursor.Next() {
+		if cursor.Row()[0] != types.Long(3) {
+			t.Error("Cursor returned non-matching row", cursor.Row())
+		}
+		count++
+	}
+	cursor.Close()
+	if cursor.Err() != nil {
+		t.Fatal(cursor.Err())
+	}
+	if count != 50 {
+		t.Error("Cursor returned", count, "rows instead of 50")
+	}
+
+	cursor = db.Select(tbl, "missing", types.Long(3))
+	if cursor.Next() || cursor.Err() == nil {
+		t.Error("Cursor over unknown column didn't fail")
+	}
+
+	var out bytes.Buffer
+	result, err := exec.Query(db, mustParseSelect(t, "SELECT value, `key` FROM Test WHERE `key` = 11"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = printResult(&out, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "value | key\n0 rows\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	rows, err := exec.QueryRows(db, mustParseSelect(t, "SELECT * FROM Test WHERE `key` >= 8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 100 {
+		t.Error("Select returned", len(rows), "rows instead of 100")
+	}
+}
+
+func TestSelectProjection(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range []table.ColumnValue{types.String("one"), nil} {
+		err = db.Insert(tbl, table.Row{types.Long(i + 1), value})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	result, err := exec.Query(db, mustParseSelect(t,
+		"SELECT value AS name, `key` * 10 + 1, upper(value) || '!', concat(value, '-', `key`) AS c, "+
+			"coalesce(value, 'none'), length(value), abs(-`key`) FROM Test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTypes := []*table.DataType{
+		types.TypeString, types.TypeLong, types.TypeString, types.TypeString, types.TypeString, types.TypeLong, types.TypeLong,
+	}
+	for i, col := range result.Columns {
+		if col.Type != expectedTypes[i] {
+			t.Error("Column", col.Name, "has type", col.Type.Name, "instead of", expectedTypes[i].Name)
+		}
+	}
+	err = printResult(&out, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "name | `key` * 10 + 1 | upper(value) or '!' | c | coalesce(value, 'none') | length(value) | abs(-`key`)\n" +
+		"one | 11 | ONE! | one-1 | one | 3 | 1\n" +
+		"NULL | 21 | NULL | NULL | none | NULL | 2\n" +
+		"2 rows\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	invalid := []string{
+		"SELECT unknown(value) FROM Test",
+		"SELECT upper(`key`) FROM Test",
+		"SELECT value - 1 FROM Test",
+		"SELECT missing FROM Test",
+	}
+	for _, sql := range invalid {
+		_, err := exec.Query(db, mustParseSelect(t, sql))
+		if err == nil {
+			t.Error("Invalid select list", sql, "was accepted")
+		}
+	}
+}
+
+func TestSelectOrderBy(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range []table.ColumnValue{types.String("b"), nil, types.String("a"), types.String("b")} {
+		err = db.Insert(tbl, table.Row{types.Long(i), value})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT `key` FROM Test ORDER BY value, `key` DESC", "1 2 3 0"},
+		{"SELECT `key` FROM Test ORDER BY value DESC, `key`", "0 3 2 1"},
+		{"SELECT `key` * -1 AS k FROM Test ORDER BY k", "3 2 1 0"},
+		{"SELECT value, `key` FROM Test ORDER BY 2 DESC", "3 2 1 0"},
+		{"SELECT `key` FROM Test WHERE `key` > 0 ORDER BY `key` % 2, `key` DESC", "2 3 1"},
+	}
+	for _, test := range tests {
+		rows, err := exec.QueryRows(db, mustParseSelect(t, test.sql))
+		if err != nil {
+			t.Error(test.sql, err)
+			continue
+		}
+		keys := []string{}
+		for _, row := range rows {
+			keys = append(keys, strings.TrimPrefix(row[len(row)-1].String(), "-"))
+		}
+		if strings.Join(keys, " ") != test.expected {
+			t.Error(test.sql, "returned", keys, "instead of", test.expected)
+		}
+	}
+
+	_, err = exec.Query(db, mustParseSelect(t, "SELECT `key` FROM Test ORDER BY 3"))
+	if err == nil {
+		t.Error("ORDER BY position outside the select list was accepted")
+	}
+}
+
+func TestSelectLimit(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		err = db.Insert(tbl, table.Row{types.Long(i), types.String(strings.Repeat("v", 20))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT `key` FROM Test LIMIT 3", "0 1 2"},
+		{"SELECT `key` FROM Test LIMIT 2 OFFSET 10", "10 11"},
+		{"SELECT `key` FROM Test LIMIT 10, 2", "10 11"},
+		{"SELECT `key` FROM Test LIMIT 0", ""},
+		{"SELECT `key` FROM Test WHERE `key` > 495 LIMIT 10", "496 497 498 499"},
+		{"SELECT `key` FROM Test ORDER BY `key` DESC LIMIT 3", "499 498 497"},
+		{"SELECT `key` FROM Test ORDER BY `key` % 100, `key` LIMIT 3 OFFSET 4", "400 1 101"},
+	}
+	for _, test := range tests {
+		rows, err := exec.QueryRows(db, mustParseSelect(t, test.sql))
+		if err != nil {
+			t.Error(test.sql, err)
+			continue
+		}
+		keys := []string{}
+		for _, row := range rows {
+			keys = append(keys, row[0].String())
+		}
+		if strings.Join(keys, " ") != test.expected {
+			t.Error(test.sql, "returned", keys, "instead of", test.expected)
+		}
+	}
+
+	_, err = exec.Query(db, mustParseSelect(t, "SELECT * FROM Test LIMIT -1"))
+	if err == nil {
+		t.Error("Negative LIMIT was accepted")
+	}
+}
+
+func TestExplainStatement(t *testing.T) {
+	stmt, err := parseDDLStatement("  explain analyze SELECT * FROM Test WHERE `key` = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	explain, ok := stmt.(*ExplainStmt)
+	if !ok || !explain.Analyze || sqlparser.String(explain.Select) != "select * from Test where `key` = 1" {
+		t.Error("Unexpected statement", stmt)
+	}
+	stmt, err = parseDDLStatement("EXPLAIN SELECT 1 FROM Test")
+	if err != nil || stmt.(*ExplainStmt).Analyze {
+		t.Error("Unexpected statement", stmt, err)
+	}
+	for _, sql := range []string{
+		"/* c */ EXPLAIN SELECT * FROM Test WHERE `key` = 1",
+		"EXPLAIN /* c */ ANALYZE -- c\n SELECT * FROM Test WHERE `key` = 1",
+		"/* explain */ explain\t/* analyze */analyze/* c */SELECT * FROM Test WHERE `key` = 1",
+	} {
+		stmt, err = parseDDLStatement(sql)
+		if err != nil {
+			t.Fatal(sql, err)
+		}
+		explain, ok = stmt.(*ExplainStmt)
+		if !ok || sqlparser.String(explain.Select) != "select * from Test where `key` = 1" {
+			t.Error("Unexpected statement", sql, stmt)
+		}
+	}
+	_, err = parseDDLStatement("EXPLAIN DELETE FROM Test")
+	if err == nil {
+		t.Error("DELETE explained")
+	}
+}
+
+// Prints the column names followed by one line per row and the number of rows
+func printResult(out io.Writer, result *exec.Result) error {
+	names := make([]string, len(result.Columns))
+	for i, col := range result.Columns {
+		names[i] = col.Name
+	}
+	fmt.Fprintln(out, strings.Join(names, " | "))
+
+	count := 0
+	for result.Next() {
+		values := make([]string, len(result.Row()))
+		for i, val := range result.Row() {
+			if val == nil {
+				values[i] = "NULL"
+			} else {
+				values[i] = val.String()
+			}
+		}
+		fmt.Fprintln(out, strings.Join(values, " | "))
+		count++
+	}
+	if result.Err() != nil {
+		return result.Err()
+	}
+
+	if count == 1 {
+		fmt.Fprintln(out, "1 row")
+	} else {
+		fmt.Fprintf(out, "%d rows\n", count)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Package engine runs SQL statements against a database file. It keeps the
+// catalog of tables, indexes and statistics, maintains the indexes on
+// modifications and groups statements into transactions.
+package engine
+
+import (
+	"errors"
+	"godb/exec"
+	"godb/table"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// Runs a statement. Queries return their rows, which are read lazily and
+// have to be closed. INSERT and DELETE return the number of rows they
+// changed, other statements -1.
+func (db *Database) Execute(sql string) (*exec.Result, int64, error) {
+	ddlStmt, err := parseDDLStatement(sql)
+	if err != nil {
+		return nil, -1, err
+	}
+	if ddlStmt != nil {
+		var result *exec.Result
+		err = db.inSession(func() error {
+			var err error
+			result, err = db.execDDLStatement(ddlStmt)
+			return err
+		})
+		return result, -1, err
+	}
+
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	switch stmt.(type) {
+	case *sqlparser.Begin:
+		if db.SessionTx != nil {
+			return nil, -1, errors.New("There is already a transaction in progress")
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, -1, err
+		}
+		db.SessionTx = tx
+		return nil, -1, nil
+	case *sqlparser.Commit:
+		if db.SessionTx == nil {
+			return nil, -1, errors.New("There is no transaction in progress")
+		}
+		tx := db.SessionTx
+		db.SessionTx = nil
+		return nil, -1, tx.Commit()
+	case *sqlparser.Rollback:
+		if db.SessionTx == nil {
+			return nil, -1, errors.New("There is no transaction in progress")
+		}
+		tx := db.SessionTx
+		db.SessionTx = nil
+		return nil, -1, tx.Rollback()
+	}
+
+	var result *exec.Result
+	affected := int64(-1)
+	err = db.inSession(func() error {
+		var err error
+		result, affected, err = db.execStatement(stmt)
+		return err
+	})
+	return result, affected, err
+}
+
+// Whether the statement is BEGIN, COMMIT or ROLLBACK
+func IsTransactionStatement(sql string) bool {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return false
+	}
+	switch stmt.(type) {
+	case *sqlparser.Begin, *sqlparser.Commit, *sqlparser.Rollback:
+		return true
+	}
+	return false
+}
+
+// Runs a statement as part of the transaction started by BEGIN, if any
+func (db *Database) inSession(fn func() error) error {
+	if db.SessionTx != nil {
+		return db.SessionTx.run(fn)
+	}
+	return fn()
+}
+
+func (db *Database) execDDLStatement(stmt interface{}) (*exec.Result, error) {
+	switch stmt := stmt.(type) {
+	case *CreateTableStmt:
+		_, err := db.CreateTable(stmt.Name, table.TableSchema{Columns: stmt.Columns})
+		return nil, err
+	case *CreateIndexStmt:
+		tbl, err := db.OpenTable(stmt.Table)
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.CreateIndex(stmt.Name, tbl, stmt.Columns, stmt.Unique)
+		return nil, err
+	case *DropIndexStmt:
+		return nil, db.DropIndex(stmt.Name, stmt.Table)
+	case *AnalyzeStmt:
+		if stmt.Table == "" {
+			return nil, db.AnalyzeAll()
+		}
+		tbl, err := db.OpenTable(stmt.Table)
+		if err != nil {
+			return nil, err
+		}
+		return nil, db.Analyze(tbl)
+	case *ExplainStmt:
+		return exec.Explain(db, stmt.Select, stmt.Analyze)
+	}
+	return nil, nil
+}
+
+func (db *Database) execStatement(stmt sqlparser.Statement) (*exec.Result, int64, error) {
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		result, err := exec.Query(db, stmt)
+		return result, -1, err
+
+	case *sqlparser.Insert:
+		inserted, err := db.execInsert(stmt)
+		return nil, int64(inserted), err
+
+	case *sqlparser.Delete:
+		tableName, err := singleTableName(stmt.TableExprs)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		tbl, err := db.OpenTable(tableName)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		path, filter, err := exec.PlanWhere(db, tbl, stmt.Where)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		var deleted int
+		err = db.atomically(func() error {
+			var err error
+			deleted, err = db.delete(tbl, path, filter)
+			return err
+		})
+		return nil, int64(deleted), err
+	}
+	return nil, -1, errors.New("Unknown statement type")
+}
+
+// The name of the only table in a FROM clause
+func singleTableName(tableExprs sqlparser.TableExprs) (string, error) {
+	if len(tableExprs) != 1 {
+		return "", errors.New("Only one source supported in FROM")
+	}
+	aliasedExpr, ok := tableExprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return "", errors.New("Only tables supported in FROM")
+	}
+	tableName := sqlparser.GetTableName(aliasedExpr.Expr)
+	if tableName.IsEmpty() {
+		return "", errors.New("Only tables supported in FROM")
+	}
+	return tableName.String(), nil
+}
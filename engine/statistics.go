@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"errors"
+	"godb/exec"
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+	"strings"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+func StatisticsToDictionaryEntries(tbl *table.Table, stats *table.Statistics) []table.Row {
+	entries := []table.Row{}
+	for i, col := range stats.Columns {
+		histogram := make([]string, len(col.Histogram))
+		for j, bound := range col.Histogram {
+			histogram[j] = sqlLiteral(bound)
+		}
+		var min, max table.ColumnValue
+		if col.Min != nil {
+			min, max = types.String(sqlLiteral(col.Min)), types.String(sqlLiteral(col.Max))
+		}
+		entries = append(entries, table.Row{
+			types.String(tbl.Name),
+			types.String(tbl.Schema.Columns[i].Name),
+			types.Long(stats.Rows),
+			types.Long(stats.Pages),
+			types.Long(col.Distinct),
+			types.String(strconv.FormatFloat(col.NullFraction, 'f', 4, 64)),
+			min,
+			max,
+			types.String(strings.Join(histogram, ", ")),
+		})
+	}
+	return entries
+}
+
+// Reads the entry of a column into the statistics of its table
+func columnStatisticsFromDictionaryEntry(stats *table.Statistics, colIdx int, entry table.Row) error {
+	stats.Rows = int64(entry[2].(types.Long))
+	stats.Pages = int64(entry[3].(types.Long))
+	col := &stats.Columns[colIdx]
+	col.Distinct = int64(entry[4].(types.Long))
+
+	var err error
+	col.NullFraction, err = strconv.ParseFloat(string(entry[5].(types.String)), 64)
+	if err != nil {
+		return err
+	}
+	if entry[6] != nil {
+		col.Min, err = parseLiteral(string(entry[6].(types.String)))
+		if err != nil {
+			return err
+		}
+		col.Max, err = parseLiteral(string(entry[7].(types.String)))
+		if err != nil {
+			return err
+		}
+	}
+	reader := newTokenReader(string(entry[8].(types.String)))
+	for !reader.atEnd() {
+		bound, err := reader.literal()
+		if err != nil {
+			return err
+		}
+		col.Histogram = append(col.Histogram, bound)
+		reader.accept(',')
+	}
+	return nil
+}
+
+// Formats a value as it would be written in SQL
+func sqlLiteral(value table.ColumnValue) string {
+	if str, ok := value.(types.String); ok {
+		return sqlparser.String(sqlparser.NewStrVal([]byte(str)))
+	}
+	return value.String()
+}
+
+func parseLiteral(sql string) (table.ColumnValue, error) {
+	return newTokenReader(sql).literal()
+}
+
+// Reads the statistics of all analyzed tables from the TableStatistics
+func (db *Database) loadStatistics() error {
+	db.Statistics = make(map[string]*table.Statistics)
+	dict, err := db.OpenTable("TableStatistics")
+	if err != nil {
+		// Databases created before statistics were introduced have none
+		return nil
+	}
+
+	return dict.ForEachRow(func(rowId table.RowId, entry table.Row) (bool, error) {
+		if isCatalogTable(string(entry[0].(types.String))) {
+			// Recorded before catalog tables were excluded, their values can't be read back
+			return true, nil
+		}
+		tbl, err := db.OpenTable(string(entry[0].(types.String)))
+		if err != nil {
+			return false, err
+		}
+		_, colIdx, err := tbl.Schema.FindColumnByName(string(entry[1].(types.String)))
+		if err != nil {
+			return false, err
+		}
+		stats, ok := db.Statistics[tbl.Name]
+		if !ok {
+			stats = &table.Statistics{Columns: make([]table.ColumnStatistics, len(tbl.Schema.Columns))}
+			db.Statistics[tbl.Name] = stats
+		}
+		return true, columnStatisticsFromDictionaryEntry(stats, colIdx, entry)
+	})
+}
+
+// The statistics recorded for a table, nil if it wasn't analyzed
+func (db *Database) TableStatistics(tableName string) *table.Statistics {
+	return db.Statistics[tableName]
+}
+
+// The tables of the catalog, which aren't analyzed
+var CATALOG_TABLES = []string{"TableDictionary", "IndexDictionary", "TableStatistics"}
+
+func isCatalogTable(tableName string) bool {
+	for _, name := range CATALOG_TABLES {
+		if name == tableName {
+			return true
+		}
+	}
+	return false
+}
+
+// Gathers the statistics of a table and replaces those recorded before
+func (db *Database) Analyze(tbl *table.Table) error {
+	if isCatalogTable(tbl.Name) {
+		return errors.New("Analyze failed. Catalog table '" + tbl.Name + "' can't be analyzed")
+	}
+	return db.atomically(func() error {
+		return db.analyze(tbl)
+	})
+}
+
+func (db *Database) analyze(tbl *table.Table) error {
+	stats, err := tbl.Analyze()
+	if err != nil {
+		return err
+	}
+
+	dict, err := db.OpenTable("TableStatistics")
+	if err != nil {
+		dict, err = db.createTable("TableStatistics", STATISTICS_SCHEMA)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = db.delete(dict, exec.AccessPath{}, func(entry table.Row) (bool, error) {
+		return entry[0] == types.String(tbl.Name), nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range StatisticsToDictionaryEntries(tbl, stats) {
+		err = db.insert(dict, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	db.Statistics[tbl.Name] = stats
+	return nil
+}
+
+// Analyzes all tables, except those of the catalog
+func (db *Database) AnalyzeAll() error {
+	return db.atomically(func() error {
+		tableNames := []string{}
+		err := db.TableDictionary.ForEachRow(func(rowId table.RowId, entry table.Row) (bool, error) {
+			tableNames = append(tableNames, string(entry[0].(types.String)))
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, tableName := range tableNames {
+			if isCatalogTable(tableName) {
+				continue
+			}
+			tbl, err := db.OpenTable(tableName)
+			if err != nil {
+				return err
+			}
+			err = db.analyze(tbl)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	db := openTestDatabase(t)
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every fourth value is NULL, the others take 50 distinct values
+	for i := 0; i < 400; i++ {
+		var value table.ColumnValue
+		if i%4 != 0 {
+			value = types.String("it's " + strconv.Itoa(i%50))
+		}
+		err = db.Insert(tbl, table.Row{types.Long(i), value})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.TableStatistics("Test") != nil {
+		t.Error("Statistics before ANALYZE")
+	}
+
+	err = execSQL(db, "ANALYZE Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(stats *table.Statistics) {
+		if stats == nil || stats.Rows != 400 || stats.Pages == 0 || len(stats.Columns) != 2 {
+			t.Fatal("Unexpected statistics", stats)
+		}
+		key, value := stats.Columns[0], stats.Columns[1]
+		if key.Distinct != 400 || key.NullFraction != 0 || key.Min != types.Long(0) || key.Max != types.Long(399) {
+			t.Error("Unexpected statistics of key", key)
+		}
+		if len(key.Histogram) != table.HISTOGRAM_BUCKETS+1 || key.Histogram[5] != types.Long(199) {
+			t.Error("Unexpected histogram of key", key.Histogram)
+		}
+		if value.Distinct != 50 || value.NullFraction != 0.25 || value.Min != types.String("it's 0") {
+			t.Error("Unexpected statistics of value", value)
+		}
+	}
+	check(db.TableStatistics("Test"))
+
+	// The statistics are kept in the catalog
+	db.Close()
+	db, err = OpenDatabase(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		closeTestDatabase(db)
+	}()
+	check(db.TableStatistics("Test"))
+
+	// ANALYZE replaces the recorded statistics
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(tbl, table.Row{types.Long(400), nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execSQL(db, "ANALYZE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := db.TableStatistics("Test"); stats.Rows != 401 || stats.Columns[0].Max != types.Long(400) {
+		t.Error("Statistics weren't replaced", stats)
+	}
+	if db.TableStatistics("IndexDictionary") != nil {
+		t.Error("ANALYZE analyzed a catalog table")
+	}
+	err = execSQL(db, "ANALYZE TableDictionary")
+	if err == nil {
+		t.Error("Catalog table analyzed")
+	}
+
+	// The database can still be opened after analyzing all tables
+	db.Close()
+	db, err = OpenDatabase(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := db.TableStatistics("Test"); stats == nil || stats.Rows != 401 {
+		t.Error("Statistics weren't kept", stats)
+	}
+
+	err = execSQL(db, "ANALYZE Missing")
+	if err == nil {
+		t.Error("Missing table analyzed")
+	}
+}
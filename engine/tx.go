@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"errors"
+	"godb/exec"
+	"godb/table"
+)
+
+// A transaction groups several statements, so that either all of their
+// modifications become visible or none of them do.
+//
+// There can only be a single transaction running per database.
+// Once a statement inside the transaction fails, the transaction is aborted
+// and can only be rolled back.
+type Tx struct {
+	db *Database
+	// The error of the first failed statement, nil while the transaction is healthy
+	failed error
+	// Set once the transaction was committed or rolled back
+	done bool
+}
+
+func (db *Database) Begin() (*Tx, error) {
+	err := db.Pager.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{db: db}, nil
+}
+
+// Runs a statement as part of the transaction
+func (tx *Tx) run(fn func() error) error {
+	if tx.done {
+		return errors.New("Transaction has already been committed or rolled back")
+	}
+	if tx.failed != nil {
+		return errors.New("Transaction aborted, statements are ignored until ROLLBACK")
+	}
+
+	err := fn()
+	if err != nil {
+		tx.failed = err
+	}
+	return err
+}
+
+func (tx *Tx) Insert(tbl *table.Table, row table.Row) error {
+	return tx.run(func() error {
+		return tx.db.insert(tbl, row)
+	})
+}
+
+func (tx *Tx) Update(tbl *table.Table, targetColumn string, targetValue table.ColumnValue, newRow table.Row) error {
+	return tx.run(func() error {
+		return tx.db.update(tbl, targetColumn, targetValue, newRow)
+	})
+}
+
+func (tx *Tx) Delete(tbl *table.Table, predicate table.Predicate) (int, error) {
+	deleted := 0
+	err := tx.run(func() error {
+		var err error
+		deleted, err = tx.db.delete(tbl, exec.AccessPath{}, predicate)
+		return err
+	})
+	return deleted, err
+}
+
+// Returns a cursor over all rows whose column has the given value.
+// The rows are read lazily, errors while reading don't abort the transaction.
+func (tx *Tx) Select(tbl *table.Table, column string, targetValue table.ColumnValue) (*Cursor, error) {
+	var cursor *Cursor
+	err := tx.run(func() error {
+		cursor = tx.db.Select(tbl, column, targetValue)
+		return nil
+	})
+	return cursor, err
+}
+
+func (tx *Tx) SelectOne(tbl *table.Table, column string, targetValue table.ColumnValue) (table.Row, error) {
+	var row table.Row
+	err := tx.run(func() error {
+		var err error
+		row, err = tx.db.SelectOne(tbl, column, targetValue)
+		return err
+	})
+	return row, err
+}
+
+func (tx *Tx) CreateTable(name string, schema table.TableSchema) (*table.Table, error) {
+	var tbl *table.Table
+	err := tx.run(func() error {
+		var err error
+		tbl, err = tx.db.createTable(name, schema)
+		return err
+	})
+	return tbl, err
+}
+
+// Makes all modifications of the transaction durable.
+// An aborted transaction is rolled back instead and the error of the failed
+// statement is returned.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return errors.New("Commit failed. Transaction has already been committed or rolled back")
+	}
+	if tx.failed != nil {
+		err := tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return errors.New("Commit failed. Transaction was rolled back after error: " + tx.failed.Error())
+	}
+
+	tx.done = true
+	err := tx.db.Pager.Commit()
+	if err != nil {
+		tx.db.Pager.Rollback()
+		tx.db.reloadCatalog()
+		return err
+	}
+	return nil
+}
+
+// Discards all modifications of the transaction.
+// Tables opened during the transaction must be opened again afterwards.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return errors.New("Rollback failed. Transaction has already been committed or rolled back")
+	}
+
+	tx.done = true
+	err := tx.db.Pager.Rollback()
+	if err != nil {
+		return err
+	}
+	return tx.db.reloadCatalog()
+}
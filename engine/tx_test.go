@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"godb/pager"
+	"godb/table"
+	"godb/table/types"
+	"os"
+	"testing"
+)
+
+const TEST_FILE = "test.db"
+
+func openTestDatabase(t *testing.T) *Database {
+	types.InitializeTypeIds()
+	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + pager.WAL_SUFFIX)
+	db, err := OpenDatabase(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func closeTestDatabase(db *Database) {
+	db.Close()
+	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + pager.WAL_SUFFIX)
+}
+
+// Runs a statement, discarding the rows of queries
+func execSQL(db *Database, sql string) error {
+	result, _, err := db.Execute(sql)
+	if result != nil {
+		result.Close()
+	}
+	return err
+}
+
+var testSchema = table.TableSchema{
+	Columns: []table.ColumnDef{
+		{Name: "key", Type: types.TypeLong},
+		{Name: "value", Type: types.TypeString},
+	},
+}
+
+func TestTxRollback(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl, err := tx.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Insert(tbl, table.Row{types.Long(1), types.String("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.SelectOne(tbl, "key", types.Long(1))
+	if err != nil {
+		t.Error("Transaction doesn't see its own insert")
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.OpenTable("Test")
+	if err == nil {
+		t.Error("Table created by rolled back transaction still exists")
+	}
+}
+
+func TestTxCommit(t *testing.T) {
+	db := openTestDatabase(t)
+	defer closeTestDatabase(db)
+
+	for _, sql := range []string{"BEGIN", "COMMIT"} {
+		err := execSQL(db, sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl, err := tx.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Insert(tbl, table.Row{types.Long(1), types.String("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := db.SelectOne(tbl, "key", types.Long(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[1] != types.String("one") {
+		t.Error("Committed row not found")
+	}
+}
+
+func TestFailedCommit(t *testing.T) {
+	db := openTestDatabase(t)
+	defer func() {
+		closeTestDatabase(db)
+	}()
+
+	tbl, err := db.CreateTable("Test", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes to the log fail on a read-only handle
+	walFile := db.Pager.Wal.File
+	readOnly, err := os.Open(walFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Pager.Wal.File = readOnly
+	err = db.Insert(tbl, table.Row{types.Long(1), types.String("one")})
+	db.Pager.Wal.File = walFile
+	readOnly.Close()
+	if err == nil {
+		t.Fatal("Commit didn't fail")
+	}
+	if db.Pager.InTransaction() {
+		t.Fatal("Transaction still running after failed commit")
+	}
+
+	// Later statements are committed on their own
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(tbl, table.Row{types.Long(2), types.String("two")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = OpenDatabase(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl, err = db.OpenTable("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.SelectOne(tbl, "key", types.Long(1)); err == nil {
+		t.Error("Row of failed commit found")
+	}
+	if _, err = db.SelectOne(tbl, "key", types.Long(2)); err != nil {
+		t.Error("Row committed after failed commit not found")
+	}
+}
@@ -0,0 +1,262 @@
+package exec
+
+import (
+	"errors"
+	"godb/index"
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// A comparison of a column with a constant, taken from the WHERE clause
+type Predicate struct {
+	Column   string
+	Operator string
+	Value    table.ColumnValue
+}
+
+// The operator to use when the operands of a comparison are swapped
+var flippedOperators = map[string]string{
+	sqlparser.EqualStr:        sqlparser.EqualStr,
+	sqlparser.LessThanStr:     sqlparser.GreaterThanStr,
+	sqlparser.LessEqualStr:    sqlparser.GreaterEqualStr,
+	sqlparser.GreaterThanStr:  sqlparser.LessThanStr,
+	sqlparser.GreaterEqualStr: sqlparser.LessEqualStr,
+}
+
+// How the rows of a table are read
+type AccessPath struct {
+	// nil for a full table scan
+	Index *index.TableIndex
+	// Bounds of the index range scan, nil if open
+	Lower *index.Bound
+	Upper *index.Bound
+}
+
+// Converts a literal into a column value
+func sqlValue(val *sqlparser.SQLVal) (table.ColumnValue, error) {
+	switch val.Type {
+	case sqlparser.StrVal:
+		return types.String(val.Val), nil
+	case sqlparser.IntVal:
+		num, err := strconv.ParseInt(string(val.Val), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return types.Long(num), nil
+	default:
+		return nil, errors.New("Only string and integer values are supported")
+	}
+}
+
+// Extracts the comparisons of a column with a constant from the conjuncts of
+// a WHERE expression, which may be used to choose an index.
+// Other conditions are left to the compiled WHERE expression.
+func ExtractPredicates(expr sqlparser.Expr, schema table.TableSchema) ([]Predicate, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, err := ExtractPredicates(expr.Left, schema)
+		if err != nil {
+			return nil, err
+		}
+		right, err := ExtractPredicates(expr.Right, schema)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	case *sqlparser.ParenExpr:
+		return ExtractPredicates(expr.Expr, schema)
+	case *sqlparser.ComparisonExpr:
+		operator, ok := flippedOperators[expr.Operator]
+		if !ok {
+			return nil, nil
+		}
+
+		colName, isCol := expr.Left.(*sqlparser.ColName)
+		sqlVal, isVal := expr.Right.(*sqlparser.SQLVal)
+		if isCol && isVal {
+			operator = expr.Operator
+		} else {
+			// Constant on the left side
+			colName, isCol = expr.Right.(*sqlparser.ColName)
+			sqlVal, isVal = expr.Left.(*sqlparser.SQLVal)
+			if !isCol || !isVal {
+				return nil, nil
+			}
+		}
+		return columnPredicates(colName, schema, operator, sqlVal)
+	case *sqlparser.RangeCond:
+		// column BETWEEN a AND b is a range on the column
+		colName, isCol := expr.Left.(*sqlparser.ColName)
+		from, isFromVal := expr.From.(*sqlparser.SQLVal)
+		to, isToVal := expr.To.(*sqlparser.SQLVal)
+		if expr.Operator != sqlparser.BetweenStr || !isCol || !isFromVal || !isToVal {
+			return nil, nil
+		}
+		lower, err := columnPredicates(colName, schema, sqlparser.GreaterEqualStr, from)
+		if err != nil {
+			return nil, err
+		}
+		upper, err := columnPredicates(colName, schema, sqlparser.LessEqualStr, to)
+		if err != nil {
+			return nil, err
+		}
+		return append(lower, upper...), nil
+	}
+	return nil, nil
+}
+
+// The predicate comparing a column with a constant.
+// Comparisons between different types are left out, they are rejected when
+// compiling the WHERE expression.
+func columnPredicates(colName *sqlparser.ColName, schema table.TableSchema, operator string, sqlVal *sqlparser.SQLVal) ([]Predicate, error) {
+	column := colName.Name.String()
+	colDef, _, err := schema.FindColumnByName(column)
+	if err != nil {
+		return nil, err
+	}
+	value, err := sqlValue(sqlVal)
+	if err != nil || value.Type() != colDef.Type {
+		return nil, nil
+	}
+	return []Predicate{{Column: column, Operator: operator, Value: value}}, nil
+}
+
+// Plans the rows of a table selected by a WHERE clause, which may be nil.
+// Returns how to read the table and the predicate to filter the rows read.
+func PlanWhere(catalog Catalog, tbl *table.Table, where *sqlparser.Where) (AccessPath, table.Predicate, error) {
+	return planWhere(catalog, tbl, tableScope(tbl, ""), where)
+}
+
+// Plans the rows of a table selected by a WHERE clause, with the columns of
+// the table in the given scope
+func planWhere(catalog Catalog, tbl *table.Table, scope *exprScope, where *sqlparser.Where) (AccessPath, table.Predicate, error) {
+	if where == nil {
+		return AccessPath{}, nil, nil
+	}
+	filter, err := compileWhere(where.Expr, scope)
+	if err != nil {
+		return AccessPath{}, nil, err
+	}
+	preds, err := ExtractPredicates(where.Expr, tbl.Schema)
+	if err != nil {
+		return AccessPath{}, nil, err
+	}
+	return ChooseAccessPath(catalog.TableIndexes(tbl.Name), preds), filter, nil
+}
+
+// Whether the row satisfies all predicates
+func matchesPredicates(tbl *table.Table, row table.Row, preds []Predicate) (bool, error) {
+	for _, pred := range preds {
+		_, colIdx, err := tbl.Schema.FindColumnByName(pred.Column)
+		if err != nil {
+			return false, err
+		}
+		if row[colIdx] == nil {
+			// Comparisons with NULL are never true
+			return false, nil
+		}
+		cmp, err := index.CompareKeys(table.Row{row[colIdx]}, table.Row{pred.Value})
+		if err != nil {
+			return false, err
+		}
+
+		var match bool
+		switch pred.Operator {
+		case sqlparser.EqualStr:
+			match = cmp == 0
+		case sqlparser.LessThanStr:
+			match = cmp < 0
+		case sqlparser.LessEqualStr:
+			match = cmp <= 0
+		case sqlparser.GreaterThanStr:
+			match = cmp > 0
+		case sqlparser.GreaterEqualStr:
+			match = cmp >= 0
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Combines the predicates into a single row predicate
+func PredicateOf(tbl *table.Table, preds []Predicate) table.Predicate {
+	return func(row table.Row) (bool, error) {
+		return matchesPredicates(tbl, row, preds)
+	}
+}
+
+// Chooses the index matching the most predicates.
+// An index can be used for equality predicates on its leading columns and a
+// range predicate on the column following them.
+func ChooseAccessPath(indexes []*index.TableIndex, preds []Predicate) AccessPath {
+	best := AccessPath{}
+	bestScore := 0
+
+	for _, idx := range indexes {
+		path := AccessPath{Index: idx}
+		prefix := table.Row{}
+		score := 0
+
+		for _, column := range idx.Columns {
+			var equal, lower, upper *Predicate
+			for i := range preds {
+				pred := &preds[i]
+				if pred.Column != column {
+					continue
+				}
+				switch pred.Operator {
+				case sqlparser.EqualStr:
+					equal = pred
+				case sqlparser.GreaterThanStr, sqlparser.GreaterEqualStr:
+					lower = pred
+				case sqlparser.LessThanStr, sqlparser.LessEqualStr:
+					upper = pred
+				}
+			}
+
+			if equal != nil {
+				prefix = append(prefix, equal.Value)
+				score += 2
+				continue
+			}
+
+			// A range ends the usable prefix
+			if lower != nil {
+				path.Lower = &index.Bound{
+					Key:       append(append(table.Row{}, prefix...), lower.Value),
+					Inclusive: lower.Operator == sqlparser.GreaterEqualStr,
+				}
+				score++
+			}
+			if upper != nil {
+				path.Upper = &index.Bound{
+					Key:       append(append(table.Row{}, prefix...), upper.Value),
+					Inclusive: upper.Operator == sqlparser.LessEqualStr,
+				}
+				score++
+			}
+			break
+		}
+
+		if len(prefix) > 0 {
+			if path.Lower == nil {
+				path.Lower = &index.Bound{Key: prefix, Inclusive: true}
+			}
+			if path.Upper == nil {
+				path.Upper = &index.Bound{Key: prefix, Inclusive: true}
+			}
+		}
+
+		if score > bestScore {
+			best = path
+			bestScore = score
+		}
+	}
+
+	return best
+}
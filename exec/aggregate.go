@@ -0,0 +1,456 @@
+package exec
+
+// Aggregation groups the input rows by the GROUP BY keys in a hash table.
+// Once the hash table holds HASH_AGGREGATE_MAX_GROUPS groups, rows of further
+// groups are sorted by their keys instead, so the rows of each of these groups
+// follow each other and are aggregated one group at a time.
+// Rows of groups already in the hash table are still aggregated there, so
+// every group is either aggregated in the hash table or from the sorted rows.
+
+import (
+	"errors"
+	"godb/table"
+	"godb/table/types"
+	"strings"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// The number of groups aggregated in memory before the sort-based
+// aggregation is used for further groups
+var HASH_AGGREGATE_MAX_GROUPS = 64 * 1024
+
+// The aggregate functions by their lowercase name
+var aggregateFunctions = map[string]bool{
+	"count": true,
+	"sum":   true,
+	"avg":   true,
+	"min":   true,
+	"max":   true,
+}
+
+// The grouping of a SELECT
+type aggregation struct {
+	groupBy []valueExpr
+	calls   []*aggregateCall
+	// The scope of the group rows, made up of the GROUP BY keys followed by
+	// the results of the aggregate calls
+	scope *exprScope
+}
+
+// An aggregate function called in the select list, HAVING or ORDER BY
+type aggregateCall struct {
+	function string
+	// The argument, nil for COUNT(*)
+	arg      *valueExpr
+	distinct bool
+}
+
+// The aggregation of a group for one aggregate call
+type aggregateState struct {
+	// The number of aggregated values
+	count int64
+	sum   types.Long
+	// The result of MIN and MAX
+	value table.ColumnValue
+	// The encoded values aggregated so far for DISTINCT
+	seen map[string]bool
+}
+
+type aggregateGroup struct {
+	keys   table.Row
+	states []aggregateState
+}
+
+// Compiles the GROUP BY keys and the aggregate calls of a SELECT.
+// Returns nil if the SELECT doesn't aggregate.
+func compileAggregation(stmt *sqlparser.Select, scope *exprScope) (*aggregation, error) {
+	funcExprs := []*sqlparser.FuncExpr{}
+	nodes := []sqlparser.SQLNode{stmt.SelectExprs, stmt.OrderBy}
+	if stmt.Having != nil {
+		nodes = append(nodes, stmt.Having)
+	}
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		funcExpr, ok := node.(*sqlparser.FuncExpr)
+		if ok && aggregateFunctions[funcExpr.Name.Lowered()] {
+			funcExprs = append(funcExprs, funcExpr)
+			// Nested aggregates are rejected when compiling the argument
+			return false, nil
+		}
+		return true, nil
+	}, nodes...)
+
+	if len(funcExprs) == 0 && len(stmt.GroupBy) == 0 && stmt.Having == nil {
+		return nil, nil
+	}
+
+	for _, selectExpr := range stmt.SelectExprs {
+		if _, ok := selectExpr.(*sqlparser.StarExpr); ok {
+			return nil, errors.New("'" + sqlparser.String(selectExpr) + "' can't be used with GROUP BY or aggregates")
+		}
+	}
+
+	aggregation := &aggregation{scope: &exprScope{computed: make(map[string]int)}}
+	for _, expr := range stmt.GroupBy {
+		if val, ok := expr.(*sqlparser.SQLVal); ok && val.Type == sqlparser.IntVal {
+			return nil, errors.New("GROUP BY positions are not supported")
+		}
+		key, err := compileValue(expr, scope)
+		if err != nil {
+			return nil, err
+		}
+		aggregation.scope.computed[sqlparser.String(expr)] = len(aggregation.scope.columns)
+
+		// Grouped columns can still be referenced by name
+		column := scopeColumn{Type: key.Type}
+		if colName, ok := expr.(*sqlparser.ColName); ok {
+			colIdx, _ := scope.resolve(colName)
+			column = scope.columns[colIdx]
+		}
+		aggregation.scope.columns = append(aggregation.scope.columns, column)
+		aggregation.groupBy = append(aggregation.groupBy, key)
+	}
+
+	for _, funcExpr := range funcExprs {
+		sql := sqlparser.String(funcExpr)
+		if _, ok := aggregation.scope.computed[sql]; ok {
+			continue
+		}
+		call, resultType, err := compileAggregateCall(funcExpr, scope)
+		if err != nil {
+			return nil, err
+		}
+		aggregation.scope.computed[sql] = len(aggregation.scope.columns)
+		aggregation.scope.columns = append(aggregation.scope.columns, scopeColumn{Type: resultType})
+		aggregation.calls = append(aggregation.calls, call)
+	}
+	return aggregation, nil
+}
+
+// Groups rows by all of their columns, so each distinct row is returned once
+func distinctAggregation(scope *exprScope) *aggregation {
+	aggregation := &aggregation{scope: scope}
+	for i := range scope.columns {
+		aggregation.groupBy = append(aggregation.groupBy, scope.column(i))
+	}
+	return aggregation
+}
+
+// Compiles an aggregate call, returns the call and the type of its result
+func compileAggregateCall(funcExpr *sqlparser.FuncExpr, scope *exprScope) (*aggregateCall, *table.DataType, error) {
+	call := &aggregateCall{function: funcExpr.Name.Lowered(), distinct: funcExpr.Distinct}
+	name := strings.ToUpper(call.function)
+	if len(funcExpr.Exprs) != 1 {
+		return nil, nil, errors.New(name + " expects one argument")
+	}
+
+	switch argExpr := funcExpr.Exprs[0].(type) {
+	case *sqlparser.StarExpr:
+		if call.function != "count" || funcExpr.Distinct {
+			return nil, nil, errors.New("Only COUNT(*) is supported with *")
+		}
+		return call, types.TypeLong, nil
+	case *sqlparser.AliasedExpr:
+		arg, err := compileValue(argExpr.Expr, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		call.arg = &arg
+	default:
+		return nil, nil, errors.New(name + " argument '" + sqlparser.String(argExpr) + "' is not supported")
+	}
+
+	switch call.function {
+	case "count":
+		return call, types.TypeLong, nil
+	case "sum", "avg":
+		if call.arg.Type != nil && call.arg.Type != types.TypeLong {
+			return nil, nil, errors.New(name + " requires a LONG argument")
+		}
+		return call, types.TypeLong, nil
+	}
+	// MIN and MAX
+	return call, call.arg.Type, nil
+}
+
+// Adds a value to the aggregation of a group
+func (call *aggregateCall) add(state *aggregateState, value table.ColumnValue) error {
+	// NULL values are ignored
+	if value == nil {
+		return nil
+	}
+	if call.distinct {
+		key := string(encodeSortRecord(table.Row{value}))
+		if state.seen[key] {
+			return nil
+		}
+		state.seen[key] = true
+	}
+
+	state.count++
+	switch call.function {
+	case "sum", "avg":
+		sum, err := addLongs(state.sum, value.(types.Long))
+		if err != nil {
+			return err
+		}
+		state.sum = sum
+	case "min", "max":
+		if state.value == nil {
+			state.value = value
+			return nil
+		}
+		cmp, err := compareValues(value, state.value)
+		if err != nil {
+			return err
+		}
+		if (call.function == "min" && cmp < 0) || (call.function == "max" && cmp > 0) {
+			state.value = value
+		}
+	}
+	return nil
+}
+
+// The result of the aggregation.
+// As there is no fractional type, AVG is truncated toward zero.
+func (call *aggregateCall) result(state *aggregateState) table.ColumnValue {
+	switch call.function {
+	case "count":
+		return types.Long(state.count)
+	case "sum":
+		if state.count == 0 {
+			return nil
+		}
+		return state.sum
+	case "avg":
+		if state.count == 0 {
+			return nil
+		}
+		return state.sum / types.Long(state.count)
+	}
+	return state.value
+}
+
+// The GROUP BY keys followed by the arguments of the aggregate calls.
+// COUNT(*) gets a constant argument, as it counts all rows.
+func (aggregation *aggregation) inputRow(row table.Row) (table.Row, error) {
+	inputRow := make(table.Row, 0, len(aggregation.groupBy)+len(aggregation.calls))
+	for _, key := range aggregation.groupBy {
+		value, err := key.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		inputRow = append(inputRow, value)
+	}
+	for _, call := range aggregation.calls {
+		if call.arg == nil {
+			inputRow = append(inputRow, types.Long(1))
+			continue
+		}
+		value, err := call.arg.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		inputRow = append(inputRow, value)
+	}
+	return inputRow, nil
+}
+
+func (aggregation *aggregation) newGroup(keys table.Row) *aggregateGroup {
+	group := &aggregateGroup{keys: keys, states: make([]aggregateState, len(aggregation.calls))}
+	for i, call := range aggregation.calls {
+		if call.distinct {
+			group.states[i].seen = make(map[string]bool)
+		}
+	}
+	return group
+}
+
+// Adds the arguments of an input row to a group
+func (aggregation *aggregation) add(group *aggregateGroup, inputRow table.Row) error {
+	args := inputRow[len(aggregation.groupBy):]
+	for i, call := range aggregation.calls {
+		err := call.add(&group.states[i], args[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The GROUP BY keys followed by the results of the aggregate calls
+func (aggregation *aggregation) groupRow(group *aggregateGroup) table.Row {
+	row := append(table.Row{}, group.keys...)
+	for i, call := range aggregation.calls {
+		row = append(row, call.result(&group.states[i]))
+	}
+	return row
+}
+
+// Groups the rows of its input, returning one row per group in the scope of
+// the aggregation.
+// The input is read completely when the operator is opened.
+type Aggregate struct {
+	estimate
+	tempPages
+	aggregation *aggregation
+	input       Operator
+	// The groups of the hash table in order of appearance and by their
+	// encoded keys
+	groups      []*aggregateGroup
+	groupsByKey map[string]*aggregateGroup
+	// The input rows of the groups which don't fit into the hash table,
+	// nil if all groups fit
+	sorter *rowSorter
+	sorted *sortedRows
+	// The first row of the next group of the sorted rows
+	pending   table.Row
+	nextGroup int
+}
+
+func newAggregate(aggregation *aggregation, input Operator) *Aggregate {
+	return &Aggregate{aggregation: aggregation, input: input}
+}
+
+// Reads all input rows into the groups
+func (aggregate *Aggregate) Open() error {
+	aggregate.groups = nil
+	aggregate.groupsByKey = make(map[string]*aggregateGroup)
+	aggregate.pending = nil
+	aggregate.nextGroup = 0
+
+	err := aggregate.input.Open()
+	if err != nil {
+		return err
+	}
+
+	aggregation := aggregate.aggregation
+	keyCount := len(aggregation.groupBy)
+	for {
+		row, err := aggregate.input.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		inputRow, err := aggregation.inputRow(row)
+		if err != nil {
+			return err
+		}
+
+		key := string(encodeSortRecord(inputRow[:keyCount]))
+		group, ok := aggregate.groupsByKey[key]
+		if !ok && len(aggregate.groups) >= HASH_AGGREGATE_MAX_GROUPS {
+			err = aggregate.addSorted(inputRow)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok {
+			group = aggregation.newGroup(inputRow[:keyCount])
+			aggregate.groupsByKey[key] = group
+			aggregate.groups = append(aggregate.groups, group)
+		}
+		err = aggregation.add(group, inputRow)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Without GROUP BY, there is exactly one group, even without rows
+	if keyCount == 0 && len(aggregate.groups) == 0 {
+		aggregate.groups = append(aggregate.groups, aggregation.newGroup(table.Row{}))
+	}
+
+	if aggregate.sorter != nil {
+		aggregate.sorted, err = aggregate.sorter.Sort()
+		return err
+	}
+	return nil
+}
+
+// Adds an input row to the sort-based aggregation
+func (aggregate *Aggregate) addSorted(inputRow table.Row) error {
+	if aggregate.sorter == nil {
+		rowTypes := []*table.DataType{}
+		for _, key := range aggregate.aggregation.groupBy {
+			rowTypes = append(rowTypes, key.Type)
+		}
+		for _, call := range aggregate.aggregation.calls {
+			if call.arg == nil {
+				rowTypes = append(rowTypes, types.TypeLong)
+			} else {
+				rowTypes = append(rowTypes, call.arg.Type)
+			}
+		}
+		aggregate.sorter = newRowSorter(rowTypes, aggregate.compareKeys, -1, &aggregate.tempStats)
+	}
+	return aggregate.sorter.Add(inputRow)
+}
+
+// Orders input rows by their GROUP BY keys
+func (aggregate *Aggregate) compareKeys(a table.Row, b table.Row) (int, error) {
+	return compareOrderKeys(a, b, make([]orderKey, len(aggregate.aggregation.groupBy)))
+}
+
+func (aggregate *Aggregate) Next() (table.Row, error) {
+	if aggregate.nextGroup < len(aggregate.groups) {
+		group := aggregate.groups[aggregate.nextGroup]
+		aggregate.nextGroup++
+		return aggregate.aggregation.groupRow(group), nil
+	}
+	if aggregate.sorted == nil {
+		return nil, nil
+	}
+	return aggregate.nextSorted()
+}
+
+// Aggregates the next group of the sorted rows
+func (aggregate *Aggregate) nextSorted() (table.Row, error) {
+	aggregation := aggregate.aggregation
+	if aggregate.pending == nil {
+		if !aggregate.sorted.Next() {
+			return nil, aggregate.sorted.Err()
+		}
+		aggregate.pending = aggregate.sorted.Row()
+	}
+
+	group := aggregation.newGroup(aggregate.pending[:len(aggregation.groupBy)])
+	inputRow := aggregate.pending
+	aggregate.pending = nil
+	for {
+		err := aggregation.add(group, inputRow)
+		if err != nil {
+			return nil, err
+		}
+		if !aggregate.sorted.Next() {
+			if aggregate.sorted.Err() != nil {
+				return nil, aggregate.sorted.Err()
+			}
+			break
+		}
+		inputRow = aggregate.sorted.Row()
+		cmp, err := aggregate.compareKeys(group.keys, inputRow)
+		if err != nil {
+			return nil, err
+		}
+		if cmp != 0 {
+			aggregate.pending = inputRow
+			break
+		}
+	}
+	return aggregation.groupRow(group), nil
+}
+
+func (aggregate *Aggregate) Close() {
+	aggregate.input.Close()
+	if aggregate.sorter != nil {
+		aggregate.sorter.Close()
+		aggregate.sorter = nil
+	}
+	aggregate.sorted = nil
+	aggregate.groups = nil
+	aggregate.groupsByKey = nil
+}
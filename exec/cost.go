@@ -0,0 +1,226 @@
+package exec
+
+// Once a table is analyzed, its statistics replace the fixed estimates of the
+// planner: the number of rows is taken from the statistics, scaled by the
+// pages added or removed since, and the share of rows selected by conditions
+// is estimated from the distinct counts, NULL fractions and histograms of the
+// compared columns. Conditions which can't be estimated select
+// FILTER_SELECTIVITY percent of the rows.
+
+import (
+	"godb/index"
+	"godb/table"
+	"godb/table/types"
+	"math"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// The estimated number of rows of a table and the statistics of its
+// columns, nil for each column if the table wasn't analyzed
+func tableEstimate(catalog Catalog, tbl *table.Table, pages int64) (int64, []*table.ColumnStatistics) {
+	rows := pages * rowsPerPage(tbl.Schema)
+	columns := make([]*table.ColumnStatistics, len(tbl.Schema.Columns))
+	stats := catalog.TableStatistics(tbl.Name)
+	if stats == nil || len(stats.Columns) != len(columns) {
+		return rows, columns
+	}
+
+	// The rows of pages added since are assumed to be like the analyzed ones
+	if stats.Pages > 0 {
+		rows = stats.Rows * pages / stats.Pages
+	}
+	for i := range stats.Columns {
+		columns[i] = &stats.Columns[i]
+	}
+	return rows, columns
+}
+
+// Whether statistics are known for any of the columns
+func hasStatistics(columns []*table.ColumnStatistics) bool {
+	for _, col := range columns {
+		if col != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// The number of rows left of the given rows after selecting a share of them
+func estimateRows(rows int64, selectivity float64) int64 {
+	return int64(math.Ceil(float64(rows) * selectivity))
+}
+
+// Estimates the share of rows matching a condition, with the statistics of
+// the columns of the scope
+func selectivity(expr sqlparser.Expr, scope *exprScope, columns []*table.ColumnStatistics) float64 {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		return selectivity(expr.Left, scope, columns) * selectivity(expr.Right, scope, columns)
+	case *sqlparser.OrExpr:
+		left, right := selectivity(expr.Left, scope, columns), selectivity(expr.Right, scope, columns)
+		return left + right - left*right
+	case *sqlparser.NotExpr:
+		return 1 - selectivity(expr.Expr, scope, columns)
+	case *sqlparser.ParenExpr:
+		return selectivity(expr.Expr, scope, columns)
+
+	case *sqlparser.IsExpr:
+		col := columnStatistics(expr.Expr, scope, columns)
+		if col != nil && expr.Operator == sqlparser.IsNullStr {
+			return col.NullFraction
+		}
+		if col != nil && expr.Operator == sqlparser.IsNotNullStr {
+			return 1 - col.NullFraction
+		}
+
+	case *sqlparser.ComparisonExpr:
+		left := columnStatistics(expr.Left, scope, columns)
+		right := columnStatistics(expr.Right, scope, columns)
+		_, leftIsColumn := expr.Left.(*sqlparser.ColName)
+		_, rightIsColumn := expr.Right.(*sqlparser.ColName)
+		if leftIsColumn && rightIsColumn && expr.Operator == sqlparser.EqualStr {
+			// Both sides take any of the distinct values of the side with more
+			if left != nil && right != nil {
+				return (1 - left.NullFraction) * (1 - right.NullFraction) /
+					float64(max64(max64(left.Distinct, right.Distinct), 1))
+			}
+			if left == nil {
+				left = right
+			}
+			if left != nil {
+				return (1 - left.NullFraction) / float64(max64(left.Distinct, 1))
+			}
+			break
+		}
+		operator := expr.Operator
+		value, isVal := expr.Right.(*sqlparser.SQLVal)
+		if left == nil {
+			left, operator = right, flippedOperators[expr.Operator]
+			value, isVal = expr.Left.(*sqlparser.SQLVal)
+		}
+		if left != nil && isVal && operator != "" {
+			constant, err := sqlValue(value)
+			if err == nil {
+				return comparisonSelectivity(left, operator, constant)
+			}
+		}
+
+	case *sqlparser.RangeCond:
+		col := columnStatistics(expr.Left, scope, columns)
+		from, isFromVal := expr.From.(*sqlparser.SQLVal)
+		to, isToVal := expr.To.(*sqlparser.SQLVal)
+		if col == nil || !isFromVal || !isToVal {
+			break
+		}
+		fromValue, fromErr := sqlValue(from)
+		toValue, toErr := sqlValue(to)
+		if fromErr != nil || toErr != nil {
+			break
+		}
+		between := comparisonSelectivity(col, sqlparser.GreaterEqualStr, fromValue) +
+			comparisonSelectivity(col, sqlparser.LessEqualStr, toValue) - (1 - col.NullFraction)
+		between = math.Max(between, 0)
+		if expr.Operator == sqlparser.NotBetweenStr {
+			return 1 - col.NullFraction - between
+		}
+		return between
+	}
+	return FILTER_SELECTIVITY / 100.0
+}
+
+// The statistics of the column an expression refers to, nil if it isn't a
+// column or there are none
+func columnStatistics(expr sqlparser.Expr, scope *exprScope, columns []*table.ColumnStatistics) *table.ColumnStatistics {
+	colName, ok := expr.(*sqlparser.ColName)
+	if !ok {
+		return nil
+	}
+	colIdx, err := scope.resolve(colName)
+	if err != nil || colIdx >= len(columns) {
+		return nil
+	}
+	return columns[colIdx]
+}
+
+// Estimates the share of rows whose column compares to a constant as given
+// by the operator
+func comparisonSelectivity(col *table.ColumnStatistics, operator string, value table.ColumnValue) float64 {
+	if col.Min == nil {
+		// Only NULLs, which match no comparison
+		return 0
+	}
+	if col.Min.Type() != value.Type() {
+		return FILTER_SELECTIVITY / 100.0
+	}
+	nonNull := 1 - col.NullFraction
+	distinct := float64(max64(col.Distinct, 1))
+
+	switch operator {
+	case sqlparser.EqualStr:
+		if below, _ := compareValues(value, col.Min); below < 0 {
+			return 0
+		}
+		if above, _ := compareValues(value, col.Max); above > 0 {
+			return 0
+		}
+		return nonNull / distinct
+	case sqlparser.NotEqualStr:
+		return nonNull * (1 - 1/distinct)
+	case sqlparser.LessThanStr, sqlparser.LessEqualStr:
+		return nonNull * histogramFraction(col.Histogram, value)
+	case sqlparser.GreaterThanStr, sqlparser.GreaterEqualStr:
+		return nonNull * (1 - histogramFraction(col.Histogram, value))
+	}
+	return FILTER_SELECTIVITY / 100.0
+}
+
+// Estimates the share of values smaller than the given one from the bounds
+// of a histogram
+func histogramFraction(histogram []table.ColumnValue, value table.ColumnValue) float64 {
+	if len(histogram) < 2 {
+		return FILTER_SELECTIVITY / 100.0
+	}
+	buckets := len(histogram) - 1
+	for i := 0; i < buckets; i++ {
+		if cmp, _ := compareValues(value, histogram[i+1]); cmp >= 0 {
+			continue
+		}
+		if cmp, _ := compareValues(value, histogram[i]); cmp < 0 {
+			return 0
+		}
+		// Numbers are assumed to be spread evenly within their bucket
+		within := 0.5
+		lower, isLong := histogram[i].(types.Long)
+		upper, _ := histogram[i+1].(types.Long)
+		if isLong && upper > lower {
+			// Subtracted as floats, the bounds may be further apart than an int64 holds
+			within = (float64(value.(types.Long)) - float64(lower)) / (float64(upper) - float64(lower))
+		}
+		return math.Max(0, math.Min(1, (float64(i)+within)/float64(buckets)))
+	}
+	return 1
+}
+
+// Estimates the share of rows of a table read through an index with the
+// predicates on the indexed columns
+func indexSelectivity(tbl *table.Table, idx *index.TableIndex, preds []Predicate, columns []*table.ColumnStatistics) float64 {
+	result := 1.0
+	for _, pred := range preds {
+		_, colIdx, err := tbl.Schema.FindColumnByName(pred.Column)
+		if err != nil || columns[colIdx] == nil || !containsString(idx.Columns, pred.Column) {
+			continue
+		}
+		result *= comparisonSelectivity(columns[colIdx], pred.Operator, pred.Value)
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, other := range values {
+		if other == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+// Package exec plans and executes queries.
+//
+// A SELECT is first translated from the sqlparser AST into a logical plan,
+// which describes what is computed: the tables and joins of FROM, the
+// conditions, the grouping, the result columns, their order and the limit.
+// The physical plan decides how it is computed. It is a tree of operators,
+// each one pulling the rows it needs from its inputs:
+//
+//	SeqScan:   Reads all rows of a table
+//	IndexScan: Reads the rows of a table in a range of an index
+//	Filter:    Selects the rows of its input matching a condition
+//	Project:   Computes new rows from the rows of its input
+//	Sort:      Orders the rows of its input
+//	Limit:     Skips and limits the rows of its input
+//	Join:      Combines the rows of two inputs
+//	Aggregate: Groups the rows of its input and aggregates the groups
+package exec
+
+import (
+	"godb/index"
+	"godb/table"
+)
+
+// A physical operator, producing its rows one at a time.
+//
+//	err := op.Open()
+//	defer op.Close()
+//	for err == nil {
+//		var row table.Row
+//		row, err = op.Next()
+//		if row == nil {
+//			break
+//		}
+//	}
+//
+// Operators may be opened again after they were closed, which starts over.
+type Operator interface {
+	Open() error
+	// Returns the next row, nil once there are no more rows
+	Next() (table.Row, error)
+	Close()
+}
+
+// The tables, indexes and statistics queries are planned with
+type Catalog interface {
+	OpenTable(name string) (*table.Table, error)
+	TableIndexes(tableName string) []*index.TableIndex
+	// nil if the table wasn't analyzed
+	TableStatistics(tableName string) *table.Statistics
+}
@@ -0,0 +1,408 @@
+package exec
+
+import (
+	"errors"
+	"godb/index"
+	"godb/pager"
+	"godb/table"
+	"godb/table/types"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// A catalog of tables created by the tests
+type testCatalog struct {
+	pager      *pager.Pager
+	tables     map[string]*table.Table
+	indexes    map[string][]*index.TableIndex
+	statistics map[string]*table.Statistics
+}
+
+func openTestCatalog(t *testing.T) *testCatalog {
+	types.InitializeTypeIds()
+	p, err := pager.OpenPager(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return &testCatalog{pager: p, tables: make(map[string]*table.Table), indexes: make(map[string][]*index.TableIndex),
+		statistics: make(map[string]*table.Statistics)}
+}
+
+func (catalog *testCatalog) OpenTable(name string) (*table.Table, error) {
+	tbl, ok := catalog.tables[name]
+	if !ok {
+		return nil, errors.New("Table '" + name + "' not found")
+	}
+	return tbl, nil
+}
+
+func (catalog *testCatalog) TableIndexes(tableName string) []*index.TableIndex {
+	return catalog.indexes[tableName]
+}
+
+func (catalog *testCatalog) TableStatistics(tableName string) *table.Statistics {
+	return catalog.statistics[tableName]
+}
+
+// Creates a table with (key LONG, value STRING) rows
+func (catalog *testCatalog) createTable(t *testing.T, name string, rows []table.Row) *table.Table {
+	tbl := &table.Table{
+		Name:            name,
+		Pager:           catalog.pager,
+		FirstPageIdx:    -1,
+		LastPageIdx:     -1,
+		FreeSpaceMapIdx: -1,
+		Schema: table.TableSchema{Columns: []table.ColumnDef{
+			{Name: "key", Type: types.TypeLong},
+			{Name: "value", Type: types.TypeString},
+		}},
+	}
+	catalog.inTx(t, func() error {
+		for _, row := range rows {
+			_, err := tbl.InsertRow(row)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	catalog.tables[name] = tbl
+	return tbl
+}
+
+// Creates an index over the key column of a table
+func (catalog *testCatalog) createIndex(t *testing.T, tbl *table.Table, unique bool) {
+	idx := &index.TableIndex{Name: tbl.Name + "Key", TableName: tbl.Name, Columns: []string{"key"}, Unique: unique}
+	catalog.inTx(t, func() error {
+		var err error
+		idx.Tree, err = index.Create(catalog.pager, []*table.DataType{types.TypeLong})
+		if err != nil {
+			return err
+		}
+		return tbl.ForEachRow(func(rowId table.RowId, row table.Row) (bool, error) {
+			return true, idx.Tree.Insert(table.Row{row[0]}, rowId)
+		})
+	})
+	catalog.indexes[tbl.Name] = append(catalog.indexes[tbl.Name], idx)
+}
+
+// Records the statistics of a table
+func (catalog *testCatalog) analyze(t *testing.T, tbl *table.Table) {
+	stats, err := tbl.Analyze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog.statistics[tbl.Name] = stats
+}
+
+func (catalog *testCatalog) inTx(t *testing.T, fn func() error) {
+	err := catalog.pager.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = catalog.pager.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testRows(count int, value func(i int) string) []table.Row {
+	rows := []table.Row{}
+	for i := 0; i < count; i++ {
+		rows = append(rows, table.Row{types.Long(i), types.String(value(i))})
+	}
+	return rows
+}
+
+func mustQuery(t *testing.T, catalog Catalog, sql string) *Result {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Query(catalog, stmt.(*sqlparser.Select))
+	if err != nil {
+		t.Fatal(sql, err)
+	}
+	return result
+}
+
+// The operators of a plan, outermost first
+func operators(op Operator) []Operator {
+	ops := []Operator{op}
+	for _, input := range op.(explainedOperator).inputs() {
+		ops = append(ops, operators(*input)...)
+	}
+	return ops
+}
+
+func TestOperators(t *testing.T) {
+	catalog := openTestCatalog(t)
+	tbl := catalog.createTable(t, "Test", testRows(500, func(i int) string { return strings.Repeat("v", 20) }))
+
+	// The scan stops on the first page
+	result := mustQuery(t, catalog, "SELECT * FROM Test LIMIT 3")
+	defer result.Close()
+	for result.Next() {
+	}
+	if result.Err() != nil {
+		t.Fatal(result.Err())
+	}
+	var scan *SeqScan
+	for _, op := range operators(result.root) {
+		if op, ok := op.(*SeqScan); ok {
+			scan = op
+		}
+	}
+	if scan == nil || scan.RowId().PageIdx != tbl.FirstPageIdx || tbl.FirstPageIdx == tbl.LastPageIdx {
+		t.Error("Scan didn't stop on the first page")
+	}
+
+	// Only the first rows are kept for ORDER BY with LIMIT
+	result = mustQuery(t, catalog, "SELECT * FROM Test ORDER BY `key` DESC LIMIT 5 OFFSET 2")
+	defer result.Close()
+	rows := 0
+	for result.Next() {
+		rows++
+	}
+	if result.Err() != nil || rows != 5 {
+		t.Fatal("Sorted query returned", rows, "rows", result.Err())
+	}
+	for _, op := range operators(result.root) {
+		if op, ok := op.(*Sort); ok && len(op.sorter.rows) != 7 {
+			t.Error("Sorter kept", len(op.sorter.rows), "rows instead of 7")
+		}
+	}
+}
+
+func TestJoinMethods(t *testing.T) {
+	catalog := openTestCatalog(t)
+	small := catalog.createTable(t, "Small", testRows(3, func(i int) string { return "small" }))
+	large := catalog.createTable(t, "Large", testRows(2000, func(i int) string { return "large" }))
+
+	joinMethod := func(sql string) string {
+		methods := []string{}
+		for _, op := range operators(mustQuery(t, catalog, sql).root) {
+			if join, ok := op.(*Join); ok {
+				methods = append(methods, joinMethodNames[join.method])
+			}
+		}
+		return strings.Join(methods, ", ")
+	}
+	const equiJoin = "SELECT * FROM Small s JOIN Large l ON s.`key` = l.`key`"
+
+	if method := joinMethod(equiJoin); method != "Hash Join" {
+		t.Error("Expected a hash join, got", method)
+	}
+	if method := joinMethod("SELECT * FROM Small s JOIN Large l ON s.`key` < l.`key`"); method != "Nested Loop" {
+		t.Error("Expected a nested loop join, got", method)
+	}
+
+	// Sides which don't fit into memory are merged
+	defer func(budget int) { HASH_JOIN_MEMORY_BUDGET = budget }(HASH_JOIN_MEMORY_BUDGET)
+	result := mustQuery(t, catalog, equiJoin+" ORDER BY l.`key`")
+	defer result.Close()
+	HASH_JOIN_MEMORY_BUDGET = 50
+	count := 0
+	for result.Next() {
+		if result.Row()[0] != types.Long(count) || result.Row()[2] != types.Long(count) {
+			t.Error("Unexpected row", result.Row())
+		}
+		count++
+	}
+	if result.Err() != nil || count != 3 {
+		t.Error("Hash join falling back returned", count, "rows", result.Err())
+	}
+	for _, op := range operators(result.root) {
+		if join, ok := op.(*Join); ok && join.method != mergeJoin {
+			t.Error("Hash join exceeding the budget not merged")
+		}
+	}
+	HASH_JOIN_MEMORY_BUDGET = 0
+	if method := joinMethod(equiJoin); method != "Merge Join" {
+		t.Error("Expected a merge join, got", method)
+	}
+
+	// Indexes of large inner tables are used to look up the matching rows of
+	// few outer rows
+	catalog.createIndex(t, small, true)
+	catalog.createIndex(t, large, false)
+	if method := joinMethod(equiJoin + " WHERE s.`key` = 2"); method != "Index Nested Loop" {
+		t.Error("Expected an index nested loop join, got", method)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	catalog := openTestCatalog(t)
+	catalog.createTable(t, "Small", testRows(3, func(i int) string { return "small" }))
+	catalog.createTable(t, "Large", testRows(2000, func(i int) string { return "large" }))
+
+	explain := func(sql string, analyze bool) []string {
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Explain(catalog, stmt.(*sqlparser.Select), analyze)
+		if err != nil {
+			t.Fatal(sql, err)
+		}
+		defer result.Close()
+		lines := []string{}
+		for result.Next() {
+			lines = append(lines, string(result.Row()[0].(types.String)))
+		}
+		return lines
+	}
+
+	const query = "SELECT l.value FROM Small s JOIN Large l ON s.`key` = l.`key` ORDER BY l.`key` LIMIT 2"
+	lines := explain(query, false)
+	expected := []string{"Project", "-> Limit 2", "  -> Top 2 Sort", "    -> Project", "      -> Hash Join",
+		"        -> Seq Scan on Large", "        -> Seq Scan on Small"}
+	if len(lines) != len(expected) {
+		t.Fatal("Unexpected plan", lines)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix+"  (rows=") || strings.Contains(lines[i], "actual") {
+			t.Error("Unexpected plan line", lines[i], "expected", prefix)
+		}
+	}
+	if !strings.Contains(lines[1], "(rows=2 ") {
+		t.Error("Unexpected estimate", lines[1])
+	}
+
+	lines = explain(query, true)
+	if !strings.Contains(lines[1], "actual rows=2 loops=1") || !strings.Contains(lines[4], "actual rows=3 loops=1") ||
+		!strings.Contains(lines[5], "actual rows=2000 loops=1") {
+		t.Error("Unexpected row counts", lines)
+	}
+	if strings.Contains(lines[5], " pages=0 ") || !strings.Contains(lines[5], "ms)") {
+		t.Error("Pages of the scan not counted", lines[5])
+	}
+
+	// The inner side of a nested loop join is read once per outer row
+	lines = explain("SELECT * FROM Small s JOIN Large l ON s.`key` < l.`key`", true)
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "  -> Seq Scan on Small") ||
+		!strings.Contains(lines[3], "actual rows=6000 loops=3") {
+		t.Error("Unexpected nested loop join", lines)
+	}
+
+	// The pages of the temporary file of a spilling sort are counted
+	pagesOf := func(line string) int {
+		fields := strings.SplitN(line[strings.Index(line, " pages=")+len(" pages="):], " ", 2)
+		pages, err := strconv.Atoi(fields[0])
+		if err != nil {
+			t.Fatal(line, err)
+		}
+		return pages
+	}
+	defer func(budget int) { SORT_MEMORY_BUDGET = budget }(SORT_MEMORY_BUDGET)
+	SORT_MEMORY_BUDGET = 10000
+	lines = explain("SELECT * FROM Large ORDER BY value", true)
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "-> Sort") || pagesOf(lines[1]) <= pagesOf(lines[3]) ||
+		pagesOf(lines[0]) != pagesOf(lines[1]) {
+		t.Error("Temporary file pages not counted", lines)
+	}
+}
+
+func TestCostModel(t *testing.T) {
+	catalog := openTestCatalog(t)
+	large := catalog.createTable(t, "Large", testRows(2000, func(i int) string { return "large" }))
+	other := catalog.createTable(t, "Other", testRows(2000, func(i int) string { return "other" }))
+	small := catalog.createTable(t, "Small", testRows(3, func(i int) string { return "small" }))
+	catalog.createIndex(t, large, false)
+
+	plan := func(sql string) []Operator {
+		return operators(mustQuery(t, catalog, sql).root)
+	}
+	scanOf := func(ops []Operator) string {
+		for _, op := range ops {
+			switch op.(type) {
+			case *SeqScan, *IndexScan:
+				return op.(explainedOperator).describe()
+			}
+		}
+		return ""
+	}
+
+	// Without statistics any usable index is used
+	const wide = "SELECT * FROM Large WHERE `key` > 10"
+	if scan := scanOf(plan(wide)); scan != "Index Scan on Large using LargeKey" {
+		t.Error("Expected an index scan, got", scan)
+	}
+
+	// Partially sampled statistics estimate the whole table
+	defer func(pages int64) { table.STATISTICS_SAMPLE_PAGES = pages }(table.STATISTICS_SAMPLE_PAGES)
+	table.STATISTICS_SAMPLE_PAGES = 5
+	catalog.analyze(t, large)
+	stats := catalog.statistics["Large"]
+	if stats.Rows < 1500 || stats.Rows > 2500 || stats.Columns[0].Distinct < 1000 {
+		t.Error("Unexpected estimates", stats.Rows, stats.Columns[0].Distinct)
+	}
+	table.STATISTICS_SAMPLE_PAGES = 300
+	catalog.analyze(t, large)
+	catalog.analyze(t, other)
+	catalog.analyze(t, small)
+
+	// Reading most rows through the index costs more than reading all pages
+	if scan := scanOf(plan(wide)); scan != "Seq Scan on Large" {
+		t.Error("Expected a sequential scan, got", scan)
+	}
+	ops := plan("SELECT * FROM Large WHERE `key` < 10")
+	if scan := scanOf(ops); scan != "Index Scan on Large using LargeKey" {
+		t.Error("Expected an index scan, got", scan)
+	}
+	if rows := estimateOf(ops[len(ops)-1]).rows; rows < 8 || rows > 12 {
+		t.Error("Estimated", rows, "rows instead of 10")
+	}
+
+	// The join of the small table matches few rows
+	ops = plan("SELECT * FROM Small s JOIN Other o ON s.`key` = o.`key`")
+	if rows := estimateOf(ops[1]).rows; rows != 3 {
+		t.Error("Estimated", rows, "joined rows instead of 3")
+	}
+
+	// The small table is joined first, though it comes last in FROM
+	const threeWay = "SELECT * FROM Large l JOIN Other o ON l.`key` = o.`key` JOIN Small s ON o.`key` = s.`key`"
+	ops = plan(threeWay)
+	var firstJoin *Join
+	for _, op := range ops {
+		if join, ok := op.(*Join); ok {
+			firstJoin = join
+		}
+	}
+	if firstJoin == nil || scanOf(operators(firstJoin.outer)) != "Seq Scan on Small" &&
+		scanOf(operators(firstJoin.inner)) != "Seq Scan on Small" {
+		t.Error("Small wasn't joined first")
+	}
+	result := mustQuery(t, catalog, threeWay)
+	defer result.Close()
+	rows := 0
+	for result.Next() {
+		row := result.Row()
+		if len(row) != 6 || row[1] != types.String("large") || row[3] != types.String("other") ||
+			row[5] != types.String("small") {
+			t.Error("Unexpected row", row)
+		}
+		rows++
+	}
+	if result.Err() != nil || rows != 3 {
+		t.Error("Join returned", rows, "rows", result.Err())
+	}
+
+	// Buckets spanning more than an int64 holds don't wrap around
+	histogram := []table.ColumnValue{types.Long(-9e18), types.Long(9e18)}
+	for value, expected := range map[types.Long]float64{-9e18: 0, 0: 0.5, 9e18 - 1: 1} {
+		if fraction := histogramFraction(histogram, value); math.Abs(fraction-expected) > 0.001 {
+			t.Error("Fraction of", value, "is", fraction, "instead of", expected)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package exec
+
+// EXPLAIN describes the operators of a plan, one line each, with the estimates
+// of the planner:
+//
+//	rows: The number of rows returned by the operator
+//	cost: The number of pages read by the operator and its inputs
+//
+// EXPLAIN ANALYZE runs the query and adds what each operator actually did:
+// the rows it returned, how often it was opened, the pages it and its inputs
+// fetched from the pager, how many of these were cache hits and misses, and
+// the time spent in it and its inputs. The pages include those read from and
+// written to temporary files, always counted as misses.
+
+import (
+	"godb/pager"
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// The estimates of the planner for an operator
+type estimate struct {
+	rows int64
+	cost int64
+}
+
+func (est *estimate) estimates() *estimate {
+	return est
+}
+
+// The operators planned for queries, which can be described by EXPLAIN
+type explainedOperator interface {
+	Operator
+	estimates() *estimate
+	// The name of the operator and what it operates on
+	describe() string
+	// The fields holding the inputs, so they can be wrapped for EXPLAIN ANALYZE
+	inputs() []*Operator
+}
+
+// The operators which spill rows to temporary files
+type spillingOperator interface {
+	temporaryPages() *pager.Stats
+}
+
+func estimateOf(op Operator) *estimate {
+	return op.(explainedOperator).estimates()
+}
+
+func (scan *SeqScan) describe() string {
+	return "Seq Scan on " + scan.tbl.Name
+}
+
+func (scan *SeqScan) inputs() []*Operator {
+	return nil
+}
+
+func (scan *IndexScan) describe() string {
+	return "Index Scan on " + scan.tbl.Name + " using " + scan.index.Name
+}
+
+func (scan *IndexScan) inputs() []*Operator {
+	return nil
+}
+
+func (filter *Filter) describe() string {
+	return "Filter"
+}
+
+func (filter *Filter) inputs() []*Operator {
+	return []*Operator{&filter.input}
+}
+
+func (project *Project) describe() string {
+	return "Project"
+}
+
+func (project *Project) inputs() []*Operator {
+	return []*Operator{&project.input}
+}
+
+func (sortOp *Sort) describe() string {
+	if sortOp.limit >= 0 {
+		return "Top " + strconv.Itoa(sortOp.limit) + " Sort"
+	}
+	return "Sort"
+}
+
+func (sortOp *Sort) inputs() []*Operator {
+	return []*Operator{&sortOp.input}
+}
+
+func (limiter *Limit) describe() string {
+	description := "Limit"
+	if limiter.limit >= 0 {
+		description += " " + strconv.Itoa(limiter.limit)
+	}
+	if limiter.offset > 0 {
+		description += " Offset " + strconv.Itoa(limiter.offset)
+	}
+	return description
+}
+
+func (limiter *Limit) inputs() []*Operator {
+	return []*Operator{&limiter.input}
+}
+
+func (join *Join) describe() string {
+	if join.keepUnmatched {
+		return "Left " + joinMethodNames[join.method]
+	}
+	return joinMethodNames[join.method]
+}
+
+func (join *Join) inputs() []*Operator {
+	return []*Operator{&join.outer, &join.inner}
+}
+
+func (aggregate *Aggregate) describe() string {
+	return "Aggregate"
+}
+
+func (aggregate *Aggregate) inputs() []*Operator {
+	return []*Operator{&aggregate.input}
+}
+
+// Measures an operator for EXPLAIN ANALYZE. The measurements include the
+// work done by its inputs.
+type analyzedOperator struct {
+	op Operator
+	// The counters of the pager the tables are read from
+	pagerStats *pager.Stats
+	// The temporary file counters of the operator and its inputs
+	tempStats []*pager.Stats
+	rows      int64
+	loops     int64
+	pages     pager.Stats
+	time      time.Duration
+}
+
+// Wraps an operator and all its inputs to measure them
+func instrument(op Operator, pagerStats *pager.Stats) *analyzedOperator {
+	analyzed := &analyzedOperator{op: op, pagerStats: pagerStats}
+	for _, input := range op.(explainedOperator).inputs() {
+		analyzedInput := instrument(*input, pagerStats)
+		analyzed.tempStats = append(analyzed.tempStats, analyzedInput.tempStats...)
+		*input = analyzedInput
+	}
+	if spilling, ok := op.(spillingOperator); ok {
+		analyzed.tempStats = append(analyzed.tempStats, spilling.temporaryPages())
+	}
+	return analyzed
+}
+
+// The pages fetched so far by the operators sharing the counters
+func (analyzed *analyzedOperator) totalPages() pager.Stats {
+	total := *analyzed.pagerStats
+	for _, stats := range analyzed.tempStats {
+		total.Fetches += stats.Fetches
+		total.CacheHits += stats.CacheHits
+		total.CacheMisses += stats.CacheMisses
+	}
+	return total
+}
+
+func (analyzed *analyzedOperator) measure(fn func()) {
+	start, before := time.Now(), analyzed.totalPages()
+	fn()
+	analyzed.time += time.Since(start)
+	after := analyzed.totalPages()
+	analyzed.pages.Fetches += after.Fetches - before.Fetches
+	analyzed.pages.CacheHits += after.CacheHits - before.CacheHits
+	analyzed.pages.CacheMisses += after.CacheMisses - before.CacheMisses
+}
+
+func (analyzed *analyzedOperator) Open() error {
+	var err error
+	analyzed.measure(func() { err = analyzed.op.Open() })
+	analyzed.loops++
+	return err
+}
+
+func (analyzed *analyzedOperator) Next() (table.Row, error) {
+	var row table.Row
+	var err error
+	analyzed.measure(func() { row, err = analyzed.op.Next() })
+	if row != nil {
+		analyzed.rows++
+	}
+	return row, err
+}
+
+func (analyzed *analyzedOperator) Close() {
+	analyzed.measure(analyzed.op.Close)
+}
+
+// Plans a SELECT and describes its operators. With analyze, the query is run
+// to measure them.
+// The result has a single column with one line per operator, inputs
+// following the operator they belong to.
+func Explain(catalog Catalog, stmt *sqlparser.Select, analyze bool) (*Result, error) {
+	node, _, err := buildLogical(catalog, stmt)
+	if err != nil {
+		return nil, err
+	}
+	root, err := planPhysical(catalog, node)
+	if err != nil {
+		return nil, err
+	}
+
+	if analyze {
+		pagerStats := &pager.Stats{}
+		if p := tablePager(root); p != nil {
+			pagerStats = &p.Stats
+		}
+		root = instrument(root, pagerStats)
+		err = runOperator(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows := []table.Row{}
+	for _, line := range explainLines(root, 0) {
+		rows = append(rows, table.Row{types.String(line)})
+	}
+	return &Result{Columns: []table.ColumnDef{{Name: "QUERY PLAN", Type: types.TypeString}}, root: &rowList{rows: rows}}, nil
+}
+
+// The pager of the first table read by the operators, nil if there is none
+func tablePager(op Operator) *pager.Pager {
+	switch op := op.(type) {
+	case *SeqScan:
+		return op.tbl.Pager
+	case *IndexScan:
+		return op.tbl.Pager
+	}
+	for _, input := range op.(explainedOperator).inputs() {
+		if p := tablePager(*input); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// Reads all rows of an operator
+func runOperator(op Operator) error {
+	err := op.Open()
+	defer op.Close()
+	for err == nil {
+		var row table.Row
+		row, err = op.Next()
+		if row == nil {
+			break
+		}
+	}
+	return err
+}
+
+// Describes an operator and its inputs, indented by their depth in the plan
+func explainLines(op Operator, depth int) []string {
+	analyzed, isAnalyzed := op.(*analyzedOperator)
+	if isAnalyzed {
+		op = analyzed.op
+	}
+	explained := op.(explainedOperator)
+
+	line := explained.describe()
+	if depth > 0 {
+		line = strings.Repeat("  ", depth-1) + "-> " + line
+	}
+	est := explained.estimates()
+	line += "  (rows=" + strconv.FormatInt(est.rows, 10) + " cost=" + strconv.FormatInt(est.cost, 10) + ")"
+	if isAnalyzed {
+		line += " (actual rows=" + strconv.FormatInt(analyzed.rows, 10) +
+			" loops=" + strconv.FormatInt(analyzed.loops, 10) +
+			" pages=" + strconv.FormatInt(analyzed.pages.Fetches, 10) +
+			" hits=" + strconv.FormatInt(analyzed.pages.CacheHits, 10) +
+			" misses=" + strconv.FormatInt(analyzed.pages.CacheMisses, 10) +
+			" time=" + strconv.FormatFloat(float64(analyzed.time.Microseconds())/1000, 'f', 3, 64) + "ms)"
+	}
+
+	lines := []string{line}
+	for _, input := range explained.inputs() {
+		lines = append(lines, explainLines(*input, depth+1)...)
+	}
+	return lines
+}
@@ -0,0 +1,563 @@
+package exec
+
+// Expressions of WHERE clauses and select lists are compiled into closures
+// over table rows.
+// Compiling resolves column references against the scope of the rows and checks
+// the types of all operands, so evaluating only fails on errors that depend
+// on the data, like a division by zero.
+//
+// Conditions use three-valued logic: a comparison involving NULL is neither
+// true nor false but unknown. Only rows for which the condition is true are
+// selected.
+
+import (
+	"errors"
+	"godb/table"
+	"godb/table/types"
+	"math"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+type truth int8
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+func (t truth) not() truth {
+	switch t {
+	case truthTrue:
+		return truthFalse
+	case truthFalse:
+		return truthTrue
+	}
+	return truthUnknown
+}
+
+// An expression producing a value
+type valueExpr struct {
+	// The type of the produced values, nil if the expression is always NULL
+	Type *table.DataType
+	// Returns nil for NULL
+	eval func(table.Row) (table.ColumnValue, error)
+}
+
+// An expression producing a truth value
+type condExpr func(table.Row) (truth, error)
+
+// Compiles a WHERE expression into a predicate selecting the rows for which
+// it is true
+func compileWhere(expr sqlparser.Expr, scope *exprScope) (table.Predicate, error) {
+	cond, err := compileCondition(expr, scope)
+	if err != nil {
+		return nil, err
+	}
+	return func(row table.Row) (bool, error) {
+		t, err := cond(row)
+		return t == truthTrue, err
+	}, nil
+}
+
+func compileCondition(expr sqlparser.Expr, scope *exprScope) (condExpr, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.ParenExpr:
+		return compileCondition(expr.Expr, scope)
+	case sqlparser.BoolVal:
+		return func(table.Row) (truth, error) { return truthOf(bool(expr)), nil }, nil
+	case *sqlparser.AndExpr:
+		return compileLogical(expr.Left, expr.Right, truthFalse, scope)
+	case *sqlparser.OrExpr:
+		return compileLogical(expr.Left, expr.Right, truthTrue, scope)
+	case *sqlparser.NotExpr:
+		cond, err := compileCondition(expr.Expr, scope)
+		if err != nil {
+			return nil, err
+		}
+		return func(row table.Row) (truth, error) {
+			t, err := cond(row)
+			return t.not(), err
+		}, nil
+	case *sqlparser.ComparisonExpr:
+		return compileComparison(expr, scope)
+	case *sqlparser.RangeCond:
+		return compileBetween(expr, scope)
+	case *sqlparser.IsExpr:
+		return compileIs(expr, scope)
+	}
+	return nil, errors.New("Expression '" + sqlparser.String(expr) + "' is not a condition")
+}
+
+// Compiles AND and OR.
+// The decisive truth value short circuits the evaluation, false for AND and
+// true for OR.
+func compileLogical(leftExpr sqlparser.Expr, rightExpr sqlparser.Expr, decisive truth, scope *exprScope) (condExpr, error) {
+	left, err := compileCondition(leftExpr, scope)
+	if err != nil {
+		return nil, err
+	}
+	right, err := compileCondition(rightExpr, scope)
+	if err != nil {
+		return nil, err
+	}
+	return func(row table.Row) (truth, error) {
+		l, err := left(row)
+		if err != nil || l == decisive {
+			return l, err
+		}
+		r, err := right(row)
+		if err != nil || r == decisive {
+			return r, err
+		}
+		if l == truthUnknown || r == truthUnknown {
+			return truthUnknown, nil
+		}
+		return l, nil
+	}, nil
+}
+
+func compileComparison(expr *sqlparser.ComparisonExpr, scope *exprScope) (condExpr, error) {
+	switch expr.Operator {
+	case sqlparser.InStr, sqlparser.NotInStr:
+		return compileIn(expr, scope)
+	case sqlparser.LikeStr, sqlparser.NotLikeStr:
+		return compileLike(expr, scope)
+	}
+
+	test, ok := comparisonTests[expr.Operator]
+	if !ok {
+		return nil, errors.New("Operator '" + expr.Operator + "' is not supported")
+	}
+
+	left, right, err := compileOperands(expr.Left, expr.Right, scope)
+	if err != nil {
+		return nil, err
+	}
+	return func(row table.Row) (truth, error) {
+		l, err := left.eval(row)
+		if err != nil {
+			return truthUnknown, err
+		}
+		r, err := right.eval(row)
+		if err != nil || l == nil || r == nil {
+			return truthUnknown, err
+		}
+		cmp, err := compareValues(l, r)
+		if err != nil {
+			return truthUnknown, err
+		}
+		return truthOf(test(cmp)), nil
+	}, nil
+}
+
+// Decide a comparison given the order of its operands
+var comparisonTests = map[string]func(int) bool{
+	sqlparser.EqualStr:        func(cmp int) bool { return cmp == 0 },
+	sqlparser.NotEqualStr:     func(cmp int) bool { return cmp != 0 },
+	sqlparser.LessThanStr:     func(cmp int) bool { return cmp < 0 },
+	sqlparser.LessEqualStr:    func(cmp int) bool { return cmp <= 0 },
+	sqlparser.GreaterThanStr:  func(cmp int) bool { return cmp > 0 },
+	sqlparser.GreaterEqualStr: func(cmp int) bool { return cmp >= 0 },
+}
+
+// Compiles two values which are compared with each other
+func compileOperands(leftExpr sqlparser.Expr, rightExpr sqlparser.Expr, scope *exprScope) (valueExpr, valueExpr, error) {
+	left, err := compileValue(leftExpr, scope)
+	if err != nil {
+		return left, valueExpr{}, err
+	}
+	right, err := compileValue(rightExpr, scope)
+	if err != nil {
+		return left, right, err
+	}
+	if left.Type != nil && right.Type != nil && left.Type != right.Type {
+		return left, right, errors.New("Can't compare " + left.Type.Name + " with " + right.Type.Name +
+			" in '" + sqlparser.String(leftExpr) + "' and '" + sqlparser.String(rightExpr) + "'")
+	}
+	return left, right, nil
+}
+
+// Orders two non-NULL values of the same type.
+// Returns a negative number if a < b, 0 if equal and a positive one if a > b.
+func compareValues(a table.ColumnValue, b table.ColumnValue) (int, error) {
+	// ColumnValue.Compare returns the order of the argument relative to the receiver
+	return b.Compare(a)
+}
+
+func compileIn(expr *sqlparser.ComparisonExpr, scope *exprScope) (condExpr, error) {
+	tuple, ok := expr.Right.(sqlparser.ValTuple)
+	if !ok {
+		return nil, errors.New("Only lists of values are supported in IN")
+	}
+
+	var left valueExpr
+	candidates := make([]valueExpr, len(tuple))
+	for i, candidateExpr := range tuple {
+		var err error
+		left, candidates[i], err = compileOperands(expr.Left, candidateExpr, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cond := func(row table.Row) (truth, error) {
+		l, err := left.eval(row)
+		if err != nil || l == nil {
+			return truthUnknown, err
+		}
+		// Not finding the value among NULLs is unknown rather than false
+		result := truthFalse
+		for _, candidate := range candidates {
+			r, err := candidate.eval(row)
+			if err != nil {
+				return truthUnknown, err
+			}
+			if r == nil {
+				result = truthUnknown
+				continue
+			}
+			cmp, err := compareValues(l, r)
+			if err != nil {
+				return truthUnknown, err
+			}
+			if cmp == 0 {
+				return truthTrue, nil
+			}
+		}
+		return result, nil
+	}
+	if expr.Operator == sqlparser.NotInStr {
+		return negate(cond), nil
+	}
+	return cond, nil
+}
+
+func compileLike(expr *sqlparser.ComparisonExpr, scope *exprScope) (condExpr, error) {
+	value, pattern, err := compileOperands(expr.Left, expr.Right, scope)
+	if err != nil {
+		return nil, err
+	}
+	if (value.Type != nil && value.Type != types.TypeString) || (pattern.Type != nil && pattern.Type != types.TypeString) {
+		return nil, errors.New("LIKE is only supported for STRING values")
+	}
+
+	escape := rune(0)
+	if expr.Escape != nil {
+		escapeVal, ok := expr.Escape.(*sqlparser.SQLVal)
+		if !ok || escapeVal.Type != sqlparser.StrVal || len([]rune(string(escapeVal.Val))) != 1 {
+			return nil, errors.New("The LIKE escape must be a single character")
+		}
+		escape = []rune(string(escapeVal.Val))[0]
+	}
+
+	cond := func(row table.Row) (truth, error) {
+		v, err := value.eval(row)
+		if err != nil {
+			return truthUnknown, err
+		}
+		p, err := pattern.eval(row)
+		if err != nil || v == nil || p == nil {
+			return truthUnknown, err
+		}
+		return truthOf(likeMatch(string(v.(types.String)), string(p.(types.String)), escape)), nil
+	}
+	if expr.Operator == sqlparser.NotLikeStr {
+		return negate(cond), nil
+	}
+	return cond, nil
+}
+
+// Matches a value against a LIKE pattern, where % matches any number of
+// characters and _ exactly one.
+// A character following the escape character is matched literally.
+func likeMatch(value string, pattern string, escape rune) bool {
+	const (
+		literal = iota
+		anyOne
+		anyMany
+	)
+	type token struct {
+		kind int
+		char rune
+	}
+
+	tokens := []token{}
+	patternRunes := []rune(pattern)
+	for i := 0; i < len(patternRunes); i++ {
+		char := patternRunes[i]
+		switch {
+		case escape != 0 && char == escape && i+1 < len(patternRunes):
+			i++
+			tokens = append(tokens, token{kind: literal, char: patternRunes[i]})
+		case char == '%':
+			tokens = append(tokens, token{kind: anyMany})
+		case char == '_':
+			tokens = append(tokens, token{kind: anyOne})
+		default:
+			tokens = append(tokens, token{kind: literal, char: char})
+		}
+	}
+
+	// Greedy matching, backtracking to the last % on a mismatch
+	runes := []rune(value)
+	v, t := 0, 0
+	lastMany, lastManyV := -1, 0
+	for v < len(runes) {
+		switch {
+		case t < len(tokens) && tokens[t].kind == anyMany:
+			lastMany, lastManyV = t, v
+			t++
+		case t < len(tokens) && (tokens[t].kind == anyOne || tokens[t].char == runes[v]):
+			v++
+			t++
+		case lastMany >= 0:
+			// Let the last % match one more character
+			lastManyV++
+			v, t = lastManyV, lastMany+1
+		default:
+			return false
+		}
+	}
+	for t < len(tokens) && tokens[t].kind == anyMany {
+		t++
+	}
+	return t == len(tokens)
+}
+
+func compileBetween(expr *sqlparser.RangeCond, scope *exprScope) (condExpr, error) {
+	value, from, err := compileOperands(expr.Left, expr.From, scope)
+	if err != nil {
+		return nil, err
+	}
+	_, to, err := compileOperands(expr.Left, expr.To, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// value BETWEEN from AND to is value >= from AND value <= to
+	bound := func(row table.Row, boundExpr valueExpr, test func(int) bool) (truth, error) {
+		v, err := value.eval(row)
+		if err != nil {
+			return truthUnknown, err
+		}
+		b, err := boundExpr.eval(row)
+		if err != nil || v == nil || b == nil {
+			return truthUnknown, err
+		}
+		cmp, err := compareValues(v, b)
+		if err != nil {
+			return truthUnknown, err
+		}
+		return truthOf(test(cmp)), nil
+	}
+	cond := func(row table.Row) (truth, error) {
+		lower, err := bound(row, from, comparisonTests[sqlparser.GreaterEqualStr])
+		if err != nil || lower == truthFalse {
+			return lower, err
+		}
+		upper, err := bound(row, to, comparisonTests[sqlparser.LessEqualStr])
+		if err != nil || upper == truthFalse {
+			return upper, err
+		}
+		if lower == truthUnknown || upper == truthUnknown {
+			return truthUnknown, nil
+		}
+		return truthTrue, nil
+	}
+	if expr.Operator == sqlparser.NotBetweenStr {
+		return negate(cond), nil
+	}
+	return cond, nil
+}
+
+func compileIs(expr *sqlparser.IsExpr, scope *exprScope) (condExpr, error) {
+	if expr.Operator != sqlparser.IsNullStr && expr.Operator != sqlparser.IsNotNullStr {
+		return nil, errors.New("Operator '" + expr.Operator + "' is not supported")
+	}
+	value, err := compileValue(expr.Expr, scope)
+	if err != nil {
+		return nil, err
+	}
+	isNull := expr.Operator == sqlparser.IsNullStr
+	return func(row table.Row) (truth, error) {
+		v, err := value.eval(row)
+		if err != nil {
+			return truthUnknown, err
+		}
+		// IS NULL is never unknown
+		return truthOf((v == nil) == isNull), nil
+	}, nil
+}
+
+func negate(cond condExpr) condExpr {
+	return func(row table.Row) (truth, error) {
+		t, err := cond(row)
+		return t.not(), err
+	}
+}
+
+func compileValue(expr sqlparser.Expr, scope *exprScope) (valueExpr, error) {
+	if colIdx, ok := scope.computed[sqlparser.String(expr)]; ok {
+		return scope.column(colIdx), nil
+	}
+
+	switch expr := expr.(type) {
+	case *sqlparser.ParenExpr:
+		return compileValue(expr.Expr, scope)
+	case *sqlparser.ColName:
+		colIdx, err := scope.resolve(expr)
+		if err != nil {
+			return valueExpr{}, err
+		}
+		return scope.column(colIdx), nil
+	case *sqlparser.SQLVal:
+		value, err := sqlValue(expr)
+		if err != nil {
+			return valueExpr{}, err
+		}
+		return valueExpr{
+			Type: value.Type(),
+			eval: func(table.Row) (table.ColumnValue, error) { return value, nil },
+		}, nil
+	case *sqlparser.NullVal:
+		return valueExpr{eval: func(table.Row) (table.ColumnValue, error) { return nil, nil }}, nil
+	case *sqlparser.UnaryExpr:
+		return compileUnary(expr, scope)
+	case *sqlparser.BinaryExpr:
+		return compileArithmetic(expr, scope)
+	case *sqlparser.FuncExpr:
+		return compileFunction(expr, scope)
+	case *sqlparser.OrExpr:
+		return compileConcat(expr, scope)
+	}
+	return valueExpr{}, errors.New("Expression '" + sqlparser.String(expr) + "' is not supported")
+}
+
+func compileUnary(expr *sqlparser.UnaryExpr, scope *exprScope) (valueExpr, error) {
+	operand, err := compileValue(expr.Expr, scope)
+	if err != nil {
+		return operand, err
+	}
+	if operand.Type != nil && operand.Type != types.TypeLong {
+		return operand, errors.New("Operator '" + expr.Operator + "' requires a LONG operand")
+	}
+
+	switch expr.Operator {
+	case sqlparser.UPlusStr:
+		return operand, nil
+	case sqlparser.UMinusStr:
+		return valueExpr{
+			Type: types.TypeLong,
+			eval: func(row table.Row) (table.ColumnValue, error) {
+				v, err := operand.eval(row)
+				if err != nil || v == nil {
+					return nil, err
+				}
+				return negateLong(v.(types.Long))
+			},
+		}, nil
+	}
+	return operand, errors.New("Operator '" + expr.Operator + "' is not supported")
+}
+
+var arithmeticOperators = map[string]func(a types.Long, b types.Long) (types.Long, error){
+	sqlparser.PlusStr: addLongs,
+	sqlparser.MinusStr: func(a types.Long, b types.Long) (types.Long, error) {
+		diff := a - b
+		if (b > 0 && diff > a) || (b < 0 && diff < a) {
+			return 0, errLongOutOfRange()
+		}
+		return diff, nil
+	},
+	sqlparser.MultStr: func(a types.Long, b types.Long) (types.Long, error) {
+		if a == 0 || b == 0 {
+			return 0, nil
+		}
+		product := a * b
+		if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return 0, errLongOutOfRange()
+		}
+		return product, nil
+	},
+	sqlparser.DivStr:    divideLongs,
+	sqlparser.IntDivStr: divideLongs,
+	sqlparser.ModStr: func(a types.Long, b types.Long) (types.Long, error) {
+		if b == 0 {
+			return 0, errors.New("Division by zero")
+		}
+		return a % b, nil
+	},
+}
+
+func errLongOutOfRange() error {
+	return errors.New("LONG value out of range")
+}
+
+func addLongs(a types.Long, b types.Long) (types.Long, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, errLongOutOfRange()
+	}
+	return sum, nil
+}
+
+func divideLongs(a types.Long, b types.Long) (types.Long, error) {
+	if b == 0 {
+		return 0, errors.New("Division by zero")
+	}
+	if a == math.MinInt64 && b == -1 {
+		return 0, errLongOutOfRange()
+	}
+	return a / b, nil
+}
+
+func negateLong(a types.Long) (types.Long, error) {
+	if a == math.MinInt64 {
+		return 0, errLongOutOfRange()
+	}
+	return -a, nil
+}
+
+func compileArithmetic(expr *sqlparser.BinaryExpr, scope *exprScope) (valueExpr, error) {
+	operator, ok := arithmeticOperators[expr.Operator]
+	if !ok {
+		return valueExpr{}, errors.New("Operator '" + expr.Operator + "' is not supported")
+	}
+
+	left, err := compileValue(expr.Left, scope)
+	if err != nil {
+		return left, err
+	}
+	right, err := compileValue(expr.Right, scope)
+	if err != nil {
+		return right, err
+	}
+	if (left.Type != nil && left.Type != types.TypeLong) || (right.Type != nil && right.Type != types.TypeLong) {
+		return valueExpr{}, errors.New("Operator '" + expr.Operator + "' requires LONG operands in '" +
+			sqlparser.String(expr) + "'")
+	}
+
+	return valueExpr{
+		Type: types.TypeLong,
+		eval: func(row table.Row) (table.ColumnValue, error) {
+			l, err := left.eval(row)
+			if err != nil || l == nil {
+				return nil, err
+			}
+			r, err := right.eval(row)
+			if err != nil || r == nil {
+				return nil, err
+			}
+			return operator(l.(types.Long), r.(types.Long))
+		},
+	}, nil
+}
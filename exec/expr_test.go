@@ -0,0 +1,28 @@
+package exec
+
+import (
+	"testing"
+)
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		value, pattern string
+		match          bool
+	}{
+		{"", "%", true},
+		{"abc", "abc", true},
+		{"abc", "a%c", true},
+		{"abc", "%b%", true},
+		{"abbbc", "a%bc", true},
+		{"abc", "a_", false},
+		{"abc", "a__", true},
+		{"äbc", "_bc", true},
+		{"a%c", "a!%c", true},
+		{"abc", "a!%c", false},
+	}
+	for _, test := range tests {
+		if likeMatch(test.value, test.pattern, '!') != test.match {
+			t.Error(test.value, "LIKE", test.pattern, "should be", test.match)
+		}
+	}
+}
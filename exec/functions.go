@@ -0,0 +1,196 @@
+package exec
+
+import (
+	"errors"
+	"godb/table"
+	"godb/table/types"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// A function callable in expressions, computing a value from its arguments
+type scalarFunction struct {
+	// Checks the types of the arguments and returns the type of the result.
+	// A nil argument type stands for a NULL literal.
+	check func(argTypes []*table.DataType) (*table.DataType, error)
+	eval  func(args []table.ColumnValue) (table.ColumnValue, error)
+	// Whether the result is NULL as soon as an argument is NULL.
+	// eval is only called with non-NULL arguments then.
+	strict bool
+}
+
+// The scalar functions by their lowercase name
+var scalarFunctions = map[string]scalarFunction{
+	"upper": {
+		check: fixedArgs(types.TypeString, types.TypeString),
+		eval: func(args []table.ColumnValue) (table.ColumnValue, error) {
+			return types.String(strings.ToUpper(string(args[0].(types.String)))), nil
+		},
+		strict: true,
+	},
+	"lower": {
+		check: fixedArgs(types.TypeString, types.TypeString),
+		eval: func(args []table.ColumnValue) (table.ColumnValue, error) {
+			return types.String(strings.ToLower(string(args[0].(types.String)))), nil
+		},
+		strict: true,
+	},
+	"length": {
+		check: fixedArgs(types.TypeLong, types.TypeString),
+		eval: func(args []table.ColumnValue) (table.ColumnValue, error) {
+			return types.Long(utf8.RuneCountInString(string(args[0].(types.String)))), nil
+		},
+		strict: true,
+	},
+	"abs": {
+		check: fixedArgs(types.TypeLong, types.TypeLong),
+		eval: func(args []table.ColumnValue) (table.ColumnValue, error) {
+			num := args[0].(types.Long)
+			if num < 0 {
+				return negateLong(num)
+			}
+			return num, nil
+		},
+		strict: true,
+	},
+	"concat": {
+		check: func(argTypes []*table.DataType) (*table.DataType, error) {
+			if len(argTypes) == 0 {
+				return nil, errors.New("CONCAT requires at least one argument")
+			}
+			return types.TypeString, nil
+		},
+		eval:   concat,
+		strict: true,
+	},
+	// The first argument that is not NULL
+	"coalesce": {
+		check: func(argTypes []*table.DataType) (*table.DataType, error) {
+			if len(argTypes) == 0 {
+				return nil, errors.New("COALESCE requires at least one argument")
+			}
+			var resultType *table.DataType
+			for _, argType := range argTypes {
+				if argType == nil {
+					continue
+				}
+				if resultType != nil && argType != resultType {
+					return nil, errors.New("COALESCE arguments must be of the same type")
+				}
+				resultType = argType
+			}
+			return resultType, nil
+		},
+		eval: func(args []table.ColumnValue) (table.ColumnValue, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		},
+	},
+}
+
+// Checks for arguments of the given types and a result of the given type
+func fixedArgs(resultType *table.DataType, argTypes ...*table.DataType) func([]*table.DataType) (*table.DataType, error) {
+	return func(actualTypes []*table.DataType) (*table.DataType, error) {
+		if len(actualTypes) != len(argTypes) {
+			return nil, errors.New("Function expects " + strconv.Itoa(len(argTypes)) + " arguments, got " +
+				strconv.Itoa(len(actualTypes)))
+		}
+		for i, argType := range argTypes {
+			if actualTypes[i] != nil && actualTypes[i] != argType {
+				return nil, errors.New("Argument " + strconv.Itoa(i+1) + " must be of type " + argType.Name)
+			}
+		}
+		return resultType, nil
+	}
+}
+
+// Concatenates the values as strings
+func concat(args []table.ColumnValue) (table.ColumnValue, error) {
+	var builder strings.Builder
+	for _, arg := range args {
+		builder.WriteString(arg.String())
+	}
+	return types.String(builder.String()), nil
+}
+
+func compileFunction(expr *sqlparser.FuncExpr, scope *exprScope) (valueExpr, error) {
+	name := expr.Name.Lowered()
+	if aggregateFunctions[name] {
+		// Aggregates are computed ahead and part of the scope where allowed
+		return valueExpr{}, errors.New("Aggregate function '" + sqlparser.String(expr) + "' is not allowed here")
+	}
+	function, ok := scalarFunctions[name]
+	if !ok || !expr.Qualifier.IsEmpty() || expr.Distinct {
+		return valueExpr{}, errors.New("Function '" + sqlparser.String(expr) + "' is not supported")
+	}
+
+	args := make([]valueExpr, len(expr.Exprs))
+	argTypes := make([]*table.DataType, len(expr.Exprs))
+	for i, selectExpr := range expr.Exprs {
+		aliasedExpr, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return valueExpr{}, errors.New("Function '" + sqlparser.String(expr) + "' is not supported")
+		}
+		var err error
+		args[i], err = compileValue(aliasedExpr.Expr, scope)
+		if err != nil {
+			return valueExpr{}, err
+		}
+		argTypes[i] = args[i].Type
+	}
+
+	resultType, err := function.check(argTypes)
+	if err != nil {
+		return valueExpr{}, errors.New(strings.ToUpper(name) + " failed. " + err.Error())
+	}
+	return valueExpr{
+		Type: resultType,
+		eval: func(row table.Row) (table.ColumnValue, error) {
+			values := make([]table.ColumnValue, len(args))
+			for i, arg := range args {
+				var err error
+				values[i], err = arg.eval(row)
+				if err != nil {
+					return nil, err
+				}
+				if values[i] == nil && function.strict {
+					return nil, nil
+				}
+			}
+			return function.eval(values)
+		},
+	}, nil
+}
+
+// Compiles a || b, which the sqlparser reads as OR, as string concatenation
+func compileConcat(expr *sqlparser.OrExpr, scope *exprScope) (valueExpr, error) {
+	left, err := compileValue(expr.Left, scope)
+	if err != nil {
+		return left, err
+	}
+	right, err := compileValue(expr.Right, scope)
+	if err != nil {
+		return right, err
+	}
+	return valueExpr{
+		Type: types.TypeString,
+		eval: func(row table.Row) (table.ColumnValue, error) {
+			l, err := left.eval(row)
+			if err != nil || l == nil {
+				return nil, err
+			}
+			r, err := right.eval(row)
+			if err != nil || r == nil {
+				return nil, err
+			}
+			return concat([]table.ColumnValue{l, r})
+		},
+	}, nil
+}
@@ -0,0 +1,831 @@
+package exec
+
+// Conditions of WHERE referring to a single table are applied while reading
+// that table, so they can use its indexes. Conditions referring to both sides
+// of an inner join are added to its ON condition. Neither is done for tables
+// on the NULL supplying side of outer joins, as that would change the result.
+//
+// Every join combines each row of its outer side with the matching rows of
+// its inner side. The planner picks the method finding the matching rows
+// with the least estimated pages read:
+//
+//	Nested loop:       Scans the inner side for every outer row
+//	Index nested loop: Looks up the inner rows in an index of the inner table
+//	Hash join:         Looks up the inner rows in a hash table built in memory
+//	Merge join:        Sorts both sides by the join keys and merges them
+//
+// Hash joins are only planned for inner sides estimated to fit into
+// HASH_JOIN_MEMORY_BUDGET. If the inner rows turn out to be larger while
+// building the hash table, the join is computed as merge join instead.
+//
+// RIGHT joins are planned as LEFT joins with both sides swapped.
+// The sources of nested inner joins are joined in the order with the least
+// estimated cost instead of the order of FROM.
+
+import (
+	"godb/index"
+	"godb/pager"
+	"godb/table"
+	"godb/table/types"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// The number of bytes of inner rows of a hash join held in memory
+var HASH_JOIN_MEMORY_BUDGET = 4 * 1024 * 1024
+
+// The estimated number of pages read to look up a key in an index
+const INDEX_LOOKUP_PAGES = 3
+
+// The estimated share of rows selected by a condition, in percent
+const FILTER_SELECTIVITY = 30
+
+type joinMethod int
+
+const (
+	nestedLoopJoin joinMethod = iota
+	indexNestedLoopJoin
+	hashJoin
+	mergeJoin
+)
+
+var joinMethodNames = map[joinMethod]string{
+	nestedLoopJoin:      "Nested Loop",
+	indexNestedLoopJoin: "Index Nested Loop",
+	hashJoin:            "Hash Join",
+	mergeJoin:           "Merge Join",
+}
+
+// The operators producing the rows of a FROM source
+type sourcePlan struct {
+	op    Operator
+	scope *exprScope
+	// Estimated number of produced rows and of pages read to produce them
+	rows  int64
+	pages int64
+	// The statistics of the columns of the scope, nil for columns of tables
+	// which weren't analyzed
+	columns []*table.ColumnStatistics
+
+	// Set for tables, to look up the rows of index nested loop joins: the
+	// table and the predicate selecting its rows, nil to select all
+	tbl    *table.Table
+	filter table.Predicate
+}
+
+// A conjunct of WHERE and whether it is already applied by the plan
+type conjunct struct {
+	expr sqlparser.Expr
+	used bool
+}
+
+// Plans the sources of FROM with the conjuncts of WHERE
+func planFrom(catalog Catalog, node logicalNode, where []sqlparser.Expr) (*sourcePlan, error) {
+	conjuncts := []*conjunct{}
+	for _, expr := range where {
+		conjuncts = append(conjuncts, &conjunct{expr: expr})
+	}
+
+	plan, err := planSource(catalog, node, conjuncts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The conditions which couldn't be applied earlier filter the result
+	remaining := []sqlparser.Expr{}
+	for _, conjunct := range conjuncts {
+		if !conjunct.used {
+			remaining = append(remaining, conjunct.expr)
+		}
+	}
+	if len(remaining) > 0 {
+		filter, err := compileWhere(joinConjuncts(remaining), plan.scope)
+		if err != nil {
+			return nil, err
+		}
+		if hasStatistics(plan.columns) {
+			plan.rows = estimateRows(plan.rows, selectivity(joinConjuncts(remaining), plan.scope, plan.columns))
+		} else {
+			plan.rows = plan.rows*FILTER_SELECTIVITY/100 + 1
+		}
+		plan.op = &Filter{input: plan.op, predicate: filter, estimate: estimate{rows: plan.rows, cost: plan.pages}}
+	}
+	return plan, nil
+}
+
+// Whether the expression can be evaluated in the scope
+func compilesIn(expr sqlparser.Expr, scope *exprScope) bool {
+	_, err := compileWhere(expr, scope)
+	return err == nil
+}
+
+// Whether the expression refers to any column
+func hasColumns(expr sqlparser.Expr) bool {
+	found := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if _, ok := node.(*sqlparser.ColName); ok {
+			found = true
+		}
+		return !found, nil
+	}, expr)
+	return found
+}
+
+func planSource(catalog Catalog, node logicalNode, conjuncts []*conjunct) (*sourcePlan, error) {
+	if scan, ok := node.(*logicalScan); ok {
+		return planTable(catalog, scan, conjuncts)
+	}
+
+	join := node.(*logicalJoin)
+	if isInnerJoin(join) {
+		sources, on := innerJoinSources(join)
+		if len(sources) > 2 {
+			return planJoinOrder(catalog, join, sources, on, conjuncts)
+		}
+	}
+
+	left, err := planSource(catalog, join.left, conjuncts)
+	if err != nil {
+		return nil, err
+	}
+	right, err := planSource(catalog, join.right, conjuncts)
+	if err != nil {
+		return nil, err
+	}
+
+	on := join.on
+	if join.kind == sqlparser.JoinStr && !join.nullable {
+		for _, conjunct := range conjuncts {
+			if !conjunct.used && hasColumns(conjunct.expr) && compilesIn(conjunct.expr, join.rowScope) {
+				on = append(on, conjunct.expr)
+				conjunct.used = true
+			}
+		}
+	}
+	return planJoin(catalog, join, left, right, on)
+}
+
+// Whether the node is a join keeping only the matching rows of both sides
+func isInnerJoin(node logicalNode) bool {
+	join, ok := node.(*logicalJoin)
+	return ok && join.kind == sqlparser.JoinStr && !join.nullable
+}
+
+// The sources combined by nested inner joins in the order of FROM, and the
+// conjuncts of their ON conditions
+func innerJoinSources(node logicalNode) ([]logicalNode, []sqlparser.Expr) {
+	if !isInnerJoin(node) {
+		return []logicalNode{node}, nil
+	}
+	join := node.(*logicalJoin)
+	left, leftOn := innerJoinSources(join.left)
+	right, rightOn := innerJoinSources(join.right)
+	return append(left, right...), append(append(leftOn, rightOn...), join.on...)
+}
+
+// Plans the inner joins of more than two sources, which may be joined in any
+// order. Starting with the source with the fewest rows, the source which is
+// cheapest to join is joined next, preferring sources related by a condition
+// over cross joins.
+func planJoinOrder(catalog Catalog, node *logicalJoin, sources []logicalNode, on []sqlparser.Expr, conjuncts []*conjunct) (*sourcePlan, error) {
+	// The conditions of ON apply to the joined rows like those of WHERE
+	conjuncts = append([]*conjunct{}, conjuncts...)
+	isOn := make(map[*conjunct]bool)
+	for _, expr := range on {
+		onConjunct := &conjunct{expr: expr}
+		conjuncts = append(conjuncts, onConjunct)
+		isOn[onConjunct] = true
+	}
+
+	// A plan joining some of the sources and their positions in FROM, in
+	// the order of the joined columns
+	type joinedPlan struct {
+		plan    *sourcePlan
+		sources []int
+	}
+	remaining := []*joinedPlan{}
+	for i, source := range sources {
+		plan, err := planSource(catalog, source, conjuncts)
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, &joinedPlan{plan: plan, sources: []int{i}})
+	}
+
+	first := 0
+	for i, candidate := range remaining {
+		if candidate.plan.rows < remaining[first].plan.rows {
+			first = i
+		}
+	}
+	current := remaining[first]
+	remaining = append(remaining[:first], remaining[first+1:]...)
+
+	for len(remaining) > 0 {
+		var best *joinedPlan
+		var bestOn []*conjunct
+		bestIdx := -1
+		for i, candidate := range remaining {
+			scope := joinScopes(current.plan.scope, candidate.plan.scope)
+			joinOn := []*conjunct{}
+			exprs := []sqlparser.Expr{}
+			for _, conjunct := range conjuncts {
+				if !conjunct.used && (hasColumns(conjunct.expr) || isOn[conjunct]) && compilesIn(conjunct.expr, scope) {
+					joinOn = append(joinOn, conjunct)
+					exprs = append(exprs, conjunct.expr)
+				}
+			}
+			plan, err := planJoin(catalog, &logicalJoin{kind: sqlparser.JoinStr, rowScope: scope}, current.plan, candidate.plan, exprs)
+			if err != nil {
+				return nil, err
+			}
+
+			connected, bestConnected := len(joinOn) > 0, len(bestOn) > 0
+			if best == nil || (connected && !bestConnected) || (connected == bestConnected && plan.pages < best.plan.pages) {
+				best = &joinedPlan{plan: plan, sources: append(append([]int{}, current.sources...), candidate.sources...)}
+				bestOn, bestIdx = joinOn, i
+			}
+		}
+		for _, conjunct := range bestOn {
+			conjunct.used = true
+		}
+		current = best
+		remaining = append(remaining[:bestIdx], remaining[bestIdx+1:]...)
+	}
+
+	// The columns are put back into the order of FROM
+	offsets := make([]int, len(sources))
+	offset := 0
+	for _, i := range current.sources {
+		offsets[i] = offset
+		offset += len(sources[i].scope().columns)
+	}
+	plan := current.plan
+	exprs := []valueExpr{}
+	columns := []*table.ColumnStatistics{}
+	reordered := false
+	for i, source := range sources {
+		for colIdx, col := range source.scope().columns {
+			joinedIdx := offsets[i] + colIdx
+			reordered = reordered || joinedIdx != len(exprs)
+			exprs = append(exprs, rowColumn(joinedIdx, col.Type))
+			columns = append(columns, plan.columns[joinedIdx])
+		}
+	}
+	if reordered {
+		plan.op = &Project{input: plan.op, exprs: exprs, estimate: *estimateOf(plan.op)}
+	}
+	plan.scope, plan.columns = node.rowScope, columns
+	return plan, nil
+}
+
+// Plans reading a table with the conditions of WHERE which only refer to it
+func planTable(catalog Catalog, scan *logicalScan, conjuncts []*conjunct) (*sourcePlan, error) {
+	plan := &sourcePlan{scope: scan.rowScope, tbl: scan.tbl}
+
+	exprs := []sqlparser.Expr{}
+	if !scan.nullable {
+		for _, conjunct := range conjuncts {
+			if !conjunct.used && compilesIn(conjunct.expr, scan.rowScope) {
+				exprs = append(exprs, conjunct.expr)
+				conjunct.used = true
+			}
+		}
+	}
+
+	var err error
+	plan.pages, err = scan.tbl.PageCount()
+	if err != nil {
+		return nil, err
+	}
+	plan.rows, plan.columns = tableEstimate(catalog, scan.tbl, plan.pages)
+	if len(exprs) == 0 {
+		plan.op = NewScan(scan.tbl, AccessPath{}, nil)
+		*estimateOf(plan.op) = estimate{rows: plan.rows, cost: plan.pages}
+		return plan, nil
+	}
+
+	where := joinConjuncts(exprs)
+	plan.filter, err = compileWhere(where, scan.rowScope)
+	if err != nil {
+		return nil, err
+	}
+	preds, err := ExtractPredicates(where, scan.tbl.Schema)
+	if err != nil {
+		return nil, err
+	}
+	path := ChooseAccessPath(catalog.TableIndexes(scan.tbl.Name), preds)
+
+	if hasStatistics(plan.columns) {
+		// Every row found in the index is fetched from its data page, which
+		// may be more expensive than reading all pages
+		if path.Index != nil {
+			fetched := estimateRows(plan.rows, indexSelectivity(scan.tbl, path.Index, preds, plan.columns))
+			if INDEX_LOOKUP_PAGES+fetched < plan.pages {
+				plan.pages = INDEX_LOOKUP_PAGES + fetched
+			} else {
+				path = AccessPath{}
+			}
+		}
+		plan.rows = estimateRows(plan.rows, selectivity(where, scan.rowScope, plan.columns))
+	} else {
+		if path.Index != nil {
+			plan.pages = plan.pages*FILTER_SELECTIVITY/100 + INDEX_LOOKUP_PAGES
+		}
+		if isPointLookup(path) {
+			plan.rows = 1
+		} else {
+			plan.rows = plan.rows*FILTER_SELECTIVITY/100 + 1
+		}
+	}
+
+	plan.op = NewScan(scan.tbl, path, plan.filter)
+	*estimateOf(plan.op) = estimate{rows: plan.rows, cost: plan.pages}
+	return plan, nil
+}
+
+// Whether the access path looks up a single key of a unique index
+func isPointLookup(path AccessPath) bool {
+	if path.Index == nil || !path.Index.Unique || path.Lower == nil || path.Upper == nil {
+		return false
+	}
+	return path.Lower.Inclusive && path.Upper.Inclusive && len(path.Lower.Key) == len(path.Index.Columns) &&
+		len(path.Upper.Key) == len(path.Index.Columns)
+}
+
+// Estimates the number of rows per data page from the column types
+func rowsPerPage(schema table.TableSchema) int64 {
+	// Row pointer and column flags
+	rowLength := int64(4 + len(schema.Columns))
+	for _, col := range schema.Columns {
+		if col.Type == types.TypeString {
+			rowLength += types.STRING_LEN_LEN + 16
+		} else {
+			rowLength += 8
+		}
+	}
+	return pager.PAGE_SIZE/rowLength + 1
+}
+
+func planJoin(catalog Catalog, node *logicalJoin, left *sourcePlan, right *sourcePlan, on []sqlparser.Expr) (*sourcePlan, error) {
+	join := &Join{keepUnmatched: node.kind != sqlparser.JoinStr}
+	if len(on) > 0 {
+		var err error
+		join.on, err = compileWhere(joinConjuncts(on), node.rowScope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Inner joins may be computed with either side as outer side. On equal
+	// costs the smaller side is preferred as inner side, held by hash joins.
+	orientations := []bool{false, true}
+	if right.pages > left.pages {
+		orientations = []bool{true, false}
+	}
+	if node.kind == sqlparser.LeftJoinStr {
+		orientations = []bool{false}
+	} else if node.kind == sqlparser.RightJoinStr {
+		orientations = []bool{true}
+	}
+
+	bestCost := int64(-1)
+	var outer, inner *sourcePlan
+	var joinIdx *index.TableIndex
+	for _, swapped := range orientations {
+		outerCandidate, innerCandidate := left, right
+		if swapped {
+			outerCandidate, innerCandidate = right, left
+		}
+		outerKeys, innerKeys, innerColumns := equiJoinKeys(on, outerCandidate.scope, innerCandidate.scope)
+
+		methods := []joinMethod{nestedLoopJoin}
+		costs := []int64{outerCandidate.pages + outerCandidate.rows*innerCandidate.pages}
+		indexKey := -1
+		var idx *index.TableIndex
+		if len(outerKeys) > 0 {
+			idx, indexKey = joinIndex(catalog, innerCandidate, innerColumns)
+			if idx != nil {
+				methods = append(methods, indexNestedLoopJoin)
+				costs = append(costs, outerCandidate.pages+outerCandidate.rows*INDEX_LOOKUP_PAGES)
+			}
+			if innerCandidate.pages*pager.PAGE_SIZE <= int64(HASH_JOIN_MEMORY_BUDGET) {
+				methods = append(methods, hashJoin)
+				costs = append(costs, outerCandidate.pages+innerCandidate.pages)
+			} else {
+				// Both sides are sorted, which writes and reads them again
+				methods = append(methods, mergeJoin)
+				costs = append(costs, 3*(outerCandidate.pages+innerCandidate.pages))
+			}
+		}
+
+		for i, method := range methods {
+			if bestCost >= 0 && costs[i] >= bestCost {
+				continue
+			}
+			bestCost = costs[i]
+			join.method = method
+			join.swapped = swapped
+			join.outerKeys, join.innerKeys = outerKeys, innerKeys
+			join.indexKey = indexKey
+			outer, inner, joinIdx = outerCandidate, innerCandidate, idx
+		}
+	}
+
+	plan := &sourcePlan{op: join, scope: node.rowScope, pages: bestCost,
+		columns: append(append([]*table.ColumnStatistics{}, left.columns...), right.columns...)}
+	if hasStatistics(plan.columns) {
+		plan.rows = left.rows * right.rows
+		if len(on) > 0 {
+			plan.rows = estimateRows(plan.rows, selectivity(joinConjuncts(on), node.rowScope, plan.columns))
+		}
+	} else if len(join.outerKeys) > 0 {
+		plan.rows = max64(left.rows, right.rows)
+	} else {
+		plan.rows = left.rows * right.rows
+		if len(on) > 0 {
+			plan.rows = plan.rows*FILTER_SELECTIVITY/100 + 1
+		}
+	}
+	join.estimate = estimate{rows: plan.rows, cost: plan.pages}
+
+	join.outer, join.inner = outer.op, inner.op
+	join.outerTypes, join.innerTypes = outer.scope.types(), inner.scope.types()
+	join.innerWidth = len(inner.scope.columns)
+	switch join.method {
+	case indexNestedLoopJoin:
+		// Estimated per outer row
+		join.lookup = &IndexScan{tbl: inner.tbl, index: joinIdx, predicate: inner.filter,
+			estimate: estimate{rows: plan.rows/max64(outer.rows, 1) + 1, cost: INDEX_LOOKUP_PAGES}}
+		join.inner = join.lookup
+	case mergeJoin:
+		outerSort, innerSort := join.sortInputs()
+		outerSort.estimate = estimate{rows: outer.rows, cost: 3 * outer.pages}
+		innerSort.estimate = estimate{rows: inner.rows, cost: 3 * inner.pages}
+	}
+	return plan, nil
+}
+
+func max64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Ascending sort keys computing the given values
+func keysOf(exprs []valueExpr) []orderKey {
+	keys := make([]orderKey, len(exprs))
+	for i, expr := range exprs {
+		keys[i] = orderKey{expr: expr}
+	}
+	return keys
+}
+
+// Finds the equalities between an expression of the outer and one of the
+// inner side among the conjuncts of ON.
+// Returns the expressions of both sides, compiled in their scopes, and the
+// position of the inner column for inner keys which are plain columns, else
+// -1.
+func equiJoinKeys(on []sqlparser.Expr, outerScope *exprScope, innerScope *exprScope) ([]valueExpr, []valueExpr, []int) {
+	outerKeys := []valueExpr{}
+	innerKeys := []valueExpr{}
+	innerColumns := []int{}
+	for _, expr := range on {
+		comparison, ok := expr.(*sqlparser.ComparisonExpr)
+		if !ok || comparison.Operator != sqlparser.EqualStr ||
+			!hasColumns(comparison.Left) || !hasColumns(comparison.Right) {
+			continue
+		}
+		for _, sides := range [][2]sqlparser.Expr{{comparison.Left, comparison.Right}, {comparison.Right, comparison.Left}} {
+			outerKey, outerErr := compileValue(sides[0], outerScope)
+			innerKey, innerErr := compileValue(sides[1], innerScope)
+			if outerErr != nil || innerErr != nil || outerKey.Type == nil || outerKey.Type != innerKey.Type {
+				continue
+			}
+			colIdx := -1
+			if colName, ok := sides[1].(*sqlparser.ColName); ok {
+				colIdx, _ = innerScope.resolve(colName)
+			}
+			outerKeys = append(outerKeys, outerKey)
+			innerKeys = append(innerKeys, innerKey)
+			innerColumns = append(innerColumns, colIdx)
+			break
+		}
+	}
+	return outerKeys, innerKeys, innerColumns
+}
+
+// Finds an index of the inner table whose first column is a join key.
+// Returns the index and the position of the key.
+func joinIndex(catalog Catalog, inner *sourcePlan, innerColumns []int) (*index.TableIndex, int) {
+	if inner.tbl == nil {
+		return nil, -1
+	}
+	for _, idx := range catalog.TableIndexes(inner.tbl.Name) {
+		_, colIdx, err := inner.tbl.Schema.FindColumnByName(idx.Columns[0])
+		if err != nil {
+			continue
+		}
+		for key, innerColumn := range innerColumns {
+			if innerColumn == colIdx {
+				return idx, key
+			}
+		}
+	}
+	return nil, -1
+}
+
+// Evaluates the keys of a row, nil if any is NULL, as it matches nothing
+func evalKeys(keys []valueExpr, row table.Row) (table.Row, error) {
+	values := make(table.Row, len(keys))
+	for i, key := range keys {
+		value, err := key.eval(row)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// Orders two rows of keys, which are never NULL
+func compareKeys(a table.Row, b table.Row) (int, error) {
+	return compareOrderKeys(a, b, make([]orderKey, len(a)))
+}
+
+// Combines every row of its outer input with the matching rows of its inner
+// input
+type Join struct {
+	estimate
+	method joinMethod
+	outer  Operator
+	inner  Operator
+	// Whether outer rows without matching inner rows are kept, with NULL for
+	// the inner columns
+	keepUnmatched bool
+	// Whether the outer side is the right side of the join. The joined rows
+	// are always made up of the left columns followed by the right ones.
+	swapped    bool
+	innerWidth int
+	// The types of the rows of both inputs, to sort them for merge joins
+	outerTypes []*table.DataType
+	innerTypes []*table.DataType
+	// The equalities of the ON condition, evaluated on outer and inner rows
+	outerKeys []valueExpr
+	innerKeys []valueExpr
+	// The ON condition on the joined rows, nil for none
+	on table.Predicate
+	// For index nested loop joins, the index scan of the inner side and the
+	// position of the outer key looked up in it
+	lookup   *IndexScan
+	indexKey int
+
+	// The inner rows which may match the current outer row, nil before the
+	// next outer row
+	candidates Operator
+	outerRow   table.Row
+	matched    bool
+	// The inner rows of hash joins by their encoded keys
+	hashTable map[string][]table.Row
+	// For merge joins, the keys of the last outer row and the inner rows
+	// with these keys, followed by the next inner row and its keys, nil at
+	// the end
+	mergeKeys  table.Row
+	mergeGroup []table.Row
+	next       table.Row
+	nextKeys   table.Row
+}
+
+// Sorts both inputs by the join keys for a merge join
+func (join *Join) sortInputs() (*Sort, *Sort) {
+	outerSort := newSort(join.outer, keysOf(join.outerKeys), join.outerTypes)
+	innerSort := newSort(join.inner, keysOf(join.innerKeys), join.innerTypes)
+	join.outer, join.inner = outerSort, innerSort
+	return outerSort, innerSort
+}
+
+func (join *Join) Open() error {
+	if join.method == hashJoin {
+		fits, err := join.buildHashTable()
+		if err != nil {
+			return err
+		}
+		if !fits {
+			// The estimate was too low, the sorts spill what doesn't fit
+			join.hashTable = nil
+			join.method = mergeJoin
+			join.sortInputs()
+		}
+	}
+
+	err := join.outer.Open()
+	if err != nil {
+		return err
+	}
+	if join.method == mergeJoin {
+		join.mergeKeys, join.mergeGroup = nil, nil
+		err = join.inner.Open()
+		if err != nil {
+			return err
+		}
+		return join.advanceInner()
+	}
+	return nil
+}
+
+// Reads the inner rows into the hash table.
+// Returns false if they don't fit into HASH_JOIN_MEMORY_BUDGET.
+func (join *Join) buildHashTable() (bool, error) {
+	join.hashTable = make(map[string][]table.Row)
+	err := join.inner.Open()
+	defer join.inner.Close()
+	size := 0
+	for err == nil {
+		var row table.Row
+		row, err = join.inner.Next()
+		if row == nil {
+			break
+		}
+		var keys table.Row
+		keys, err = evalKeys(join.innerKeys, row)
+		if keys != nil {
+			key := string(encodeSortRecord(keys))
+			join.hashTable[key] = append(join.hashTable[key], row)
+			size += len(key) + row.Length() + len(row)
+			if size > HASH_JOIN_MEMORY_BUDGET {
+				return false, nil
+			}
+		}
+	}
+	return true, err
+}
+
+// Moves to the next inner row of a merge join with keys other than NULL
+func (join *Join) advanceInner() error {
+	join.next, join.nextKeys = nil, nil
+	for {
+		row, err := join.inner.Next()
+		if err != nil || row == nil {
+			return err
+		}
+		keys, err := evalKeys(join.innerKeys, row)
+		if err != nil {
+			return err
+		}
+		if keys != nil {
+			join.next, join.nextKeys = row, keys
+			return nil
+		}
+	}
+}
+
+// The inner rows of a merge join with the given keys. The outer rows are
+// read in key order, so the inner rows are read in order along with them.
+func (join *Join) mergeCandidates(keys table.Row) ([]table.Row, error) {
+	if join.mergeKeys != nil {
+		cmp, err := compareKeys(join.mergeKeys, keys)
+		if err != nil || cmp == 0 {
+			return join.mergeGroup, err
+		}
+	}
+
+	// Skip the inner rows with smaller keys and collect the equal ones
+	join.mergeKeys, join.mergeGroup = keys, nil
+	for join.next != nil {
+		cmp, err := compareKeys(join.nextKeys, keys)
+		if err != nil {
+			return nil, err
+		}
+		if cmp > 0 {
+			break
+		}
+		if cmp == 0 {
+			join.mergeGroup = append(join.mergeGroup, join.next)
+		}
+		err = join.advanceInner()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return join.mergeGroup, nil
+}
+
+// Opens the candidates of the current outer row
+func (join *Join) openCandidates() error {
+	keys, err := evalKeys(join.outerKeys, join.outerRow)
+	if err != nil {
+		return err
+	}
+	if keys == nil && len(join.outerKeys) > 0 {
+		join.candidates = &rowList{}
+		return nil
+	}
+
+	switch join.method {
+	case nestedLoopJoin:
+		join.candidates = join.inner
+	case indexNestedLoopJoin:
+		join.lookup.lower = &index.Bound{Key: table.Row{keys[join.indexKey]}, Inclusive: true}
+		join.lookup.upper = join.lookup.lower
+		join.candidates = join.inner
+	case hashJoin:
+		join.candidates = &rowList{rows: join.hashTable[string(encodeSortRecord(keys))]}
+	case mergeJoin:
+		rows, err := join.mergeCandidates(keys)
+		if err != nil {
+			return err
+		}
+		join.candidates = &rowList{rows: rows}
+	}
+	return join.candidates.Open()
+}
+
+func (join *Join) Next() (table.Row, error) {
+	for {
+		if join.candidates == nil {
+			var err error
+			join.outerRow, err = join.outer.Next()
+			if err != nil || join.outerRow == nil {
+				return nil, err
+			}
+			join.matched = false
+			err = join.openCandidates()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for {
+			innerRow, err := join.candidates.Next()
+			if err != nil {
+				return nil, err
+			}
+			if innerRow == nil {
+				break
+			}
+			row := join.combine(join.outerRow, innerRow)
+			match, err := matches(join.on, row)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				join.matched = true
+				return row, nil
+			}
+		}
+		join.candidates.Close()
+		join.candidates = nil
+
+		if !join.matched && join.keepUnmatched {
+			return join.combine(join.outerRow, nil), nil
+		}
+	}
+}
+
+// Combines the rows of both sides, innerRow nil for NULLs
+func (join *Join) combine(outerRow table.Row, innerRow table.Row) table.Row {
+	if innerRow == nil {
+		innerRow = make(table.Row, join.innerWidth)
+	}
+	if join.swapped {
+		return append(append(table.Row{}, innerRow...), outerRow...)
+	}
+	return append(append(table.Row{}, outerRow...), innerRow...)
+}
+
+func (join *Join) Close() {
+	if join.candidates != nil {
+		join.candidates.Close()
+		join.candidates = nil
+	}
+	join.outer.Close()
+	if join.method == mergeJoin {
+		join.inner.Close()
+	}
+	join.hashTable = nil
+	join.mergeKeys, join.mergeGroup = nil, nil
+	join.next, join.nextKeys = nil, nil
+}
+
+// Rows held in memory
+type rowList struct {
+	rows []table.Row
+	next int
+}
+
+func (list *rowList) Open() error {
+	list.next = 0
+	return nil
+}
+
+func (list *rowList) Next() (table.Row, error) {
+	if list.next == len(list.rows) {
+		return nil, nil
+	}
+	list.next++
+	return list.rows[list.next-1], nil
+}
+
+func (list *rowList) Close() {
+}
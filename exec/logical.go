@@ -0,0 +1,275 @@
+package exec
+
+import (
+	"errors"
+	"godb/table"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// A node of the logical plan of a query
+type logicalNode interface {
+	// The scope of the rows produced by the node
+	scope() *exprScope
+}
+
+// The rows of a table
+type logicalScan struct {
+	tbl      *table.Table
+	rowScope *exprScope
+	// Whether the rows may be replaced by NULLs by an outer join
+	nullable bool
+}
+
+// The combined rows of two sources of FROM
+type logicalJoin struct {
+	left  logicalNode
+	right logicalNode
+	// LeftJoinStr, RightJoinStr or JoinStr for inner and cross joins
+	kind string
+	// The conjuncts of ON
+	on       []sqlparser.Expr
+	rowScope *exprScope
+	// Whether the rows may be replaced by NULLs by an outer join
+	nullable bool
+}
+
+// The rows of the input matching all conjuncts of a condition
+type logicalFilter struct {
+	input     logicalNode
+	conjuncts []sqlparser.Expr
+}
+
+// The groups of the input rows
+type logicalAggregate struct {
+	input       logicalNode
+	aggregation *aggregation
+}
+
+// Rows computed from the input rows
+type logicalProject struct {
+	input logicalNode
+	exprs []valueExpr
+}
+
+// The input rows ordered by keys
+type logicalSort struct {
+	input logicalNode
+	keys  []orderKey
+}
+
+// The input rows after the first offset rows, at most limit rows or all for
+// a limit of -1
+type logicalLimit struct {
+	input  logicalNode
+	offset int
+	limit  int
+}
+
+func (node *logicalScan) scope() *exprScope {
+	return node.rowScope
+}
+
+func (node *logicalJoin) scope() *exprScope {
+	return node.rowScope
+}
+
+func (node *logicalFilter) scope() *exprScope {
+	return node.input.scope()
+}
+
+func (node *logicalAggregate) scope() *exprScope {
+	return node.aggregation.scope
+}
+
+func (node *logicalProject) scope() *exprScope {
+	scope := &exprScope{}
+	for _, expr := range node.exprs {
+		scope.columns = append(scope.columns, scopeColumn{Type: expr.Type})
+	}
+	return scope
+}
+
+func (node *logicalSort) scope() *exprScope {
+	return node.input.scope()
+}
+
+func (node *logicalLimit) scope() *exprScope {
+	return node.input.scope()
+}
+
+// Builds the logical plan of a SELECT.
+// Returns the plan and the result columns.
+func buildLogical(catalog Catalog, stmt *sqlparser.Select) (logicalNode, []table.ColumnDef, error) {
+	var node logicalNode
+	for _, tableExpr := range stmt.From {
+		source, err := buildFrom(catalog, tableExpr, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		// FROM a, b is a cross join
+		if node == nil {
+			node = source
+		} else {
+			node = &logicalJoin{left: node, right: source, kind: sqlparser.JoinStr,
+				rowScope: joinScopes(node.scope(), source.scope())}
+		}
+	}
+
+	if stmt.Where != nil {
+		_, err := compileWhere(stmt.Where.Expr, node.scope())
+		if err != nil {
+			return nil, nil, err
+		}
+		node = &logicalFilter{input: node, conjuncts: splitConjuncts(stmt.Where.Expr)}
+	}
+
+	// With aggregates, all further expressions are evaluated on the groups
+	aggregation, err := compileAggregation(stmt, node.scope())
+	if err != nil {
+		return nil, nil, err
+	}
+	if aggregation != nil {
+		node = &logicalAggregate{input: node, aggregation: aggregation}
+	}
+	scope := node.scope()
+
+	columns, exprs, aliases, selected, err := compileSelectList(stmt.SelectExprs, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stmt.Having != nil {
+		_, err = compileWhere(stmt.Having.Expr, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		node = &logicalFilter{input: node, conjuncts: splitConjuncts(stmt.Having.Expr)}
+	}
+
+	// Keys of ORDER BY which aren't result columns are computed along with
+	// them and dropped after sorting
+	// The rows of SELECT DISTINCT can only be sorted by their result columns
+	if stmt.Distinct == "" {
+		selected = nil
+	}
+	keys, hidden, err := compileOrderBy(stmt.OrderBy, aliases, selected, columns, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	node = &logicalProject{input: node, exprs: append(exprs, hidden...)}
+	if stmt.Distinct != "" {
+		if len(hidden) > 0 {
+			return nil, nil, errors.New("ORDER BY of SELECT DISTINCT only supports result columns")
+		}
+		node = &logicalAggregate{input: node, aggregation: distinctAggregation(node.scope())}
+	}
+	if len(keys) > 0 {
+		node = &logicalSort{input: node, keys: keys}
+	}
+
+	offset, limit, err := compileLimit(stmt.Limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset > 0 || limit >= 0 {
+		node = &logicalLimit{input: node, offset: offset, limit: limit}
+	}
+
+	if len(hidden) > 0 {
+		resultScope := node.scope()
+		resultExprs := []valueExpr{}
+		for i := range columns {
+			resultExprs = append(resultExprs, resultScope.column(i))
+		}
+		node = &logicalProject{input: node, exprs: resultExprs}
+	}
+	return node, columns, nil
+}
+
+// Builds the logical plan of a source of FROM
+func buildFrom(catalog Catalog, tableExpr sqlparser.TableExpr, nullable bool) (logicalNode, error) {
+	switch tableExpr := tableExpr.(type) {
+	case *sqlparser.AliasedTableExpr:
+		tableName := sqlparser.GetTableName(tableExpr.Expr)
+		if tableName.IsEmpty() {
+			return nil, errors.New("Only tables supported in FROM")
+		}
+		tbl, err := catalog.OpenTable(tableName.String())
+		if err != nil {
+			return nil, err
+		}
+		return &logicalScan{tbl: tbl, rowScope: tableScope(tbl, tableExpr.As.String()), nullable: nullable}, nil
+
+	case *sqlparser.ParenTableExpr:
+		var node logicalNode
+		for _, inner := range tableExpr.Exprs {
+			source, err := buildFrom(catalog, inner, nullable)
+			if err != nil {
+				return nil, err
+			}
+			if node == nil {
+				node = source
+			} else {
+				node = &logicalJoin{left: node, right: source, kind: sqlparser.JoinStr,
+					rowScope: joinScopes(node.scope(), source.scope()), nullable: nullable}
+			}
+		}
+		return node, nil
+
+	case *sqlparser.JoinTableExpr:
+		kind := tableExpr.Join
+		if kind == sqlparser.StraightJoinStr {
+			kind = sqlparser.JoinStr
+		}
+		if kind != sqlparser.JoinStr && kind != sqlparser.LeftJoinStr && kind != sqlparser.RightJoinStr {
+			return nil, errors.New("'" + tableExpr.Join + "' is not supported")
+		}
+		if tableExpr.Condition.Using != nil {
+			return nil, errors.New("JOIN with USING is not supported")
+		}
+
+		left, err := buildFrom(catalog, tableExpr.LeftExpr, nullable || kind == sqlparser.RightJoinStr)
+		if err != nil {
+			return nil, err
+		}
+		right, err := buildFrom(catalog, tableExpr.RightExpr, nullable || kind == sqlparser.LeftJoinStr)
+		if err != nil {
+			return nil, err
+		}
+		node := &logicalJoin{left: left, right: right, kind: kind,
+			rowScope: joinScopes(left.scope(), right.scope()), nullable: nullable}
+		if tableExpr.Condition.On != nil {
+			node.on = splitConjuncts(tableExpr.Condition.On)
+			_, err = compileWhere(tableExpr.Condition.On, node.rowScope)
+			if err != nil {
+				return nil, err
+			}
+		} else if kind != sqlparser.JoinStr {
+			return nil, errors.New("Outer joins require an ON condition")
+		}
+		return node, nil
+	}
+	return nil, errors.New("'" + sqlparser.String(tableExpr) + "' is not supported in FROM")
+}
+
+// Splits a condition into the conditions joined by AND
+func splitConjuncts(expr sqlparser.Expr) []sqlparser.Expr {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		return append(splitConjuncts(expr.Left), splitConjuncts(expr.Right)...)
+	case *sqlparser.ParenExpr:
+		if _, ok := expr.Expr.(*sqlparser.AndExpr); ok {
+			return splitConjuncts(expr.Expr)
+		}
+	}
+	return []sqlparser.Expr{expr}
+}
+
+// Joins conditions by AND
+func joinConjuncts(exprs []sqlparser.Expr) sqlparser.Expr {
+	expr := exprs[0]
+	for _, right := range exprs[1:] {
+		expr = &sqlparser.AndExpr{Left: expr, Right: right}
+	}
+	return expr
+}
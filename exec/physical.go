@@ -0,0 +1,188 @@
+package exec
+
+import (
+	"errors"
+	"godb/table"
+)
+
+// The estimated number of input rows per group of GROUP BY
+const ROWS_PER_GROUP = 10
+
+// Chooses the operators computing a logical plan
+func planPhysical(catalog Catalog, node logicalNode) (Operator, error) {
+	switch node := node.(type) {
+	case *logicalScan, *logicalJoin:
+		plan, err := planFrom(catalog, node, nil)
+		if err != nil {
+			return nil, err
+		}
+		return plan.op, nil
+
+	case *logicalFilter:
+		// Conditions on the sources of FROM are planned along with them
+		switch node.input.(type) {
+		case *logicalScan, *logicalJoin:
+			plan, err := planFrom(catalog, node.input, node.conjuncts)
+			if err != nil {
+				return nil, err
+			}
+			return plan.op, nil
+		}
+		input, err := planPhysical(catalog, node.input)
+		if err != nil {
+			return nil, err
+		}
+		predicate, err := compileWhere(joinConjuncts(node.conjuncts), node.input.scope())
+		if err != nil {
+			return nil, err
+		}
+		inputEstimate := estimateOf(input)
+		return &Filter{input: input, predicate: predicate,
+			estimate: estimate{rows: inputEstimate.rows*FILTER_SELECTIVITY/100 + 1, cost: inputEstimate.cost}}, nil
+
+	case *logicalAggregate:
+		input, err := planPhysical(catalog, node.input)
+		if err != nil {
+			return nil, err
+		}
+		aggregate := newAggregate(node.aggregation, input)
+		aggregate.estimate = *estimateOf(input)
+		if len(node.aggregation.groupBy) == 0 {
+			aggregate.rows = 1
+		} else {
+			aggregate.rows = aggregate.rows/ROWS_PER_GROUP + 1
+		}
+		return aggregate, nil
+
+	case *logicalProject:
+		input, err := planPhysical(catalog, node.input)
+		if err != nil {
+			return nil, err
+		}
+		return &Project{input: input, exprs: node.exprs, estimate: *estimateOf(input)}, nil
+
+	case *logicalSort:
+		input, err := planPhysical(catalog, node.input)
+		if err != nil {
+			return nil, err
+		}
+		sortOp := newSort(input, node.keys, node.input.scope().types())
+		sortOp.estimate = *estimateOf(input)
+		return sortOp, nil
+
+	case *logicalLimit:
+		input, err := planPhysical(catalog, node.input)
+		if err != nil {
+			return nil, err
+		}
+		// Only the rows up to the limit need to be sorted
+		if sortOp, ok := input.(*Sort); ok && node.limit >= 0 {
+			sortOp.limit = node.offset + node.limit
+		}
+		limiter := &Limit{input: input, offset: node.offset, limit: node.limit, estimate: *estimateOf(input)}
+		limiter.rows = max64(limiter.rows-int64(node.offset), 0)
+		if node.limit >= 0 && int64(node.limit) < limiter.rows {
+			limiter.rows = int64(node.limit)
+		}
+		return limiter, nil
+	}
+	return nil, errors.New("Unknown logical plan node")
+}
+
+// Selects the rows of its input matching a predicate
+type Filter struct {
+	estimate
+	input     Operator
+	predicate table.Predicate
+}
+
+func (filter *Filter) Open() error {
+	return filter.input.Open()
+}
+
+func (filter *Filter) Next() (table.Row, error) {
+	for {
+		row, err := filter.input.Next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+		match, err := filter.predicate(row)
+		if err != nil || match {
+			return row, err
+		}
+	}
+}
+
+func (filter *Filter) Close() {
+	filter.input.Close()
+}
+
+// Computes new rows from the rows of its input
+type Project struct {
+	estimate
+	input Operator
+	exprs []valueExpr
+}
+
+func (project *Project) Open() error {
+	return project.input.Open()
+}
+
+func (project *Project) Next() (table.Row, error) {
+	inputRow, err := project.input.Next()
+	if err != nil || inputRow == nil {
+		return nil, err
+	}
+	row := make(table.Row, len(project.exprs))
+	for i, expr := range project.exprs {
+		row[i], err = expr.eval(inputRow)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+func (project *Project) Close() {
+	project.input.Close()
+}
+
+// Skips the first rows of its input and returns at most limit rows of it
+type Limit struct {
+	estimate
+	input  Operator
+	offset int
+	// -1 for no limit
+	limit int
+	// The number of rows skipped and returned so far
+	skipped  int
+	returned int
+}
+
+func (limiter *Limit) Open() error {
+	limiter.skipped, limiter.returned = 0, 0
+	return limiter.input.Open()
+}
+
+func (limiter *Limit) Next() (table.Row, error) {
+	// Stop before reading any further rows once the limit is reached
+	if limiter.limit >= 0 && limiter.returned >= limiter.limit {
+		return nil, nil
+	}
+	for limiter.skipped < limiter.offset {
+		row, err := limiter.input.Next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+		limiter.skipped++
+	}
+	row, err := limiter.input.Next()
+	if row != nil {
+		limiter.returned++
+	}
+	return row, err
+}
+
+func (limiter *Limit) Close() {
+	limiter.input.Close()
+}
@@ -0,0 +1,248 @@
+package exec
+
+import (
+	"errors"
+	"godb/table"
+	"strconv"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// The rows of a query, computed lazily by its operators
+type Result struct {
+	// The name and type of the result columns.
+	// The type is nil for columns which are always NULL.
+	Columns []table.ColumnDef
+	root    Operator
+	opened  bool
+	row     table.Row
+	err     error
+}
+
+// A key of a Sort
+type orderKey struct {
+	// Computes the key from the sorted rows
+	expr       valueExpr
+	descending bool
+}
+
+// Plans a SELECT. The rows are read on the first call of Next.
+func Query(catalog Catalog, stmt *sqlparser.Select) (*Result, error) {
+	node, columns, err := buildLogical(catalog, stmt)
+	if err != nil {
+		return nil, err
+	}
+	root, err := planPhysical(catalog, node)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Columns: columns, root: root}, nil
+}
+
+// Reads all rows of a SELECT
+func QueryRows(catalog Catalog, stmt *sqlparser.Select) ([]table.Row, error) {
+	result, err := Query(catalog, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	rows := []table.Row{}
+	for result.Next() {
+		rows = append(rows, result.Row())
+	}
+	return rows, result.Err()
+}
+
+// Advances to the next row, returns false once there are no more rows or an
+// error occurred
+func (result *Result) Next() bool {
+	if result.err != nil {
+		return false
+	}
+	if !result.opened {
+		result.opened = true
+		result.err = result.root.Open()
+		if result.err != nil {
+			return false
+		}
+	}
+	result.row, result.err = result.root.Next()
+	return result.row != nil && result.err == nil
+}
+
+// The current row
+func (result *Result) Row() table.Row {
+	return result.row
+}
+
+func (result *Result) Err() error {
+	return result.err
+}
+
+func (result *Result) Close() {
+	if result.opened {
+		result.root.Close()
+		result.opened = false
+	}
+	result.row = nil
+}
+
+// Returns the offset and limit of a LIMIT clause, -1 as limit if there is
+// none
+func compileLimit(limit *sqlparser.Limit) (int, int, error) {
+	if limit == nil {
+		return 0, -1, nil
+	}
+	offset := 0
+	if limit.Offset != nil {
+		var err error
+		offset, err = limitValue(limit.Offset, "OFFSET")
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	count, err := limitValue(limit.Rowcount, "LIMIT")
+	return offset, count, err
+}
+
+func limitValue(expr sqlparser.Expr, clause string) (int, error) {
+	val, ok := expr.(*sqlparser.SQLVal)
+	if ok && val.Type == sqlparser.IntVal {
+		num, err := strconv.Atoi(string(val.Val))
+		if err == nil && num >= 0 {
+			return num, nil
+		}
+	}
+	return 0, errors.New(clause + " must be a non-negative integer")
+}
+
+// Compiles the keys of ORDER BY, which are computed from the result rows.
+// A key may name an alias of the select list, give the position of a result
+// column or be an expression over the input rows. Expressions are returned
+// separately, as they are computed as hidden columns following the result
+// columns. Expressions found in selected, the positions of the result columns
+// by the SQL of their expressions, use the result column instead.
+func compileOrderBy(orderBy sqlparser.OrderBy, aliases map[string]int, selected map[string]int, columns []table.ColumnDef, scope *exprScope) ([]orderKey, []valueExpr, error) {
+	keys := []orderKey{}
+	hidden := []valueExpr{}
+	for _, order := range orderBy {
+		resultIdx := -1
+		if idx, ok := selected[sqlparser.String(order.Expr)]; ok {
+			resultIdx = idx
+		}
+		switch expr := order.Expr.(type) {
+		case *sqlparser.ColName:
+			if idx, ok := aliases[expr.Name.String()]; ok && expr.Qualifier.IsEmpty() {
+				resultIdx = idx
+			}
+		case *sqlparser.SQLVal:
+			if expr.Type != sqlparser.IntVal {
+				break
+			}
+			position, err := strconv.Atoi(string(expr.Val))
+			if err != nil || position < 1 || position > len(columns) {
+				return nil, nil, errors.New("ORDER BY position " + string(expr.Val) + " is not in the select list")
+			}
+			resultIdx = position - 1
+		}
+
+		key := orderKey{descending: order.Direction == sqlparser.DescScr}
+		if resultIdx >= 0 {
+			key.expr = rowColumn(resultIdx, columns[resultIdx].Type)
+		} else {
+			expr, err := compileValue(order.Expr, scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			hidden = append(hidden, expr)
+			key.expr = rowColumn(len(columns)+len(hidden)-1, expr.Type)
+		}
+		keys = append(keys, key)
+	}
+	return keys, hidden, nil
+}
+
+// Orders two sort rows by their leading keys.
+// NULL is ordered before all other values.
+func compareOrderKeys(a table.Row, b table.Row, keys []orderKey) (int, error) {
+	for i, key := range keys {
+		var cmp int
+		switch {
+		case a[i] == nil && b[i] == nil:
+			cmp = 0
+		case a[i] == nil:
+			cmp = -1
+		case b[i] == nil:
+			cmp = 1
+		default:
+			var err error
+			cmp, err = compareValues(a[i], b[i])
+			if err != nil {
+				return 0, err
+			}
+		}
+		if key.descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+// Compiles the expressions of a select list.
+// Returns the result columns, the expressions computing them, the positions
+// of the aliased columns by alias and the positions of all columns by the SQL
+// of their expression.
+func compileSelectList(selectExprs sqlparser.SelectExprs, scope *exprScope) ([]table.ColumnDef, []valueExpr, map[string]int, map[string]int, error) {
+	columns := []table.ColumnDef{}
+	exprs := []valueExpr{}
+	aliases := make(map[string]int)
+	selected := make(map[string]int)
+	for _, selectExpr := range selectExprs {
+		switch selectExpr := selectExpr.(type) {
+		case *sqlparser.StarExpr:
+			found := false
+			for i, col := range scope.columns {
+				if col.Name == "" || (!selectExpr.TableName.IsEmpty() && selectExpr.TableName.Name.String() != col.Table) {
+					continue
+				}
+				selected[sqlparser.String(&sqlparser.ColName{Name: sqlparser.NewColIdent(col.Name)})] = len(columns)
+				columns = append(columns, table.ColumnDef{Name: col.Name, Type: col.Type})
+				exprs = append(exprs, scope.column(i))
+				found = true
+			}
+			if !found {
+				return nil, nil, nil, nil, errors.New("'" + sqlparser.String(selectExpr) + "' doesn't match any columns")
+			}
+		case *sqlparser.AliasedExpr:
+			expr, err := compileValue(selectExpr.Expr, scope)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if !selectExpr.As.IsEmpty() {
+				aliases[selectExpr.As.String()] = len(columns)
+			}
+			selected[sqlparser.String(selectExpr.Expr)] = len(columns)
+			columns = append(columns, table.ColumnDef{Name: resultColumnName(selectExpr), Type: expr.Type})
+			exprs = append(exprs, expr)
+		default:
+			return nil, nil, nil, nil, errors.New("Expression '" + sqlparser.String(selectExpr) + "' is not supported in the select list")
+		}
+	}
+	return columns, exprs, aliases, selected, nil
+}
+
+// The alias of a select list expression, the column name for a plain column
+// or else the expression's SQL
+func resultColumnName(selectExpr *sqlparser.AliasedExpr) string {
+	if !selectExpr.As.IsEmpty() {
+		return selectExpr.As.String()
+	}
+	if colName, ok := selectExpr.Expr.(*sqlparser.ColName); ok {
+		return colName.Name.String()
+	}
+	return sqlparser.String(selectExpr.Expr)
+}
@@ -0,0 +1,113 @@
+package exec
+
+import (
+	"godb/index"
+	"godb/table"
+)
+
+// A scan of the rows of a table, which also tells where the rows are stored
+type Scan interface {
+	Operator
+	// The location of the last returned row
+	RowId() table.RowId
+}
+
+// Opens a scan over the rows of the access path matching the predicate,
+// which may be nil to select all rows
+func NewScan(tbl *table.Table, path AccessPath, predicate table.Predicate) Scan {
+	if path.Index == nil {
+		return &SeqScan{tbl: tbl, predicate: predicate}
+	}
+	return &IndexScan{tbl: tbl, index: path.Index, lower: path.Lower, upper: path.Upper, predicate: predicate}
+}
+
+// Reads all rows of a table in storage order
+type SeqScan struct {
+	estimate
+	tbl *table.Table
+	// nil to select all rows
+	predicate table.Predicate
+	it        *table.RowIterator
+	rowId     table.RowId
+}
+
+func (scan *SeqScan) Open() error {
+	scan.it = scan.tbl.Scan()
+	return nil
+}
+
+func (scan *SeqScan) Next() (table.Row, error) {
+	for scan.it.Next() {
+		scan.rowId = scan.it.RowId()
+		match, err := matches(scan.predicate, scan.it.Row())
+		if err != nil || match {
+			return scan.it.Row(), err
+		}
+	}
+	return nil, scan.it.Err()
+}
+
+func (scan *SeqScan) RowId() table.RowId {
+	return scan.rowId
+}
+
+func (scan *SeqScan) Close() {
+	if scan.it != nil {
+		scan.it.Close()
+		scan.it = nil
+	}
+}
+
+// Reads the rows of a table in the order of an index, from a lower to an
+// upper bound
+type IndexScan struct {
+	estimate
+	tbl   *table.Table
+	index *index.TableIndex
+	// nil if open
+	lower *index.Bound
+	upper *index.Bound
+	// nil to select all rows
+	predicate table.Predicate
+	it        *index.Iterator
+	rowId     table.RowId
+}
+
+func (scan *IndexScan) Open() error {
+	scan.it = scan.index.Tree.Range(scan.lower, scan.upper)
+	return nil
+}
+
+func (scan *IndexScan) Next() (table.Row, error) {
+	for scan.it.Next() {
+		scan.rowId = scan.it.Entry().RowId
+		row, err := scan.tbl.FetchRow(scan.rowId)
+		if err != nil {
+			return nil, err
+		}
+		match, err := matches(scan.predicate, row)
+		if err != nil || match {
+			return row, err
+		}
+	}
+	return nil, scan.it.Err()
+}
+
+func (scan *IndexScan) RowId() table.RowId {
+	return scan.rowId
+}
+
+func (scan *IndexScan) Close() {
+	if scan.it != nil {
+		scan.it.Close()
+		scan.it = nil
+	}
+}
+
+// Whether the row matches the predicate, which selects all rows if nil
+func matches(predicate table.Predicate, row table.Row) (bool, error) {
+	if predicate == nil {
+		return true, nil
+	}
+	return predicate(row)
+}
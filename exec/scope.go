@@ -0,0 +1,89 @@
+package exec
+
+import (
+	"errors"
+	"godb/table"
+
+	"github.com/SananGuliyev/sqlparser"
+)
+
+// The values of the rows expressions are evaluated on
+type exprScope struct {
+	columns []scopeColumn
+	// Values of the rows computed ahead, like GROUP BY keys and aggregates,
+	// by their SQL. Expressions with the same SQL refer to them.
+	computed map[string]int
+}
+
+type scopeColumn struct {
+	// The table of the column, used to resolve qualified names
+	Table string
+	// Empty for computed values, which can't be referenced by name
+	Name string
+	Type *table.DataType
+}
+
+// The scope of the rows of a table.
+// Its columns are qualified by the alias, if given, or else the table name.
+func tableScope(tbl *table.Table, alias string) *exprScope {
+	if alias == "" {
+		alias = tbl.Name
+	}
+	scope := &exprScope{}
+	for _, col := range tbl.Schema.Columns {
+		scope.columns = append(scope.columns, scopeColumn{Table: alias, Name: col.Name, Type: col.Type})
+	}
+	return scope
+}
+
+// The scope of rows made up of the columns of both scopes
+func joinScopes(left *exprScope, right *exprScope) *exprScope {
+	scope := &exprScope{}
+	scope.columns = append(scope.columns, left.columns...)
+	scope.columns = append(scope.columns, right.columns...)
+	return scope
+}
+
+// Finds the position of a referenced column
+func (scope *exprScope) resolve(colName *sqlparser.ColName) (int, error) {
+	name := colName.Name.String()
+	found := -1
+	for i, col := range scope.columns {
+		if col.Name == "" || col.Name != name {
+			continue
+		}
+		if !colName.Qualifier.IsEmpty() && colName.Qualifier.Name.String() != col.Table {
+			continue
+		}
+		if found >= 0 {
+			return -1, errors.New("Column '" + sqlparser.String(colName) + "' is ambiguous")
+		}
+		found = i
+	}
+	if found < 0 {
+		return -1, errors.New("Column '" + sqlparser.String(colName) + "' not found")
+	}
+	return found, nil
+}
+
+// An expression reading a column of the scope
+func (scope *exprScope) column(colIdx int) valueExpr {
+	return rowColumn(colIdx, scope.columns[colIdx].Type)
+}
+
+// The types of the columns of the scope
+func (scope *exprScope) types() []*table.DataType {
+	columnTypes := make([]*table.DataType, len(scope.columns))
+	for i, col := range scope.columns {
+		columnTypes[i] = col.Type
+	}
+	return columnTypes
+}
+
+// An expression reading a column of the rows
+func rowColumn(colIdx int, colType *table.DataType) valueExpr {
+	return valueExpr{
+		Type: colType,
+		eval: func(row table.Row) (table.ColumnValue, error) { return row[colIdx], nil },
+	}
+}
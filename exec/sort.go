@@ -0,0 +1,518 @@
+package exec
+
+// Rows are sorted in memory as long as they fit into SORT_MEMORY_BUDGET.
+// Larger inputs are sorted in parts which are spilled as sorted runs to a
+// temporary file and merged when the rows are read back.
+// If only the first rows are needed, only these are kept in a heap as long as
+// they fit into memory.
+//
+// The runs are written one after the other to the temporary file. It only
+// holds throwaway data, so it is neither logged nor synced. A run is a
+// stream of records, each an encoded row:
+//
+//	4 bytes: Byte length of the encoded values
+//	For each column
+//	  1 byte:  1 if the value is NULL, 0 otherwise
+//	  n bytes: The encoded value, nothing if it is NULL
+//
+// For EXPLAIN ANALYZE, every page sized block read from or written to the
+// temporary file is counted as a page fetch missing the cache.
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"godb/pager"
+	"godb/table"
+	"io"
+	"os"
+	"sort"
+)
+
+// The number of bytes of rows sorted in memory before they are spilled
+var SORT_MEMORY_BUDGET = 4 * 1024 * 1024
+
+// The directory of the temporary files of spilled runs, empty for the
+// system's default
+var SORT_TEMP_DIR = ""
+
+const runRecordLenLen = 4
+
+// Sorts rows which are added one by one
+type rowSorter struct {
+	// The type of every column of the rows, nil for always NULL columns
+	types   []*table.DataType
+	compare func(a table.Row, b table.Row) (int, error)
+	// The number of first rows needed, -1 for all
+	limit int
+	// The rows not yet spilled and their size.
+	// With a limit, a heap with the last of the first rows on top.
+	rows []table.Row
+	size int
+	runs []sortRun
+	// The temporary file holding the runs, created on the first spill
+	temp *os.File
+	// The number of bytes written to the temporary file
+	tempSize int64
+	// Counts the pages read from and written to the temporary file
+	tempStats *pager.Stats
+	// The first error of compare
+	err error
+}
+
+// A sorted part of the rows stored in the temporary file
+type sortRun struct {
+	offset int64
+	length int64
+	count  int
+}
+
+// Creates a sorter counting its temporary file I/O in tempStats.
+// With a limit other than -1, rows after the first limit rows may be dropped.
+func newRowSorter(types []*table.DataType, compare func(a table.Row, b table.Row) (int, error), limit int,
+	tempStats *pager.Stats) *rowSorter {
+	return &rowSorter{types: types, compare: compare, limit: limit, tempStats: tempStats}
+}
+
+func (sorter *rowSorter) Add(row table.Row) error {
+	if sorter.limit >= 0 {
+		return sorter.addTopN(row)
+	}
+	sorter.rows = append(sorter.rows, row)
+	sorter.size += row.Length() + len(row)
+	if sorter.size > SORT_MEMORY_BUDGET {
+		return sorter.spill()
+	}
+	return nil
+}
+
+// Keeps the row if it is among the first rows
+func (sorter *rowSorter) addTopN(row table.Row) error {
+	topN := (*topNHeap)(sorter)
+	if len(sorter.rows) < sorter.limit {
+		heap.Push(topN, row)
+		sorter.size += row.Length() + len(row)
+	} else if sorter.limit > 0 {
+		cmp, err := sorter.compare(row, sorter.rows[0])
+		if err != nil {
+			return err
+		}
+		if cmp < 0 {
+			sorter.size += row.Length() + len(row) - sorter.rows[0].Length() - len(sorter.rows[0])
+			sorter.rows[0] = row
+			heap.Fix(topN, 0)
+		}
+	}
+	if sorter.err != nil {
+		return sorter.err
+	}
+
+	if sorter.size > SORT_MEMORY_BUDGET {
+		// Too many rows to keep in memory, sort all rows instead
+		sorter.limit = -1
+		return sorter.spill()
+	}
+	return nil
+}
+
+func (sorter *rowSorter) sortInMemory() error {
+	sort.SliceStable(sorter.rows, func(i, j int) bool {
+		cmp, err := sorter.compare(sorter.rows[i], sorter.rows[j])
+		if err != nil && sorter.err == nil {
+			sorter.err = err
+		}
+		return cmp < 0
+	})
+	return sorter.err
+}
+
+// Writes the rows held in memory as a sorted run
+func (sorter *rowSorter) spill() error {
+	err := sorter.sortInMemory()
+	if err != nil {
+		return err
+	}
+
+	if sorter.temp == nil {
+		sorter.temp, err = os.CreateTemp(SORT_TEMP_DIR, "godb-sort-*")
+		if err != nil {
+			return errors.New("Sort failed. Can't create temporary file: " + err.Error())
+		}
+	}
+
+	// Runs are only appended, the file offset stays at the end of the file
+	run := sortRun{offset: sorter.tempSize, count: len(sorter.rows)}
+	writer := bufio.NewWriterSize(&tempFileIO{writer: sorter.temp, stats: sorter.tempStats}, int(pager.PAGE_SIZE))
+	for _, row := range sorter.rows {
+		record := encodeSortRecord(row)
+		_, err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+		run.length += int64(len(record))
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	sorter.tempSize += run.length
+	sorter.runs = append(sorter.runs, run)
+	sorter.rows = nil
+	sorter.size = 0
+	return nil
+}
+
+// Sorts the added rows and returns them in order.
+// No more rows may be added afterwards.
+func (sorter *rowSorter) Sort() (*sortedRows, error) {
+	if len(sorter.runs) == 0 {
+		err := sorter.sortInMemory()
+		if err != nil {
+			return nil, err
+		}
+		return &sortedRows{sorter: sorter, rows: sorter.rows, next: 0}, nil
+	}
+
+	if len(sorter.rows) > 0 {
+		err := sorter.spill()
+		if err != nil {
+			return nil, err
+		}
+	}
+	merge := &runMerge{sorter: sorter}
+	for _, run := range sorter.runs {
+		reader := &runReader{
+			reader: bufio.NewReaderSize(&tempFileIO{
+				reader: io.NewSectionReader(sorter.temp, run.offset, run.length),
+				stats:  sorter.tempStats,
+			}, int(pager.PAGE_SIZE)),
+			types:     sorter.types,
+			remaining: run.count,
+		}
+		if reader.next() {
+			merge.readers = append(merge.readers, reader)
+		} else if reader.err != nil {
+			return nil, reader.err
+		}
+	}
+	heap.Init(merge)
+	if sorter.err != nil {
+		return nil, sorter.err
+	}
+	return &sortedRows{sorter: sorter, merge: merge}, nil
+}
+
+// Removes the temporary file
+func (sorter *rowSorter) Close() {
+	if sorter.temp == nil {
+		return
+	}
+	sorter.temp.Close()
+	os.Remove(sorter.temp.Name())
+	sorter.temp = nil
+}
+
+// Passes reads or writes on to the temporary file, counting the pages
+type tempFileIO struct {
+	reader io.Reader
+	writer io.Writer
+	stats  *pager.Stats
+}
+
+func (temp *tempFileIO) Read(data []byte) (int, error) {
+	n, err := temp.reader.Read(data)
+	temp.count(n)
+	return n, err
+}
+
+func (temp *tempFileIO) Write(data []byte) (int, error) {
+	n, err := temp.writer.Write(data)
+	temp.count(n)
+	return n, err
+}
+
+func (temp *tempFileIO) count(n int) {
+	pages := (int64(n) + pager.PAGE_SIZE - 1) / pager.PAGE_SIZE
+	temp.stats.Fetches += pages
+	temp.stats.CacheMisses += pages
+}
+
+// The pages an operator read from and wrote to temporary files
+type tempPages struct {
+	tempStats pager.Stats
+}
+
+func (pages *tempPages) temporaryPages() *pager.Stats {
+	return &pages.tempStats
+}
+
+func encodeSortRecord(row table.Row) []byte {
+	record := make([]byte, runRecordLenLen, runRecordLenLen+row.Length()+len(row))
+	for _, value := range row {
+		if value == nil {
+			record = append(record, 1)
+			continue
+		}
+		record = append(record, 0)
+		record = append(record, value.Encode()...)
+	}
+	binary.BigEndian.PutUint32(record, uint32(len(record)-runRecordLenLen))
+	return record
+}
+
+func decodeSortRecord(encoded []byte, types []*table.DataType) (table.Row, error) {
+	row := make(table.Row, len(types))
+	offset := 0
+	for i, dataType := range types {
+		if offset >= len(encoded) {
+			return nil, errors.New("Sort failed. Spilled row is truncated")
+		}
+		isNull := encoded[offset] == 1
+		offset++
+		if isNull {
+			continue
+		}
+		if dataType == nil {
+			return nil, errors.New("Sort failed. Value found in a column without type")
+		}
+		value, err := dataType.Decode(encoded[offset:])
+		if err != nil {
+			return nil, err
+		}
+		row[i] = value
+		offset += value.Length()
+	}
+	return row, nil
+}
+
+// Reads the rows of a run, a page at a time
+type runReader struct {
+	reader    *bufio.Reader
+	types     []*table.DataType
+	remaining int
+	row       table.Row
+	err       error
+}
+
+func (reader *runReader) read(length int) ([]byte, error) {
+	data := make([]byte, length)
+	_, err := io.ReadFull(reader.reader, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errors.New("Sort failed. Spilled run is truncated")
+	}
+	return data, err
+}
+
+// Reads the next row of the run, returns false at its end or on errors
+func (reader *runReader) next() bool {
+	if reader.remaining == 0 {
+		return false
+	}
+	reader.remaining--
+
+	lengthBuf, err := reader.read(runRecordLenLen)
+	if err != nil {
+		reader.err = err
+		return false
+	}
+	encoded, err := reader.read(int(binary.BigEndian.Uint32(lengthBuf)))
+	if err != nil {
+		reader.err = err
+		return false
+	}
+	reader.row, reader.err = decodeSortRecord(encoded, reader.types)
+	return reader.err == nil
+}
+
+// The rows of a sorter with a limit as heap, the greatest row on top
+type topNHeap rowSorter
+
+func (topN *topNHeap) Len() int {
+	return len(topN.rows)
+}
+
+func (topN *topNHeap) Less(i int, j int) bool {
+	cmp, err := topN.compare(topN.rows[j], topN.rows[i])
+	if err != nil && topN.err == nil {
+		topN.err = err
+	}
+	return cmp < 0
+}
+
+func (topN *topNHeap) Swap(i int, j int) {
+	topN.rows[i], topN.rows[j] = topN.rows[j], topN.rows[i]
+}
+
+func (topN *topNHeap) Push(row interface{}) {
+	topN.rows = append(topN.rows, row.(table.Row))
+}
+
+func (topN *topNHeap) Pop() interface{} {
+	last := topN.rows[len(topN.rows)-1]
+	topN.rows = topN.rows[:len(topN.rows)-1]
+	return last
+}
+
+// A heap of run readers ordered by their current rows
+type runMerge struct {
+	sorter  *rowSorter
+	readers []*runReader
+}
+
+func (merge *runMerge) Len() int {
+	return len(merge.readers)
+}
+
+func (merge *runMerge) Less(i int, j int) bool {
+	cmp, err := merge.sorter.compare(merge.readers[i].row, merge.readers[j].row)
+	if err != nil && merge.sorter.err == nil {
+		merge.sorter.err = err
+	}
+	return cmp < 0
+}
+
+func (merge *runMerge) Swap(i int, j int) {
+	merge.readers[i], merge.readers[j] = merge.readers[j], merge.readers[i]
+}
+
+func (merge *runMerge) Push(reader interface{}) {
+	merge.readers = append(merge.readers, reader.(*runReader))
+}
+
+func (merge *runMerge) Pop() interface{} {
+	last := merge.readers[len(merge.readers)-1]
+	merge.readers = merge.readers[:len(merge.readers)-1]
+	return last
+}
+
+// The sorted rows, either sorted in memory or merged from runs
+type sortedRows struct {
+	sorter *rowSorter
+	// Set if sorted in memory
+	rows []table.Row
+	next int
+	// Set if merged from runs
+	merge *runMerge
+	row   table.Row
+	err   error
+}
+
+func (sorted *sortedRows) Next() bool {
+	if sorted.err != nil {
+		return false
+	}
+
+	if sorted.merge == nil {
+		if sorted.next == len(sorted.rows) {
+			return false
+		}
+		sorted.row = sorted.rows[sorted.next]
+		sorted.next++
+		return true
+	}
+
+	if sorted.merge.Len() == 0 {
+		return false
+	}
+	reader := sorted.merge.readers[0]
+	sorted.row = reader.row
+	if reader.next() {
+		heap.Fix(sorted.merge, 0)
+	} else if reader.err != nil {
+		sorted.err = reader.err
+		return false
+	} else {
+		heap.Pop(sorted.merge)
+	}
+	if sorted.sorter.err != nil {
+		sorted.err = sorted.sorter.err
+		return false
+	}
+	return true
+}
+
+func (sorted *sortedRows) Row() table.Row {
+	return sorted.row
+}
+
+func (sorted *sortedRows) Err() error {
+	return sorted.err
+}
+
+// Orders the rows of its input by keys computed from them.
+// The input is read completely when the operator is opened.
+type Sort struct {
+	estimate
+	tempPages
+	input Operator
+	keys  []orderKey
+	// The types of the input rows
+	rowTypes []*table.DataType
+	// The number of first rows needed, -1 for all
+	limit  int
+	sorter *rowSorter
+	// Every sorted row is made up of its keys followed by the input row
+	sorted *sortedRows
+}
+
+func newSort(input Operator, keys []orderKey, rowTypes []*table.DataType) *Sort {
+	return &Sort{input: input, keys: keys, rowTypes: rowTypes, limit: -1}
+}
+
+func (sortOp *Sort) Open() error {
+	sortTypes := []*table.DataType{}
+	for _, key := range sortOp.keys {
+		sortTypes = append(sortTypes, key.expr.Type)
+	}
+	sortTypes = append(sortTypes, sortOp.rowTypes...)
+	sortOp.sorter = newRowSorter(sortTypes, func(a table.Row, b table.Row) (int, error) {
+		return compareOrderKeys(a, b, sortOp.keys)
+	}, sortOp.limit, &sortOp.tempStats)
+
+	err := sortOp.input.Open()
+	if err != nil {
+		return err
+	}
+	for {
+		row, err := sortOp.input.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		sortRow := make(table.Row, 0, len(sortOp.keys)+len(row))
+		for _, key := range sortOp.keys {
+			value, err := key.expr.eval(row)
+			if err != nil {
+				return err
+			}
+			sortRow = append(sortRow, value)
+		}
+		err = sortOp.sorter.Add(append(sortRow, row...))
+		if err != nil {
+			return err
+		}
+	}
+
+	sortOp.sorted, err = sortOp.sorter.Sort()
+	return err
+}
+
+func (sortOp *Sort) Next() (table.Row, error) {
+	if !sortOp.sorted.Next() {
+		return nil, sortOp.sorted.Err()
+	}
+	return sortOp.sorted.Row()[len(sortOp.keys):], nil
+}
+
+func (sortOp *Sort) Close() {
+	sortOp.input.Close()
+	if sortOp.sorter != nil {
+		sortOp.sorter.Close()
+		sortOp.sorter = nil
+	}
+	sortOp.sorted = nil
+}
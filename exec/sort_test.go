@@ -0,0 +1,84 @@
+package exec
+
+import (
+	"godb/pager"
+	"godb/table"
+	"godb/table/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExternalSort(t *testing.T) {
+	types.InitializeTypeIds()
+	oldBudget, oldTempDir := SORT_MEMORY_BUDGET, SORT_TEMP_DIR
+	defer func() { SORT_MEMORY_BUDGET, SORT_TEMP_DIR = oldBudget, oldTempDir }()
+	// Runs of a few rows, with values larger than a page
+	SORT_MEMORY_BUDGET = 20000
+	SORT_TEMP_DIR = t.TempDir()
+
+	keys := []orderKey{{descending: true}, {}}
+	tempStats := &pager.Stats{}
+	sorter := newRowSorter([]*table.DataType{types.TypeLong, types.TypeString},
+		func(a table.Row, b table.Row) (int, error) { return compareOrderKeys(a, b, keys) }, -1, tempStats)
+	defer sorter.Close()
+
+	count := 1000
+	for i := 0; i < count; i++ {
+		var value table.ColumnValue
+		if i%7 != 0 {
+			value = types.String(strconv.Itoa(i) + strings.Repeat("x", i%3*3000))
+		}
+		err := sorter.Add(table.Row{types.Long(i % 10), value})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sorter.runs) < 2 {
+		t.Fatal("Sorter didn't spill, only", len(sorter.runs), "runs")
+	}
+	files, _ := filepath.Glob(filepath.Join(SORT_TEMP_DIR, "godb-sort-*"))
+	if len(files) != 1 {
+		t.Error("Expected one temporary file without log, found", files)
+	}
+
+	sorted, err := sorter.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var previous table.Row
+	read := 0
+	for sorted.Next() {
+		row := sorted.Row()
+		if previous != nil {
+			cmp, err := compareOrderKeys(previous, row, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cmp > 0 {
+				t.Fatal("Rows out of order", previous[0], previous[1], row[0], row[1])
+			}
+		}
+		previous = row
+		read++
+	}
+	if sorted.Err() != nil {
+		t.Fatal(sorted.Err())
+	}
+	if read != count {
+		t.Error("Sorter returned", read, "rows instead of", count)
+	}
+	// Every run was written and read again
+	if tempStats.Fetches < 2*int64(len(sorter.runs)) || tempStats.CacheMisses != tempStats.Fetches {
+		t.Error("Unexpected temporary file pages", *tempStats)
+	}
+
+	sorter.Close()
+	for _, file := range files {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Error("Temporary file", file, "was not removed")
+		}
+	}
+}
@@ -4,4 +4,4 @@ go 1.17
 
 require golang.org/x/sys v0.0.0-20211003122950-b1ebd4e1001c
 
-require github.com/SananGuliyev/sqlparser v1.1.0 // indirect
+require github.com/SananGuliyev/sqlparser v1.1.0
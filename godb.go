@@ -0,0 +1,149 @@
+// Package godb embeds a godb database in a program.
+//
+//	db, err := godb.Open("data.db", nil)
+//	...
+//	rows, err := db.Query("SELECT name FROM Users WHERE id = ?", 1)
+//	for rows.Next() {
+//		name := rows.Values()[0]
+//	}
+//	err = rows.Err()
+//	rows.Close()
+//
+// A DB isn't safe for concurrent use. Programs sharing a database between
+// goroutines can use the database/sql driver of the godb/driver package.
+package godb
+
+import (
+	"godb/engine"
+	"godb/exec"
+	"godb/pager"
+	"godb/table/types"
+	"os"
+)
+
+func init() {
+	types.InitializeTypeIds()
+}
+
+type Options struct {
+	// Replaces an existing database file with a new, empty database
+	New bool
+}
+
+type DB struct {
+	db *engine.Database
+}
+
+// Opens the database stored in the given file, creating it if it doesn't
+// exist. The options may be nil.
+func Open(path string, opts *Options) (*DB, error) {
+	if opts != nil && opts.New {
+		os.Remove(path)
+		os.Remove(path + pager.WAL_SUFFIX)
+	}
+	db, err := engine.OpenDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// Runs a statement, binding the arguments to its ? placeholders.
+// Returns the number of rows changed by INSERT and DELETE, -1 for other
+// statements.
+func (db *DB) Exec(sql string, args ...interface{}) (int64, error) {
+	result, affected, err := db.execute(sql, args)
+	if result != nil {
+		result.Close()
+	}
+	return affected, err
+}
+
+// Runs a query, binding the arguments to its ? placeholders. Statements
+// other than queries return no columns and no rows.
+func (db *DB) Query(sql string, args ...interface{}) (*Rows, error) {
+	result, affected, err := db.execute(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	rows := &Rows{RowsAffected: affected, result: result}
+	if result != nil {
+		for _, col := range result.Columns {
+			column := Column{Name: col.Name}
+			if col.Type != nil {
+				column.Type = col.Type.Name
+			}
+			rows.Columns = append(rows.Columns, column)
+		}
+	}
+	return rows, nil
+}
+
+func (db *DB) execute(sql string, args []interface{}) (*exec.Result, int64, error) {
+	sql, err := engine.BindArguments(sql, args)
+	if err != nil {
+		return nil, -1, err
+	}
+	return db.db.Execute(sql)
+}
+
+// Rolls back a transaction still in progress and closes the database file
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+type Column struct {
+	Name string
+	// The name of the type, like LONG or STRING. Empty for columns which
+	// are always NULL.
+	Type string
+}
+
+// The rows of a query, read one at a time.
+// Rows have to be closed before the next statement runs.
+type Rows struct {
+	// Nil for statements other than queries
+	Columns []Column
+	// The number of rows changed by INSERT and DELETE, -1 for other statements
+	RowsAffected int64
+	result       *exec.Result
+}
+
+// Advances to the next row, returns false once there are no more rows or an
+// error occurred
+func (rows *Rows) Next() bool {
+	return rows.result != nil && rows.result.Next()
+}
+
+// The values of the current row: int64 for LONG columns, string for STRING
+// columns and nil for NULL. Values of the catalog's internal types are
+// returned as their text.
+func (rows *Rows) Values() []interface{} {
+	row := rows.result.Row()
+	values := make([]interface{}, len(row))
+	for i, value := range row {
+		switch value := value.(type) {
+		case types.Long:
+			values[i] = int64(value)
+		case types.String:
+			values[i] = string(value)
+		case nil:
+		default:
+			values[i] = value.String()
+		}
+	}
+	return values
+}
+
+func (rows *Rows) Err() error {
+	if rows.result == nil {
+		return nil
+	}
+	return rows.result.Err()
+}
+
+func (rows *Rows) Close() {
+	if rows.result != nil {
+		rows.result.Close()
+	}
+}
@@ -0,0 +1,76 @@
+package godb_test
+
+import (
+	"godb"
+	"godb/pager"
+	"os"
+	"testing"
+)
+
+const TEST_FILE = "test.db"
+
+func TestDB(t *testing.T) {
+	db, err := godb.Open(TEST_FILE, &godb.Options{New: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Close()
+		os.Remove(TEST_FILE)
+		os.Remove(TEST_FILE + pager.WAL_SUFFIX)
+	}()
+
+	affected, err := db.Exec("CREATE TABLE Users (id INT PRIMARY KEY, name TEXT)")
+	if err != nil || affected != -1 {
+		t.Fatal("Create table affected", affected, "rows", err)
+	}
+	affected, err = db.Exec("INSERT INTO Users VALUES (?, ?), (?, ?)", 1, "Ann", 2, nil)
+	if err != nil || affected != 2 {
+		t.Fatal("Insert affected", affected, "rows", err)
+	}
+
+	rows, err := db.Query("SELECT id, name, id * 2, NULL FROM Users WHERE id >= ? ORDER BY id", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedColumns := []godb.Column{{"id", "LONG"}, {"name", "STRING"}, {"id * 2", "LONG"}, {"null", ""}}
+	if len(rows.Columns) != len(expectedColumns) {
+		t.Fatal("Unexpected columns", rows.Columns)
+	}
+	for i, col := range rows.Columns {
+		if col != expectedColumns[i] {
+			t.Error("Column", col, "instead of", expectedColumns[i])
+		}
+	}
+	expectedRows := [][]interface{}{{int64(1), "Ann", int64(2), nil}, {int64(2), nil, int64(4), nil}}
+	count := 0
+	for rows.Next() {
+		for i, value := range rows.Values() {
+			if value != expectedRows[count][i] {
+				t.Errorf("Row %d has %#v instead of %#v", count, value, expectedRows[count][i])
+			}
+		}
+		count++
+	}
+	if rows.Err() != nil {
+		t.Fatal(rows.Err())
+	}
+	rows.Close()
+	if count != 2 {
+		t.Error("Query returned", count, "rows instead of 2")
+	}
+
+	rows, err = db.Query("DELETE FROM Users WHERE id = ?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows.Columns != nil || rows.Next() || rows.RowsAffected != 1 {
+		t.Error("Unexpected result of DELETE", rows.Columns, rows.RowsAffected)
+	}
+	rows.Close()
+
+	_, err = db.Exec("INSERT INTO Users VALUES (?, ?)", 3, 1.5)
+	if err == nil {
+		t.Error("Float argument accepted")
+	}
+}
@@ -0,0 +1,504 @@
+// A B+tree stored in pages of the pager.
+// It maps keys, made up of one or more column values, to the locations of the
+// rows holding these values.
+//
+// Keys don't have to be unique, entries are ordered by key first and row
+// location second, which makes every entry unique and allows deleting the
+// entry of a specific row.
+//
+// Inner nodes hold separator entries and child page indices, leaves hold the
+// actual entries and form a singly linked list for range scans.
+// The root always stays at the same page, when it is split its contents are
+// moved into two new pages instead.
+// Deleting entries never merges nodes, leaves simply become sparse.
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"godb/pager"
+	"godb/table"
+)
+
+type BTree struct {
+	Pager       *pager.Pager
+	RootPageIdx int64
+	// The types of the key columns, needed to decode keys
+	KeyTypes []*table.DataType
+}
+
+type nodeHeader struct {
+	IsLeaf bool
+	Count  int16
+	// Leaves: page index of the next leaf, -1 for the last one.
+	// Inner nodes: page index of the rightmost child.
+	Next int64
+}
+
+var nodeHeaderSize = binary.Size(nodeHeader{})
+var rowIdSize = binary.Size(table.RowId{})
+
+// An index entry
+type Entry struct {
+	Key   table.Row
+	RowId table.RowId
+}
+
+// A node decoded into memory
+type node struct {
+	page   *pager.Page
+	isLeaf bool
+	// Sorted entries. Separators in inner nodes.
+	entries []Entry
+	// Inner nodes only, children[i] holds all entries less than entries[i].
+	// There is always one child more than there are entries.
+	children []int64
+	// Leaves only
+	next int64
+}
+
+// Creates a new empty tree
+func Create(p *pager.Pager, keyTypes []*table.DataType) (*BTree, error) {
+	p.BeginOperation()
+	defer p.EndOperation()
+	page, err := p.AllocatePage()
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &BTree{
+		Pager:       p,
+		RootPageIdx: page.Index,
+		KeyTypes:    keyTypes,
+	}
+
+	root := &node{page: page, isLeaf: true, next: -1}
+	err = tree.writeNode(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// Opens an existing tree given its root page
+func Open(p *pager.Pager, rootPageIdx int64, keyTypes []*table.DataType) *BTree {
+	return &BTree{
+		Pager:       p,
+		RootPageIdx: rootPageIdx,
+		KeyTypes:    keyTypes,
+	}
+}
+
+// Frees all pages of the tree.
+// The tree must not be used afterwards.
+func (tree *BTree) Drop() error {
+	tree.Pager.BeginOperation()
+	defer tree.Pager.EndOperation()
+	return tree.dropNode(tree.RootPageIdx)
+}
+
+func (tree *BTree) dropNode(pageIdx int64) error {
+	n, err := tree.readNode(pageIdx)
+	if err != nil {
+		return err
+	}
+	for _, child := range n.children {
+		err = tree.dropNode(child)
+		if err != nil {
+			return err
+		}
+	}
+	return tree.Pager.FreePage(pageIdx)
+}
+
+// Compares two keys column by column.
+// Only the columns both keys have are compared, so a shorter key matches all
+// keys it is a prefix of.
+// Returns a negative number if a < b, 0 if equal and a positive one if a > b.
+func CompareKeys(a table.Row, b table.Row) (int, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		// ColumnValue.Compare returns the order of the argument relative to the receiver
+		cmp, err := b[i].Compare(a[i])
+		if err != nil {
+			return 0, err
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+func compareRowIds(a table.RowId, b table.RowId) int {
+	if a.PageIdx != b.PageIdx {
+		if a.PageIdx < b.PageIdx {
+			return -1
+		}
+		return 1
+	}
+	if a.Slot != b.Slot {
+		if a.Slot < b.Slot {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func compareEntries(a Entry, b Entry) (int, error) {
+	cmp, err := CompareKeys(a.Key, b.Key)
+	if err != nil || cmp != 0 {
+		return cmp, err
+	}
+	return compareRowIds(a.RowId, b.RowId), nil
+}
+
+func (tree *BTree) entryLength(entry Entry) int {
+	return entry.Key.Length() + rowIdSize
+}
+
+// The number of bytes the node takes up when encoded
+func (tree *BTree) nodeLength(n *node) int {
+	length := nodeHeaderSize
+	for _, entry := range n.entries {
+		length += tree.entryLength(entry)
+		if !n.isLeaf {
+			length += 8 // Child page index
+		}
+	}
+	return length
+}
+
+func (tree *BTree) readNode(pageIdx int64) (*node, error) {
+	page, err := tree.Pager.FetchPage(pageIdx)
+	if err != nil {
+		return nil, err
+	}
+
+	var header nodeHeader
+	binary.Read(bytes.NewReader(page.Memory[:nodeHeaderSize]), binary.BigEndian, &header)
+
+	n := &node{
+		page:    page,
+		isLeaf:  header.IsLeaf,
+		entries: make([]Entry, header.Count),
+	}
+	if !n.isLeaf {
+		n.children = make([]int64, header.Count+1)
+		n.children[header.Count] = header.Next
+	} else {
+		n.next = header.Next
+	}
+
+	offset := nodeHeaderSize
+	for i := range n.entries {
+		if !n.isLeaf {
+			n.children[i] = int64(binary.BigEndian.Uint64(page.Memory[offset:]))
+			offset += 8
+		}
+
+		key := make(table.Row, len(tree.KeyTypes))
+		for col, keyType := range tree.KeyTypes {
+			val, err := keyType.Decode(page.Memory[offset:])
+			if err != nil {
+				return nil, err
+			}
+			key[col] = val
+			offset += val.Length()
+		}
+
+		var rowId table.RowId
+		binary.Read(bytes.NewReader(page.Memory[offset:offset+rowIdSize]), binary.BigEndian, &rowId)
+		offset += rowIdSize
+
+		n.entries[i] = Entry{Key: key, RowId: rowId}
+	}
+
+	return n, nil
+}
+
+// Encodes the node into its page and flushes it.
+// The node must fit into the page.
+func (tree *BTree) writeNode(n *node) error {
+	header := nodeHeader{
+		IsLeaf: n.isLeaf,
+		Count:  int16(len(n.entries)),
+		Next:   n.next,
+	}
+	if !n.isLeaf {
+		header.Next = n.children[len(n.entries)]
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, header)
+	for i, entry := range n.entries {
+		if !n.isLeaf {
+			binary.Write(&buf, binary.BigEndian, n.children[i])
+		}
+		for _, col := range entry.Key {
+			buf.Write(col.Encode())
+		}
+		binary.Write(&buf, binary.BigEndian, entry.RowId)
+	}
+
+	if int64(buf.Len()) > pager.PAGE_SIZE {
+		return errors.New("Index node overflows its page")
+	}
+	copy(n.page.Memory, buf.Bytes())
+
+	return n.page.Flush()
+}
+
+// The index of the first entry greater than the probe.
+// For inner nodes this is also the index of the child to descend into.
+func searchNode(n *node, probe func(Entry) (int, error)) (int, error) {
+	low, high := 0, len(n.entries)
+	for low < high {
+		mid := (low + high) / 2
+		cmp, err := probe(n.entries[mid])
+		if err != nil {
+			return 0, err
+		}
+		if cmp < 0 {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low, nil
+}
+
+func exactProbe(target Entry) func(Entry) (int, error) {
+	return func(entry Entry) (int, error) {
+		return compareEntries(target, entry)
+	}
+}
+
+func (tree *BTree) checkKey(key table.Row) error {
+	if len(key) != len(tree.KeyTypes) {
+		return errors.New("Key has the wrong number of columns")
+	}
+	for i, col := range key {
+		if col.Type() != tree.KeyTypes[i] {
+			return errors.New("Key doesn't match the index column types")
+		}
+	}
+	// At least four entries have to fit into a node for splits to work
+	if nodeHeaderSize+4*(key.Length()+rowIdSize+8) > int(pager.PAGE_SIZE) {
+		return errors.New("Key too large for index")
+	}
+	return nil
+}
+
+func (tree *BTree) Insert(key table.Row, rowId table.RowId) error {
+	tree.Pager.BeginOperation()
+	defer tree.Pager.EndOperation()
+	err := tree.checkKey(key)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{Key: key, RowId: rowId}
+	separator, rightPageIdx, split, err := tree.insert(tree.RootPageIdx, entry)
+	if err != nil || !split {
+		return err
+	}
+
+	// The root was split.
+	// Its left half was written to the root page, move it to a new page, so
+	// the root can become the parent of both halves.
+	root, err := tree.readNode(tree.RootPageIdx)
+	if err != nil {
+		return err
+	}
+	leftPage, err := tree.Pager.AllocatePage()
+	if err != nil {
+		return err
+	}
+	left := &node{
+		page:     leftPage,
+		isLeaf:   root.isLeaf,
+		entries:  root.entries,
+		children: root.children,
+		next:     root.next,
+	}
+	err = tree.writeNode(left)
+	if err != nil {
+		return err
+	}
+
+	root.isLeaf = false
+	root.entries = []Entry{separator}
+	root.children = []int64{leftPage.Index, rightPageIdx}
+	root.next = 0
+	return tree.writeNode(root)
+}
+
+// Inserts the entry into the subtree starting at the given page.
+// If the node had to be split, the separator and the page of the new right
+// sibling are returned.
+func (tree *BTree) insert(pageIdx int64, entry Entry) (Entry, int64, bool, error) {
+	n, err := tree.readNode(pageIdx)
+	if err != nil {
+		return Entry{}, -1, false, err
+	}
+
+	pos, err := searchNode(n, exactProbe(entry))
+	if err != nil {
+		return Entry{}, -1, false, err
+	}
+
+	if n.isLeaf {
+		if pos > 0 {
+			cmp, err := compareEntries(n.entries[pos-1], entry)
+			if err != nil {
+				return Entry{}, -1, false, err
+			}
+			if cmp == 0 {
+				return Entry{}, -1, false, errors.New("Index entry already exists")
+			}
+		}
+		n.entries = append(n.entries, Entry{})
+		copy(n.entries[pos+1:], n.entries[pos:])
+		n.entries[pos] = entry
+	} else {
+		separator, rightPageIdx, split, err := tree.insert(n.children[pos], entry)
+		if err != nil || !split {
+			return Entry{}, -1, false, err
+		}
+		n.entries = append(n.entries, Entry{})
+		copy(n.entries[pos+1:], n.entries[pos:])
+		n.entries[pos] = separator
+		n.children = append(n.children, 0)
+		copy(n.children[pos+2:], n.children[pos+1:])
+		n.children[pos+1] = rightPageIdx
+	}
+
+	if tree.nodeLength(n) <= int(pager.PAGE_SIZE) {
+		return Entry{}, -1, false, tree.writeNode(n)
+	}
+
+	return tree.split(n)
+}
+
+// Splits an overflowing node in two.
+// The left half stays in the node's page.
+func (tree *BTree) split(n *node) (Entry, int64, bool, error) {
+	rightPage, err := tree.Pager.AllocatePage()
+	if err != nil {
+		return Entry{}, -1, false, err
+	}
+
+	mid := tree.splitPoint(n)
+	right := &node{page: rightPage, isLeaf: n.isLeaf}
+	var separator Entry
+	if n.isLeaf {
+		// The separator is copied, the entry has to stay in the leaf
+		separator = n.entries[mid]
+		right.entries = append([]Entry{}, n.entries[mid:]...)
+		right.next = n.next
+		n.entries = n.entries[:mid]
+		n.next = rightPage.Index
+	} else {
+		// The separator moves up
+		separator = n.entries[mid]
+		right.entries = append([]Entry{}, n.entries[mid+1:]...)
+		right.children = append([]int64{}, n.children[mid+1:]...)
+		n.entries = n.entries[:mid]
+		n.children = n.children[:mid+1]
+	}
+
+	err = tree.writeNode(right)
+	if err != nil {
+		return Entry{}, -1, false, err
+	}
+	err = tree.writeNode(n)
+	if err != nil {
+		return Entry{}, -1, false, err
+	}
+
+	return separator, rightPage.Index, true, nil
+}
+
+// Finds the entry index at which the node is split, so both halves take up
+// about the same number of bytes
+func (tree *BTree) splitPoint(n *node) int {
+	total := tree.nodeLength(n)
+	length := nodeHeaderSize
+	mid := 0
+	for mid < len(n.entries)-1 && length < total/2 {
+		length += tree.entryLength(n.entries[mid])
+		if !n.isLeaf {
+			length += 8
+		}
+		mid++
+	}
+	if mid == 0 {
+		mid = 1
+	}
+	return mid
+}
+
+// Removes the entry of the given row
+func (tree *BTree) Delete(key table.Row, rowId table.RowId) error {
+	tree.Pager.BeginOperation()
+	defer tree.Pager.EndOperation()
+	entry := Entry{Key: key, RowId: rowId}
+	n, err := tree.findLeaf(exactProbe(entry))
+	if err != nil {
+		return err
+	}
+
+	pos, err := searchNode(n, exactProbe(entry))
+	if err != nil {
+		return err
+	}
+	if pos == 0 {
+		return errors.New("Index entry not found")
+	}
+	cmp, err := compareEntries(n.entries[pos-1], entry)
+	if err != nil {
+		return err
+	}
+	if cmp != 0 {
+		return errors.New("Index entry not found")
+	}
+
+	n.entries = append(n.entries[:pos-1], n.entries[pos:]...)
+	return tree.writeNode(n)
+}
+
+// Descends to the leaf the probe leads to
+func (tree *BTree) findLeaf(probe func(Entry) (int, error)) (*node, error) {
+	n, err := tree.readNode(tree.RootPageIdx)
+	if err != nil {
+		return nil, err
+	}
+	for !n.isLeaf {
+		pos, err := searchNode(n, probe)
+		if err != nil {
+			return nil, err
+		}
+		n, err = tree.readNode(n.children[pos])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Returns the locations of all rows with the given key.
+// The key may be a prefix of the index columns.
+func (tree *BTree) Search(key table.Row) ([]table.RowId, error) {
+	bound := &Bound{Key: key, Inclusive: true}
+	it := tree.Range(bound, bound)
+	defer it.Close()
+
+	rowIds := []table.RowId{}
+	for it.Next() {
+		rowIds = append(rowIds, it.Entry().RowId)
+	}
+	return rowIds, it.Err()
+}
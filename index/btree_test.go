@@ -0,0 +1,108 @@
+package index_test
+
+import (
+	"godb/index"
+	"godb/pager"
+	"godb/table"
+	"godb/table/types"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+)
+
+const TEST_FILE = "test.db"
+
+func openTestTree(t *testing.T) *index.BTree {
+	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + pager.WAL_SUFFIX)
+	p, err := pager.OpenPager(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := index.Create(p, []*table.DataType{types.TypeLong, types.TypeString})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func closeTestTree(tree *index.BTree) {
+	tree.Pager.Close()
+	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + pager.WAL_SUFFIX)
+}
+
+func key(i int) table.Row {
+	return table.Row{types.Long(i / 2), types.String("value " + strconv.Itoa(i))}
+}
+
+func TestBTree(t *testing.T) {
+	tree := openTestTree(t)
+	defer closeTestTree(tree)
+
+	const count = 2000
+	for _, i := range rand.New(rand.NewSource(1)).Perm(count) {
+		err := tree.Insert(key(i), table.RowId{PageIdx: int64(i), Slot: 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := tree.Insert(key(5), table.RowId{PageIdx: 5, Slot: 0})
+	if err == nil {
+		t.Error("Duplicate entry inserted")
+	}
+
+	// Prefix search, two entries per first column value
+	rowIds, err := tree.Search(table.Row{types.Long(21)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowIds) != 2 || rowIds[0].PageIdx != 42 || rowIds[1].PageIdx != 43 {
+		t.Error("Wrong search result", rowIds)
+	}
+
+	// Full scan returns all entries in order
+	it := tree.Range(nil, nil)
+	n := 0
+	var prev table.Row
+	for it.Next() {
+		if prev != nil {
+			cmp, _ := index.CompareKeys(prev, it.Entry().Key)
+			if cmp > 0 {
+				t.Fatal("Entries out of order")
+			}
+		}
+		prev = it.Entry().Key
+		n++
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if n != count {
+		t.Error("Full scan returned", n, "entries")
+	}
+
+	// Delete every even entry and scan a range
+	for i := 0; i < count; i += 2 {
+		err := tree.Delete(key(i), table.RowId{PageIdx: int64(i), Slot: 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	it = tree.Range(
+		&index.Bound{Key: table.Row{types.Long(100)}, Inclusive: false},
+		&index.Bound{Key: table.Row{types.Long(200)}, Inclusive: true},
+	)
+	n = 0
+	for it.Next() {
+		if it.Entry().RowId.PageIdx%2 == 0 {
+			t.Error("Deleted entry returned")
+		}
+		n++
+	}
+	if n != 100 {
+		t.Error("Range scan returned", n, "entries")
+	}
+}
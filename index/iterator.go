@@ -0,0 +1,103 @@
+package index
+
+import "godb/table"
+
+// A bound of a range scan
+type Bound struct {
+	// May be a prefix of the index columns
+	Key       table.Row
+	Inclusive bool
+}
+
+// Iterates over the entries of a key range in key order
+type Iterator struct {
+	tree  *BTree
+	upper *Bound
+	// The leaf currently iterated over
+	leaf *node
+	// The position of the next entry in the leaf
+	pos   int
+	entry Entry
+	err   error
+	done  bool
+}
+
+// Returns an iterator over all entries between lower and upper.
+// A nil bound leaves that side of the range open.
+func (tree *BTree) Range(lower *Bound, upper *Bound) *Iterator {
+	it := &Iterator{tree: tree, upper: upper}
+
+	probe := func(entry Entry) (int, error) { return -1, nil }
+	if lower != nil {
+		probe = func(entry Entry) (int, error) {
+			cmp, err := CompareKeys(lower.Key, entry.Key)
+			if err != nil || cmp != 0 {
+				return cmp, err
+			}
+			// Equal keys are part of the range only if the bound is inclusive
+			if lower.Inclusive {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	it.leaf, it.err = tree.findLeaf(probe)
+	if it.err != nil {
+		return it
+	}
+	it.pos, it.err = searchNode(it.leaf, probe)
+	return it
+}
+
+// Advances to the next entry, returns false once the range is exhausted or
+// an error occurred.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.done {
+		return false
+	}
+
+	// Skip to the next leaf holding entries
+	for it.pos >= len(it.leaf.entries) {
+		if it.leaf.next < 0 {
+			it.done = true
+			return false
+		}
+		it.leaf, it.err = it.tree.readNode(it.leaf.next)
+		if it.err != nil {
+			return false
+		}
+		it.pos = 0
+	}
+
+	entry := it.leaf.entries[it.pos]
+	if it.upper != nil {
+		cmp, err := CompareKeys(entry.Key, it.upper.Key)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if cmp > 0 || (cmp == 0 && !it.upper.Inclusive) {
+			it.done = true
+			return false
+		}
+	}
+
+	it.entry = entry
+	it.pos++
+	return true
+}
+
+// The current entry
+func (it *Iterator) Entry() Entry {
+	return it.entry
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Close() {
+	it.done = true
+	it.leaf = nil
+}
@@ -0,0 +1,26 @@
+package index
+
+import "godb/table"
+
+// An index over one or more columns of a table.
+// Every modification of the table is applied to all of its indexes.
+type TableIndex struct {
+	Name      string
+	TableName string
+	Columns   []string
+	Unique    bool
+	Tree      *BTree
+}
+
+// Extracts the index key from a row of the indexed table
+func (idx *TableIndex) Key(tbl *table.Table, row table.Row) (table.Row, error) {
+	key := make(table.Row, len(idx.Columns))
+	for i, column := range idx.Columns {
+		_, colIdx, err := tbl.Schema.FindColumnByName(column)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = row[colIdx]
+	}
+	return key, nil
+}
@@ -9,7 +9,11 @@ type Cache interface {
 	// Request a page from cache, nil if there was no hit
 	Get(int64) *Page
 	Add(*Page) int64
+	// Drop a page from cache without writing it anywhere
+	Remove(int64)
 }
 
-// The maximum number of pages kept in cache
+// The maximum number of pages kept in cache.
+// Pages used by a running transaction or operation are never replaced, so the
+// cache can temporarily grow beyond this.
 var CACHE_SIZE = 32
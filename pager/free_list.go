@@ -0,0 +1,73 @@
+package pager
+
+// Pages that are no longer used form the free list, a singly linked list
+// starting at the page referenced by the file header.
+// New pages are taken from this list before the file is extended.
+//
+// The layout of a free page is as follows:
+//   8 bytes: Page index of the next free page, -1 for the last one
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Returns an empty page, reusing a free page if there is one
+func (pager *Pager) AllocatePage() (*Page, error) {
+	pager.BeginOperation()
+	defer pager.EndOperation()
+
+	header, err := pager.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+	if header.FreeListHead < 0 {
+		return pager.AppendPage()
+	}
+
+	page, err := pager.FetchPage(header.FreeListHead)
+	if err != nil {
+		return nil, err
+	}
+
+	header.FreeListHead = int64(binary.BigEndian.Uint64(page.Memory))
+	header.FreePageCount--
+	err = pager.WriteHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Memory {
+		page.Memory[i] = 0
+	}
+	return page, page.Flush()
+}
+
+// Adds a page that is no longer used to the free list.
+// Its contents are lost.
+func (pager *Pager) FreePage(pageIdx int64) error {
+	if pageIdx == HEADER_PAGE_IDX {
+		return errors.New("FreePage failed. The header page can't be freed")
+	}
+	pager.BeginOperation()
+	defer pager.EndOperation()
+
+	header, err := pager.ReadHeader()
+	if err != nil {
+		return err
+	}
+
+	page, err := pager.FetchPage(pageIdx)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(page.Memory, uint64(header.FreeListHead))
+	err = page.Flush()
+	if err != nil {
+		return err
+	}
+
+	header.FreeListHead = pageIdx
+	header.FreePageCount++
+	return pager.WriteHeader(header)
+}
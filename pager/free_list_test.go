@@ -0,0 +1,114 @@
+package pager
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFreeList(t *testing.T) {
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+
+	pager, err := OpenPager(WAL_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Memory[100] = 1
+	second.Flush()
+
+	err = pager.FreePage(first.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pager.FreePage(second.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The free list survives reopening the file
+	pager.Close()
+	pager, err = OpenPager(WAL_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := pager.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.FreeListHead != second.Index || header.FreePageCount != 2 {
+		t.Errorf("Unexpected free list %+v", header)
+	}
+
+	// Free pages are reused last freed first and handed out empty
+	page, err := pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Index != second.Index || page.Memory[100] != 0 {
+		t.Error("Freed page not reused")
+	}
+	page, err = pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Index != first.Index {
+		t.Error("Freed page not reused")
+	}
+	page, err = pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Index != second.Index+1 {
+		t.Error("File not extended once the free list is empty")
+	}
+
+	if pager.FreePage(HEADER_PAGE_IDX) == nil {
+		t.Error("Header page freed")
+	}
+
+	// Pages appended by a rolled back transaction are cut off the file
+	pageCount, err := pager.pageCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pager.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		page, err = pager.AllocatePage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.Memory[100] = 1
+		page.Flush()
+	}
+	err = pager.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := pager.pageCount(); count != pageCount {
+		t.Error("File has", count, "pages after rollback instead of", pageCount)
+	}
+	page, err = pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Index != pageCount || page.Memory[100] != 0 {
+		t.Error("Page of rolled back transaction not reused")
+	}
+
+	pager.Close()
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+}
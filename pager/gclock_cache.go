@@ -30,28 +30,43 @@ func (gc *GclockCache) Get(idx int64) *Page {
 	}
 }
 
+// Whether there is any page which may be replaced.
+// Pinned pages must stay mapped until their transaction ends.
+func (gc *GclockCache) hasReplaceablePage() bool {
+	for _, entry := range gc.Pages {
+		if !entry.Page.pinned {
+			return true
+		}
+	}
+	return false
+}
+
 func (gc *GclockCache) findPageToReplace() (int, int64) {
 	for {
 		if len(gc.Pages) <= gc.SearchIndex {
 			gc.SearchIndex = 0
 		}
+		if gc.Pages[gc.SearchIndex].Page.pinned {
+			gc.SearchIndex++
+			continue
+		}
 		gc.Pages[gc.SearchIndex].ReferenceCounter--
 		if gc.Pages[gc.SearchIndex].ReferenceCounter <= 0 {
 			replacementIdx := gc.SearchIndex
 
 			// Increment once more so the newly cached page isn't the first candidate next time
 			gc.SearchIndex++
-			gc.SearchIndex %= CACHE_SIZE
+			gc.SearchIndex %= len(gc.Pages)
 
 			return replacementIdx, gc.Pages[replacementIdx].Page.Index
 		}
 		gc.SearchIndex++
-		gc.SearchIndex %= CACHE_SIZE
+		gc.SearchIndex %= len(gc.Pages)
 	}
 }
 
 func (gc *GclockCache) Add(page *Page) int64 {
-	if len(gc.PageIdxMapping) >= CACHE_SIZE {
+	if len(gc.PageIdxMapping) >= CACHE_SIZE && gc.hasReplaceablePage() {
 		// Cache is full, uncache
 		cacheIdx, pageIdx := gc.findPageToReplace()
 
@@ -75,3 +90,21 @@ func (gc *GclockCache) Add(page *Page) int64 {
 
 	return page.Index
 }
+
+func (gc *GclockCache) Remove(idx int64) {
+	cacheIdx, hit := gc.PageIdxMapping[idx]
+	if !hit {
+		return
+	}
+
+	unix.Munmap(gc.Pages[cacheIdx].Page.Memory)
+
+	// Move the last entry into the freed slot
+	lastIdx := len(gc.Pages) - 1
+	if cacheIdx != lastIdx {
+		gc.Pages[cacheIdx] = gc.Pages[lastIdx]
+		gc.PageIdxMapping[gc.Pages[cacheIdx].Page.Index] = cacheIdx
+	}
+	gc.Pages = gc.Pages[:lastIdx]
+	delete(gc.PageIdxMapping, idx)
+}
@@ -3,6 +3,7 @@ package pager
 import "testing"
 
 func TestGclockCache(t *testing.T) {
+	defer func(cacheSize int) { CACHE_SIZE = cacheSize }(CACHE_SIZE)
 	CACHE_SIZE = 2
 	cache := NewGclockCache()
 
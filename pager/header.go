@@ -0,0 +1,125 @@
+package pager
+
+// Page 0 of every database file is the file header.
+// It identifies the file and the format it was written in and holds the
+// metadata needed to find everything else in the file.
+// The header is validated when the file is opened, files written in another
+// format or with another page size are refused.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+const HEADER_MAGIC = uint32(0x676f6462) // "godb"
+
+// The version of the on-disk format.
+// Incremented on every incompatible change of the file layout.
+//
+// Versions:
+//
+//	1: Initial format
+//	2: Column constraints and defaults stored in schemas, NULL values
+//	3: LONG values stored as fixed 8 bytes instead of varints, which didn't
+//	   fit values of 2^55 and more
+const FORMAT_VERSION = uint32(3)
+
+// The index of the page holding the file header
+const HEADER_PAGE_IDX = int64(0)
+
+type FileHeader struct {
+	Magic         uint32
+	FormatVersion uint32
+	PageSize      int64
+	// Incremented by every committed transaction
+	ChangeCounter uint64
+	// The first page of the free list, -1 if it is empty
+	FreeListHead int64
+	// The number of pages in the free list
+	FreePageCount int64
+	// The root page of the catalog of the database stored in this file,
+	// -1 until the catalog is created
+	CatalogRootIdx int64
+}
+
+var fileHeaderSize = binary.Size(FileHeader{})
+
+// Writes the header of a new, empty database file
+func (pager *Pager) initHeader() error {
+	page, err := pager.AppendPage()
+	if err != nil {
+		return err
+	}
+	if page.Index != HEADER_PAGE_IDX {
+		return errors.New("Header page is not the first page of the file")
+	}
+	return pager.WriteHeader(FileHeader{
+		Magic:          HEADER_MAGIC,
+		FormatVersion:  FORMAT_VERSION,
+		PageSize:       PAGE_SIZE,
+		FreeListHead:   -1,
+		CatalogRootIdx: -1,
+	})
+}
+
+// Checks that the file is a database file this pager is able to read
+func (pager *Pager) checkHeader() error {
+	buffer := make([]byte, fileHeaderSize)
+	_, err := pager.File.ReadAt(buffer, 0)
+	if err != nil {
+		return errors.New("Open failed. File is too short to be a database file")
+	}
+
+	var header FileHeader
+	binary.Read(bytes.NewReader(buffer), binary.BigEndian, &header)
+
+	if header.Magic != HEADER_MAGIC {
+		return errors.New("Open failed. File is not a database file")
+	}
+	if header.FormatVersion != FORMAT_VERSION {
+		return errors.New("Open failed. File has format version " +
+			strconv.FormatUint(uint64(header.FormatVersion), 10) + ", expected version " +
+			strconv.FormatUint(uint64(FORMAT_VERSION), 10))
+	}
+	if header.PageSize != PAGE_SIZE {
+		return errors.New("Open failed. File was written with a page size of " +
+			strconv.FormatInt(header.PageSize, 10) + " bytes, this system uses " +
+			strconv.FormatInt(PAGE_SIZE, 10) + " bytes")
+	}
+
+	fileInfo, err := pager.File.Stat()
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size()%PAGE_SIZE != 0 {
+		return errors.New("Open failed. File size is not a multiple of the page size")
+	}
+	return nil
+}
+
+// Reads the file header.
+// It is always read from its page, so rolled back changes are never visible.
+func (pager *Pager) ReadHeader() (FileHeader, error) {
+	var header FileHeader
+	page, err := pager.FetchPage(HEADER_PAGE_IDX)
+	if err != nil {
+		return header, err
+	}
+	err = binary.Read(bytes.NewReader(page.Memory), binary.BigEndian, &header)
+	return header, err
+}
+
+func (pager *Pager) WriteHeader(header FileHeader) error {
+	page, err := pager.FetchPage(HEADER_PAGE_IDX)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, header)
+	copy(page.Memory, buf.Bytes())
+
+	return page.Flush()
+}
@@ -0,0 +1,67 @@
+package pager
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+
+	pager, err := OpenPager(WAL_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := pager.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Magic != HEADER_MAGIC || header.FormatVersion != FORMAT_VERSION || header.PageSize != PAGE_SIZE {
+		t.Errorf("Unexpected header %+v", header)
+	}
+	if header.FreeListHead != -1 || header.CatalogRootIdx != -1 {
+		t.Errorf("Unexpected header %+v", header)
+	}
+
+	// Every commit increments the change counter
+	page, err := pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Memory[0] = 1
+	page.Flush()
+	newHeader, err := pager.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newHeader.ChangeCounter <= header.ChangeCounter {
+		t.Error("Change counter not incremented by commit")
+	}
+	pager.Close()
+
+	// Files of another format version are refused
+	file, err := os.OpenFile(WAL_TEST_FILE, os.O_RDWR, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := make([]byte, 4)
+	binary.BigEndian.PutUint32(version, FORMAT_VERSION+1)
+	file.WriteAt(version, 4)
+	file.Close()
+	_, err = OpenPager(WAL_TEST_FILE)
+	if err == nil {
+		t.Error("File of another format version opened")
+	}
+
+	// So are files that aren't database files at all
+	os.WriteFile(WAL_TEST_FILE, []byte("not a database"), 0755)
+	_, err = OpenPager(WAL_TEST_FILE)
+	if err == nil {
+		t.Error("Invalid file opened")
+	}
+
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+}
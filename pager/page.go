@@ -1,9 +1,8 @@
 package pager
 
 import (
+	"errors"
 	"os"
-
-	"golang.org/x/sys/unix"
 )
 
 var PAGE_SIZE = int64(os.Getpagesize())
@@ -13,8 +12,22 @@ type Page struct {
 	Index int64
 	// The memory memory mapped buffer
 	Memory []byte
+	// The pager this page belongs to
+	pager *Pager
+	// Whether the page was modified by the running transaction
+	dirty bool
+	// Whether the page was used by the running transaction or operations.
+	// Pinned pages are never replaced in cache, as they may still hold
+	// references to their memory.
+	pinned bool
 }
 
+// Hands the modified page to the pager.
+// Outside of a transaction the page is committed to the write-ahead log right
+// away, inside of one it is committed together with the transaction.
 func (page *Page) Flush() error {
-	return unix.Msync(page.Memory, unix.MS_SYNC)
+	if page.pager == nil {
+		return errors.New("Page doesn't belong to a pager")
+	}
+	return page.pager.flushPage(page)
 }
@@ -2,29 +2,91 @@
 // The Pager is responsible for adressing these, mapping them from disk into
 // memory when needed, caching these mappings for efficient use and writing
 // the modified pages back to disk.
+//
+// Pages are mapped privately, so modifications never reach the database file
+// directly. Modified pages are first committed to the write-ahead log and only
+// copied into the database file by a checkpoint.
 package pager
 
 import (
 	"errors"
 	"os"
+	"sort"
 
 	"golang.org/x/sys/unix"
 )
 
+// The suffix appended to the database filename to get the log filename
+const WAL_SUFFIX = "-wal"
+
 type Pager struct {
 	Cache Cache
 	File  *os.File
+	Wal   *Wal
+	// Pages modified by the running transaction.
+	// nil if there is no transaction running.
+	dirtyPages map[int64]*Page
+	// Pages used by the running transaction or operations
+	pinnedPages []*Page
+	// The number of running operations, see BeginOperation
+	operations int
+	// The number of pages in the file when the running transaction began.
+	// Pages appended since are cut off again on rollback.
+	beginPageCount int64
+	// Counts the calls of FetchPage
+	Stats Stats
+}
+
+// The number of fetched pages and how many of them were found in cache
+type Stats struct {
+	Fetches     int64
+	CacheHits   int64
+	CacheMisses int64
 }
 
+// Opens the database file and its write-ahead log.
+// Committed transactions found in the log are recovered and folded back into
+// the database file.
 func OpenPager(filename string) (*Pager, error) {
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0755)
 	if err != nil {
 		return nil, err
 	}
-	return &Pager{
+
+	wal, err := OpenWal(filename + WAL_SUFFIX)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	pager := &Pager{
 		Cache: NewGclockCache(),
 		File:  file,
-	}, nil
+		Wal:   wal,
+	}
+
+	err = pager.Checkpoint()
+	if err != nil {
+		pager.Close()
+		return nil, err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		pager.Close()
+		return nil, err
+	}
+	if fileInfo.Size() == 0 {
+		err = pager.initHeader()
+	} else {
+		err = pager.checkHeader()
+	}
+	if err != nil {
+		pager.Close()
+		return nil, err
+	}
+
+	return pager, nil
 }
 
 func (pager *Pager) mapPageToMemory(pageIdx int64) (*Page, error) {
@@ -38,49 +100,92 @@ func (pager *Pager) mapPageToMemory(pageIdx int64) (*Page, error) {
 	if fileInfo.Size() < PAGE_SIZE*(pageIdx+1)-1 {
 		return nil, errors.New("Page idx out of range")
 	}
-	buffer, err := unix.Mmap(int(pager.File.Fd()), pageIdx*PAGE_SIZE, int(PAGE_SIZE), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	buffer, err := unix.Mmap(int(pager.File.Fd()), pageIdx*PAGE_SIZE, int(PAGE_SIZE), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE)
 	if err != nil {
 		return nil, err
 	}
+
+	// The log holds newer versions than the database file
+	_, err = pager.Wal.ReadPage(pageIdx, buffer)
+	if err != nil {
+		unix.Munmap(buffer)
+		return nil, err
+	}
+
 	page := &Page{
 		Index:  pageIdx,
 		Memory: buffer,
+		pager:  pager,
 	}
 	return page, nil
 }
 
 // Maps a page into memory if it isn't already and returns it
 func (pager *Pager) FetchPage(pageIdx int64) (*Page, error) {
+	pager.Stats.Fetches++
 	// Try and get page from cache
 	page := pager.Cache.Get(pageIdx)
 	if page != nil {
-		return page, nil
+		pager.Stats.CacheHits++
+	} else {
+		pager.Stats.CacheMisses++
+		// Page not in cache. Map page into memory.
+		var err error
+		page, err = pager.mapPageToMemory(pageIdx)
+		if err != nil {
+			return nil, err
+		}
+
+		// Add cache entry
+		pager.Cache.Add(page)
 	}
 
-	// Page not in cache. Map page into memory.
-	page, err := pager.mapPageToMemory(pageIdx)
-	if err != nil {
-		return nil, err
+	pager.pin(page)
+	return page, nil
+}
+
+// Keeps the page from being replaced in cache until the running transaction
+// and operations end
+func (pager *Pager) pin(page *Page) {
+	if (pager.InTransaction() || pager.operations > 0) && !page.pinned {
+		page.pinned = true
+		pager.pinnedPages = append(pager.pinnedPages, page)
 	}
+}
 
-	// Add cache entry
-	pager.Cache.Add(page)
+// Allows the pinned pages to be replaced in cache again once neither a
+// transaction nor an operation uses them
+func (pager *Pager) unpinPages() {
+	if pager.InTransaction() || pager.operations > 0 {
+		return
+	}
+	for _, page := range pager.pinnedPages {
+		page.pinned = false
+	}
+	pager.pinnedPages = nil
+}
 
-	return page, nil
+// Starts an operation, which keeps all pages it fetches mapped until it ends.
+// Replacing a page in cache unmaps its memory, so pages are only safe to use
+// inside of an operation or a transaction. Operations may be nested.
+func (pager *Pager) BeginOperation() {
+	pager.operations++
+}
+
+func (pager *Pager) EndOperation() {
+	pager.operations--
+	pager.unpinPages()
 }
 
+// Extends the file by an empty page.
+// Use AllocatePage to reuse free pages first.
 func (pager *Pager) AppendPage() (*Page, error) {
-	fileInfo, err := pager.File.Stat()
+	pageCount, err := pager.pageCount()
 	if err != nil {
 		return nil, err
 	}
-	fileSize := fileInfo.Size()
-	if fileSize%PAGE_SIZE != 0 {
-		return nil, errors.New("File size is not a multiple of page size")
-	}
-	pageCount := fileSize / PAGE_SIZE
 	buffer := make([]byte, PAGE_SIZE)
-	_, err = pager.File.WriteAt(buffer, fileSize)
+	_, err = pager.File.WriteAt(buffer, pageCount*PAGE_SIZE)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +193,148 @@ func (pager *Pager) AppendPage() (*Page, error) {
 	return page, err
 }
 
-func (pager *Pager) Close() {
-	pager.File.Close()
+// The number of pages in the database file
+func (pager *Pager) pageCount() (int64, error) {
+	fileInfo, err := pager.File.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fileInfo.Size()%PAGE_SIZE != 0 {
+		return 0, errors.New("File size is not a multiple of page size")
+	}
+	return fileInfo.Size() / PAGE_SIZE, nil
+}
+
+// Starts a transaction.
+// All pages flushed until Commit or Rollback are committed atomically.
+func (pager *Pager) Begin() error {
+	if pager.InTransaction() {
+		return errors.New("Begin failed. A transaction is already running")
+	}
+	pageCount, err := pager.pageCount()
+	if err != nil {
+		return err
+	}
+	pager.beginPageCount = pageCount
+	pager.dirtyPages = make(map[int64]*Page)
+	return nil
+}
+
+func (pager *Pager) InTransaction() bool {
+	return pager.dirtyPages != nil
+}
+
+// Writes all pages modified by the transaction to the log
+func (pager *Pager) Commit() error {
+	if !pager.InTransaction() {
+		return errors.New("Commit failed. No transaction running")
+	}
+
+	if len(pager.dirtyPages) > 0 {
+		header, err := pager.ReadHeader()
+		if err != nil {
+			return err
+		}
+		header.ChangeCounter++
+		err = pager.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	pages := make([]*Page, 0, len(pager.dirtyPages))
+	for _, page := range pager.dirtyPages {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+
+	err := pager.Wal.WriteTransaction(pages)
+	if err != nil {
+		return err
+	}
+
+	for _, page := range pages {
+		page.dirty = false
+	}
+	pager.dirtyPages = nil
+	pager.unpinPages()
+
+	if pager.Wal.FrameCount() >= WAL_AUTOCHECKPOINT {
+		return pager.Checkpoint()
+	}
+	return nil
+}
+
+// Discards all modifications made by the transaction.
+// Modified pages are dropped from the cache, so they are mapped again from
+// their last committed version on the next fetch. Pages appended by the
+// transaction are cut off the file.
+func (pager *Pager) Rollback() error {
+	if !pager.InTransaction() {
+		return errors.New("Rollback failed. No transaction running")
+	}
+
+	for pageIdx, page := range pager.dirtyPages {
+		page.dirty = false
+		pager.Cache.Remove(pageIdx)
+	}
+	pager.dirtyPages = nil
+	pager.unpinPages()
+
+	pageCount, err := pager.pageCount()
+	if err != nil {
+		return err
+	}
+	for pageIdx := pager.beginPageCount; pageIdx < pageCount; pageIdx++ {
+		pager.Cache.Remove(pageIdx)
+	}
+	return pager.File.Truncate(pager.beginPageCount * PAGE_SIZE)
+}
+
+func (pager *Pager) flushPage(page *Page) error {
+	if pager.InTransaction() {
+		page.dirty = true
+		pager.dirtyPages[page.Index] = page
+		pager.pin(page)
+		return nil
+	}
+
+	// Autocommit
+	err := pager.Begin()
+	if err != nil {
+		return err
+	}
+	err = pager.flushPage(page)
+	if err != nil {
+		pager.Rollback()
+		return err
+	}
+	return pager.Commit()
+}
+
+// Folds the write-ahead log back into the database file
+func (pager *Pager) Checkpoint() error {
+	if pager.InTransaction() {
+		return errors.New("Checkpoint failed. A transaction is running")
+	}
+	return pager.Wal.Checkpoint(pager.File)
+}
+
+// Rolls back a running transaction, folds the log back into the database
+// file and closes both. Returns the first error, but always closes the files.
+func (pager *Pager) Close() error {
+	var err error
+	if pager.InTransaction() {
+		err = pager.Rollback()
+	}
+	if checkpointErr := pager.Checkpoint(); err == nil {
+		err = checkpointErr
+	}
+	if walErr := pager.Wal.Close(); err == nil {
+		err = walErr
+	}
+	if fileErr := pager.File.Close(); err == nil {
+		err = fileErr
+	}
+	return err
 }
@@ -11,12 +11,14 @@ const TEST_FILE = "test.db"
 
 func TestPager(t *testing.T) {
 	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + "-wal")
 	pager, err := pager.OpenPager(TEST_FILE)
 	if err != nil {
 		t.Error(err)
 	}
 
-	_, err = pager.FetchPage(0)
+	// Only the header page exists in a new file
+	_, err = pager.FetchPage(1)
 	if err == nil {
 		t.Error(errors.New("No error when fetching out of range"))
 	}
@@ -47,16 +49,65 @@ func TestPager(t *testing.T) {
 
 	page.Flush()
 
+	// Flushed pages only reach the database file through a checkpoint
+	err = pager.Checkpoint()
+	if err != nil {
+		t.Error(err)
+	}
+
 	buf, err := os.ReadFile(TEST_FILE)
 	if err != nil {
 		t.Error(err)
 	}
 
-	if buf[0] != 255 {
+	if buf[page.Index*int64(len(page.Memory))] != 255 {
 		t.Error(errors.New("Data not written to disk correctly"))
 	}
 
 	pager.Close()
 
 	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + "-wal")
+}
+
+func TestOperationPinsPages(t *testing.T) {
+	defer func(cacheSize int) { pager.CACHE_SIZE = cacheSize }(pager.CACHE_SIZE)
+	pager.CACHE_SIZE = 4
+	os.Remove(TEST_FILE)
+	os.Remove(TEST_FILE + "-wal")
+	defer os.Remove(TEST_FILE)
+	defer os.Remove(TEST_FILE + "-wal")
+	p, err := pager.OpenPager(TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// Without a transaction, pages are only pinned by the operation
+	p.BeginOperation()
+	held, err := p.AppendPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	held.Memory[0] = 42
+	for i := 0; i < 3*pager.CACHE_SIZE; i++ {
+		_, err = p.AppendPage()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Cache.Get(held.Index) != held || held.Memory[0] != 42 {
+		t.Fatal("Page used by the operation was replaced in cache")
+	}
+	p.EndOperation()
+
+	for i := 0; i < 10*pager.CACHE_SIZE; i++ {
+		_, err = p.AppendPage()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Cache.Get(held.Index) == held {
+		t.Error("Page still pinned after the operation ended")
+	}
 }
@@ -0,0 +1,291 @@
+package pager
+
+// The write-ahead log (WAL) keeps modified pages out of the database file
+// until they are known to be durable.
+// Every committed transaction appends one frame per modified page to the log,
+// the last frame of a transaction carries the commit flag.
+// While a page has frames in the log, the latest committed frame is the
+// authoritative version of that page.
+// A checkpoint copies these latest versions back into the database file and
+// resets the log.
+//
+// The log file layout is as follows:
+//   walHeader
+// For each frame
+//   walFrameHeader
+//   PAGE_SIZE bytes page image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+)
+
+const WAL_MAGIC = uint32(0x676f6477) // "godw"
+const WAL_VERSION = uint32(1)
+
+// The number of frames after which a commit triggers a checkpoint
+var WAL_AUTOCHECKPOINT = 1000
+
+const WAL_FRAME_COMMIT = uint32(1)
+
+type walHeader struct {
+	Magic    uint32
+	Version  uint32
+	PageSize int64
+	// Random value changed on every reset.
+	// Frames with a different salt are left over from before the reset.
+	Salt uint64
+}
+
+type walFrameHeader struct {
+	PageIdx int64
+	TxId    uint64
+	Flags   uint32
+	// CRC32 of the salt, the other header fields and the page image
+	Checksum uint32
+}
+
+var walHeaderSize = int64(binary.Size(walHeader{}))
+var walFrameHeaderSize = int64(binary.Size(walFrameHeader{}))
+
+type Wal struct {
+	File   *os.File
+	header walHeader
+	// Maps PageIdx -> offset of the latest committed frame image of the page
+	index map[int64]int64
+	// The offset at which the next frame will be written
+	end int64
+	// The id of the last committed transaction
+	lastTxId uint64
+}
+
+// Opens the log file and recovers all committed frames from it.
+// Frames of transactions without a commit frame are discarded.
+func OpenWal(filename string) (*Wal, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	wal := &Wal{
+		File:  file,
+		index: make(map[int64]int64),
+	}
+
+	err = wal.recover()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return wal, nil
+}
+
+// Reads the header and scans all frames, building the index of committed pages.
+// The log is truncated after the last committed frame.
+func (wal *Wal) recover() error {
+	fileInfo, err := wal.File.Stat()
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size() < walHeaderSize {
+		// New or incomplete log. Nothing can have been committed yet.
+		return wal.reset()
+	}
+
+	headerBuf := make([]byte, walHeaderSize)
+	_, err = wal.File.ReadAt(headerBuf, 0)
+	if err != nil {
+		return err
+	}
+	binary.Read(bytes.NewReader(headerBuf), binary.BigEndian, &wal.header)
+	if wal.header.Magic != WAL_MAGIC {
+		return errors.New("WAL recovery failed. File is not a write-ahead log")
+	}
+	if wal.header.Version != WAL_VERSION {
+		return errors.New("WAL recovery failed. Unsupported log version")
+	}
+	if wal.header.PageSize != PAGE_SIZE {
+		return errors.New("WAL recovery failed. Log was written with a different page size")
+	}
+
+	// Frames of the transaction currently being read.
+	// Only merged into the index once the commit frame is found.
+	pending := make(map[int64]int64)
+	offset := walHeaderSize
+	wal.end = walHeaderSize
+	frameBuf := make([]byte, walFrameHeaderSize+PAGE_SIZE)
+	for {
+		_, err := wal.File.ReadAt(frameBuf, offset)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		frameHeader, ok := wal.decodeFrame(frameBuf)
+		if !ok {
+			// Torn or stale frame, the log ends here
+			break
+		}
+
+		pending[frameHeader.PageIdx] = offset + walFrameHeaderSize
+		offset += walFrameHeaderSize + PAGE_SIZE
+
+		if frameHeader.Flags&WAL_FRAME_COMMIT != 0 {
+			for pageIdx, imageOffset := range pending {
+				wal.index[pageIdx] = imageOffset
+			}
+			pending = make(map[int64]int64)
+			wal.end = offset
+			wal.lastTxId = frameHeader.TxId
+		}
+	}
+
+	return wal.File.Truncate(wal.end)
+}
+
+// Decodes a frame and verifies its checksum
+func (wal *Wal) decodeFrame(frameBuf []byte) (walFrameHeader, bool) {
+	var frameHeader walFrameHeader
+	binary.Read(bytes.NewReader(frameBuf[:walFrameHeaderSize]), binary.BigEndian, &frameHeader)
+	checksum := wal.checksum(frameHeader, frameBuf[walFrameHeaderSize:])
+	return frameHeader, checksum == frameHeader.Checksum
+}
+
+func (wal *Wal) checksum(frameHeader walFrameHeader, image []byte) uint32 {
+	frameHeader.Checksum = 0
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, wal.header.Salt)
+	binary.Write(&buf, binary.BigEndian, frameHeader)
+	checksum := crc32.ChecksumIEEE(buf.Bytes())
+	return crc32.Update(checksum, crc32.IEEETable, image)
+}
+
+// Empties the log and writes a fresh header
+func (wal *Wal) reset() error {
+	wal.header = walHeader{
+		Magic:    WAL_MAGIC,
+		Version:  WAL_VERSION,
+		PageSize: PAGE_SIZE,
+		Salt:     rand.New(rand.NewSource(time.Now().UnixNano())).Uint64(),
+	}
+
+	err := wal.File.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, wal.header)
+	_, err = wal.File.WriteAt(buf.Bytes(), 0)
+	if err != nil {
+		return err
+	}
+
+	wal.index = make(map[int64]int64)
+	wal.end = walHeaderSize
+	return wal.File.Sync()
+}
+
+// Appends the given pages as a single transaction and syncs the log.
+// Once this returns without error the pages are durable.
+func (wal *Wal) WriteTransaction(pages []*Page) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	txId := wal.lastTxId + 1
+	var buf bytes.Buffer
+	for i, page := range pages {
+		frameHeader := walFrameHeader{
+			PageIdx: page.Index,
+			TxId:    txId,
+		}
+		if i == len(pages)-1 {
+			frameHeader.Flags |= WAL_FRAME_COMMIT
+		}
+		frameHeader.Checksum = wal.checksum(frameHeader, page.Memory)
+
+		binary.Write(&buf, binary.BigEndian, frameHeader)
+		buf.Write(page.Memory)
+	}
+
+	_, err := wal.File.WriteAt(buf.Bytes(), wal.end)
+	if err != nil {
+		return err
+	}
+	err = wal.File.Sync()
+	if err != nil {
+		return err
+	}
+
+	// Only visible once durable
+	for i, page := range pages {
+		wal.index[page.Index] = wal.end + int64(i)*(walFrameHeaderSize+PAGE_SIZE) + walFrameHeaderSize
+	}
+	wal.end += int64(buf.Len())
+	wal.lastTxId = txId
+
+	return nil
+}
+
+// Copies the latest committed image of the page into the buffer.
+// Returns false if the page has no frame in the log.
+func (wal *Wal) ReadPage(pageIdx int64, buffer []byte) (bool, error) {
+	imageOffset, ok := wal.index[pageIdx]
+	if !ok {
+		return false, nil
+	}
+	_, err := wal.File.ReadAt(buffer[:PAGE_SIZE], imageOffset)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// The number of frames currently in the log
+func (wal *Wal) FrameCount() int {
+	return int((wal.end - walHeaderSize) / (walFrameHeaderSize + PAGE_SIZE))
+}
+
+// Writes the latest committed version of every logged page into the database
+// file and resets the log.
+func (wal *Wal) Checkpoint(dbFile *os.File) error {
+	pageIndices := make([]int64, 0, len(wal.index))
+	for pageIdx := range wal.index {
+		pageIndices = append(pageIndices, pageIdx)
+	}
+	sort.Slice(pageIndices, func(i, j int) bool { return pageIndices[i] < pageIndices[j] })
+
+	buffer := make([]byte, PAGE_SIZE)
+	for _, pageIdx := range pageIndices {
+		_, err := wal.ReadPage(pageIdx, buffer)
+		if err != nil {
+			return err
+		}
+		_, err = dbFile.WriteAt(buffer, pageIdx*PAGE_SIZE)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The database file must be durable before the log is discarded
+	err := dbFile.Sync()
+	if err != nil {
+		return err
+	}
+
+	return wal.reset()
+}
+
+func (wal *Wal) Close() error {
+	return wal.File.Close()
+}
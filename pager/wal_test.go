@@ -0,0 +1,119 @@
+package pager
+
+import (
+	"os"
+	"testing"
+)
+
+const WAL_TEST_FILE = "wal_test.db"
+
+// Closes the files without checkpointing, as if the process had crashed
+func crash(pager *Pager) {
+	pager.Wal.Close()
+	pager.File.Close()
+}
+
+func TestWalRecovery(t *testing.T) {
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+
+	pager, err := OpenPager(WAL_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	committed, err := pager.AppendPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncommitted, err := pager.AppendPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	committed.Memory[0] = 1
+	err = committed.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pager.Begin()
+	uncommitted.Memory[0] = 2
+	uncommitted.Flush()
+
+	buf, err := os.ReadFile(WAL_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf[committed.Index*PAGE_SIZE] != 0 {
+		t.Error("Page written to database file before checkpoint")
+	}
+
+	crash(pager)
+
+	pager, err = OpenPager(WAL_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := pager.FetchPage(committed.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Memory[0] != 1 {
+		t.Error("Committed page not recovered")
+	}
+
+	page, err = pager.FetchPage(uncommitted.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Memory[0] != 0 {
+		t.Error("Uncommitted page recovered")
+	}
+
+	if pager.Wal.FrameCount() != 0 {
+		t.Error("Log not checkpointed after recovery")
+	}
+
+	pager.Close()
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+}
+
+func TestRollback(t *testing.T) {
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+
+	pager, err := OpenPager(WAL_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := pager.AppendPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Memory[0] = 1
+	page.Flush()
+
+	pager.Begin()
+	page.Memory[0] = 2
+	page.Flush()
+	err = pager.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = pager.FetchPage(page.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Memory[0] != 1 {
+		t.Error("Rolled back modification still visible")
+	}
+
+	pager.Close()
+	os.Remove(WAL_TEST_FILE)
+	os.Remove(WAL_TEST_FILE + WAL_SUFFIX)
+}
@@ -4,15 +4,15 @@ package table
 // A data page always belongs to a single table.
 // The data pages of a table form a doubly linked list so the rows can be
 // traversed without an index.
-// TODO: Data pages keep track of whether they have available space and the ones
-// that do form a singly linked list (free list) to make finding a place for
-// new data more efficient.
+// The space available on each data page is tracked in the table's free space
+// map to make finding a place for new data more efficient.
 
 import (
 	"bytes"
 	"encoding/binary"
 	"errors"
 	"godb/pager"
+	"sort"
 )
 
 // The ratio of space unavailable to inserts.
@@ -34,6 +34,44 @@ type DataPageHeader struct {
 	// The offset of the last non-free byte.
 	// Increases as more row data is added at the end.
 	FreeSpaceEnd int16
+
+	// The position of this page in the table's free space map
+	FreeSpaceOrdinal int64
+	// The free space category last recorded in the free space map
+	FreeSpaceCategory uint8
+}
+
+// Flags of a row pointer
+const (
+	// The entry only holds the RowId of the location the row was moved to,
+	// because it outgrew its page
+	ROW_FORWARDED = uint8(1)
+	// The entry holds a row moved here from another page.
+	// It is only reachable through the forwarding entry at its home location.
+	ROW_MOVED_IN = uint8(2)
+)
+
+// Locates a row on its page
+type RowPointer struct {
+	// Negative if not in use
+	Offset int16
+	// The byte length of the row
+	Length int16
+	Flags  uint8
+}
+
+var rowPointerSize = int16(binary.Size(RowPointer{}))
+
+// Entries are never shorter than a forwarding entry, so every row can be
+// replaced by one in place.
+var MinEntryLength = binary.Size(RowId{})
+
+// The number of bytes reserved for an entry of the given length
+func entryLength(requiredSpace int) int {
+	if requiredSpace < MinEntryLength {
+		return MinEntryLength
+	}
+	return requiredSpace
 }
 
 // A page used for storing actual data
@@ -42,9 +80,10 @@ type DataPage struct {
 	page *pager.Page
 	// Fixed length header
 	Header DataPageHeader
-	// The offsets of the rows on this page.
-	// Negative if not in use.
-	RowPointers []int16
+	// The locations of the rows on this page.
+	// Pointers of deleted rows stay in place as tombstones, so the slots of
+	// the other rows don't change.
+	RowPointers []RowPointer
 }
 
 func (dataPage *DataPage) Flush() error {
@@ -67,56 +106,161 @@ func (page *DataPage) encodePage() *pager.Page {
 	return page.page
 }
 
-// Returns a byte slice with beginning with the entry at the given index.
-// The slice will extend to the end of the page as entry length isn't known.
+// Returns the byte slice of the entry at the given index
 func (page *DataPage) GetEntry(entryIdx int16) ([]byte, error) {
-	if entryIdx >= page.Header.RowPointersLength {
+	if entryIdx < 0 || entryIdx >= page.Header.RowPointersLength {
 		return nil, errors.New("Entry index out of range")
 	}
 
-	offset := page.RowPointers[entryIdx]
-	if offset < 0 { // Pointer not in use
+	rowPointer := page.RowPointers[entryIdx]
+	if rowPointer.Offset < 0 { // Pointer not in use
 		return nil, errors.New("Entry index empty")
 	}
 
-	return page.page.Memory[offset:], nil
+	return page.page.Memory[rowPointer.Offset : rowPointer.Offset+rowPointer.Length], nil
 }
 
 // Finds or creates an available RowPointer
 func (dpage *DataPage) findAvailableRowPointer() int {
 	for i := int16(0); i < dpage.Header.RowPointersLength; i++ {
 		rowPointer := dpage.RowPointers[i]
-		if rowPointer < 0 { // Available
+		if rowPointer.Offset < 0 { // Available
 			return int(i)
 		}
 	}
 
 	// Add new row pointer
-	dpage.RowPointers = append(dpage.RowPointers, -1)
+	dpage.RowPointers = append(dpage.RowPointers, RowPointer{Offset: -1})
 	// Adjust FreeSpaceStart
-	dpage.Header.FreeSpaceStart += 4
+	dpage.Header.FreeSpaceStart += rowPointerSize
 	dpage.Header.RowPointersLength++
 	return len(dpage.RowPointers) - 1
 }
 
+// The length of the largest entry that can be inserted into an empty page
+func MaxEntryLength() int {
+	return int(pager.PAGE_SIZE) - binary.Size(DataPageHeader{}) - int(DataPageFreeSpace) - int(rowPointerSize) - 1
+}
+
 // Checks how much space is available for insert
 func (dpage *DataPage) AvailableSpace() int {
 	freeSpace := dpage.Header.FreeSpaceEnd - dpage.Header.FreeSpaceStart
 	insertAvailableSpace := freeSpace - DataPageFreeSpace
-	return int(insertAvailableSpace)
+	// A new entry may need a new row pointer
+	return int(insertAvailableSpace - rowPointerSize)
 }
 
 // Finds a free entry and **marks it as used!**
 // Receives the length required for the new entry.
-func (dpage *DataPage) FindFreeEntry(requiredSpace int) ([]byte, error) {
+// Returns the index of the row pointer and the buffer for the entry.
+func (dpage *DataPage) FindFreeEntry(requiredSpace int) (int16, []byte, error) {
+	requiredSpace = entryLength(requiredSpace)
 	if dpage.AvailableSpace() < requiredSpace {
-		return nil, errors.New("No available space left on page")
+		return -1, nil, errors.New("No available space left on page")
 	}
 
 	rowPointerIdx := dpage.findAvailableRowPointer()
 	rowStart := dpage.Header.FreeSpaceEnd - int16(requiredSpace) - 1
-	dpage.RowPointers[rowPointerIdx] = rowStart
+	dpage.RowPointers[rowPointerIdx] = RowPointer{Offset: rowStart, Length: int16(requiredSpace)}
+	dpage.Header.FreeSpaceEnd = rowStart
+
+	return int16(rowPointerIdx), dpage.page.Memory[rowStart : int(rowStart)+requiredSpace], nil
+}
+
+// The space left between the row pointers and the row data, including the
+// space reserved for growing entries
+func (dpage *DataPage) FreeSpace() int {
+	return int(dpage.Header.FreeSpaceEnd - dpage.Header.FreeSpaceStart)
+}
+
+func (dpage *DataPage) EntryFlags(entryIdx int16) uint8 {
+	return dpage.RowPointers[entryIdx].Flags
+}
+
+func (dpage *DataPage) SetEntryFlags(entryIdx int16, flags uint8) {
+	dpage.RowPointers[entryIdx].Flags = flags
+}
+
+// Changes the length of an entry without changing its slot and returns the
+// entry's new buffer.
+// Growing entries may use the space reserved for this purpose. The entry is
+// moved within the page if it can't grow where it is, in which case its
+// contents are not preserved.
+func (dpage *DataPage) ResizeEntry(entryIdx int16, requiredSpace int) ([]byte, error) {
+	if entryIdx < 0 || entryIdx >= dpage.Header.RowPointersLength || dpage.RowPointers[entryIdx].Offset < 0 {
+		return nil, errors.New("Entry index empty")
+	}
+	requiredSpace = entryLength(requiredSpace)
+
+	rowPointer := &dpage.RowPointers[entryIdx]
+	if requiredSpace <= int(rowPointer.Length) {
+		// Shrinking in place, the remainder is reclaimed by the next compaction
+		rowPointer.Length = int16(requiredSpace)
+		return dpage.page.Memory[rowPointer.Offset : int(rowPointer.Offset)+requiredSpace], nil
+	}
+
+	// Space of earlier deletions and resizes might be reclaimable
+	if dpage.FreeSpace() < requiredSpace+1 {
+		dpage.compact()
+		if dpage.FreeSpace() < requiredSpace+1 {
+			return nil, errors.New("No space left on page to resize entry")
+		}
+	}
+
+	rowStart := dpage.Header.FreeSpaceEnd - int16(requiredSpace) - 1
+	rowPointer.Offset = rowStart
+	rowPointer.Length = int16(requiredSpace)
 	dpage.Header.FreeSpaceEnd = rowStart
 
 	return dpage.page.Memory[rowStart : int(rowStart)+requiredSpace], nil
 }
+
+// Marks the entry as no longer in use and reclaims its space
+func (dpage *DataPage) FreeEntry(entryIdx int16) error {
+	if entryIdx < 0 || entryIdx >= dpage.Header.RowPointersLength || dpage.RowPointers[entryIdx].Offset < 0 {
+		return errors.New("Entry index empty")
+	}
+	dpage.RowPointers[entryIdx] = RowPointer{Offset: -1}
+
+	// Unused pointers at the end can be dropped without changing any slots
+	for dpage.Header.RowPointersLength > 0 && dpage.RowPointers[dpage.Header.RowPointersLength-1].Offset < 0 {
+		dpage.RowPointers = dpage.RowPointers[:dpage.Header.RowPointersLength-1]
+		dpage.Header.RowPointersLength--
+		dpage.Header.FreeSpaceStart -= rowPointerSize
+	}
+
+	dpage.compact()
+	return nil
+}
+
+// Moves all entries to the end of the page, so the space of freed entries
+// becomes part of the free space between row pointers and row data.
+func (dpage *DataPage) compact() {
+	// Entries are moved starting with the one closest to the end of the page,
+	// so no entry is overwritten before it was moved.
+	order := make([]int16, 0, dpage.Header.RowPointersLength)
+	for i := int16(0); i < dpage.Header.RowPointersLength; i++ {
+		if dpage.RowPointers[i].Offset >= 0 {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return dpage.RowPointers[order[i]].Offset > dpage.RowPointers[order[j]].Offset
+	})
+
+	end := int16(pager.PAGE_SIZE)
+	for _, entryIdx := range order {
+		rowPointer := &dpage.RowPointers[entryIdx]
+		// Keep the gap byte left by FindFreeEntry
+		newOffset := end - rowPointer.Length - 1
+		copy(dpage.page.Memory[newOffset:newOffset+rowPointer.Length], dpage.page.Memory[rowPointer.Offset:rowPointer.Offset+rowPointer.Length])
+		rowPointer.Offset = newOffset
+		end = newOffset
+	}
+	dpage.Header.FreeSpaceEnd = end
+}
+
+// The index of the underlying page
+func (dpage *DataPage) Index() int64 {
+	return dpage.page.Index
+}
@@ -0,0 +1,302 @@
+package table
+
+// The free space map (FSM) of a table tracks how much space is available for
+// inserts on each of its data pages, so FindFreePage doesn't have to visit
+// every page.
+//
+// It is a tree of FSM pages. Leaves hold one entry per data page with the
+// page's free space category, inner nodes hold one entry per child with the
+// largest category found in that child. Data pages are appended in order, so
+// the position of a data page's entry follows from its ordinal, which is kept
+// in the data page's header.
+// The root is replaced by a new one with an additional level once it is full.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"godb/pager"
+)
+
+type fsmNodeHeader struct {
+	// 0 for leaves
+	Level uint8
+	// The number of entries in this node
+	Count int16
+	// The number of data pages in the whole map, only maintained in the root
+	Total int64
+}
+
+type fsmEntry struct {
+	// The data page in leaves, the child node in inner nodes
+	PageIdx int64
+	// The free space category, see freeSpaceCategory
+	Category uint8
+}
+
+var fsmNodeHeaderSize = binary.Size(fsmNodeHeader{})
+var fsmEntrySize = binary.Size(fsmEntry{})
+
+type fsmNode struct {
+	page    *pager.Page
+	header  fsmNodeHeader
+	entries []fsmEntry
+}
+
+// The number of entries per FSM page
+func fsmFanout() int64 {
+	return (pager.PAGE_SIZE - int64(fsmNodeHeaderSize)) / int64(fsmEntrySize)
+}
+
+// Approximates free space in 256 categories of PAGE_SIZE / 255 bytes each.
+// A page of some category has at least category * PAGE_SIZE / 255 bytes free.
+func freeSpaceCategory(freeSpace int) uint8 {
+	if freeSpace <= 0 {
+		return 0
+	}
+	category := int64(freeSpace) * 255 / pager.PAGE_SIZE
+	if category > 255 {
+		return 255
+	}
+	return uint8(category)
+}
+
+// The smallest category guaranteeing the required space
+func requiredCategory(requiredSpace int) uint8 {
+	category := (int64(requiredSpace)*255 + pager.PAGE_SIZE - 1) / pager.PAGE_SIZE
+	if category > 255 {
+		return 255
+	}
+	return uint8(category)
+}
+
+func (table *Table) readFsmNode(pageIdx int64) (*fsmNode, error) {
+	page, err := table.Pager.FetchPage(pageIdx)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &fsmNode{page: page}
+	reader := bytes.NewReader(page.Memory)
+	binary.Read(reader, binary.BigEndian, &node.header)
+	node.entries = make([]fsmEntry, node.header.Count)
+	binary.Read(reader, binary.BigEndian, &node.entries)
+
+	return node, nil
+}
+
+func (table *Table) writeFsmNode(node *fsmNode) error {
+	node.header.Count = int16(len(node.entries))
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, node.header)
+	binary.Write(&buf, binary.BigEndian, node.entries)
+	copy(node.page.Memory, buf.Bytes())
+
+	return node.page.Flush()
+}
+
+func (table *Table) newFsmNode(level uint8) (*fsmNode, error) {
+	page, err := table.Pager.AllocatePage()
+	if err != nil {
+		return nil, err
+	}
+	return &fsmNode{page: page, header: fsmNodeHeader{Level: level}}, nil
+}
+
+func (node *fsmNode) maxCategory() uint8 {
+	max := uint8(0)
+	for _, entry := range node.entries {
+		if entry.Category > max {
+			max = entry.Category
+		}
+	}
+	return max
+}
+
+// The index of the entry leading to the given ordinal within a node of the given level
+func fsmChildIdx(ordinal int64, level uint8) int {
+	for i := uint8(0); i < level; i++ {
+		ordinal /= fsmFanout()
+	}
+	return int(ordinal % fsmFanout())
+}
+
+// Writes the nodes of a path from the root to a leaf, updating the categories
+// of the inner entries on the way up
+func (table *Table) writeFsmPath(path []*fsmNode, childIdxs []int) error {
+	for i := len(path) - 1; i >= 0; i-- {
+		if i < len(path)-1 {
+			path[i].entries[childIdxs[i]].Category = path[i+1].maxCategory()
+		}
+		err := table.writeFsmNode(path[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds a new data page to the map and returns its ordinal
+func (table *Table) fsmAppend(pageIdx int64, category uint8) (int64, error) {
+	var root *fsmNode
+	var err error
+	if table.FreeSpaceMapIdx < 0 {
+		root, err = table.newFsmNode(0)
+		if err != nil {
+			return -1, err
+		}
+		table.FreeSpaceMapIdx = root.page.Index
+	} else {
+		root, err = table.readFsmNode(table.FreeSpaceMapIdx)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	ordinal := root.header.Total
+
+	// Add a level if the tree is full
+	capacity := fsmFanout()
+	for i := uint8(0); i < root.header.Level; i++ {
+		capacity *= fsmFanout()
+	}
+	if ordinal == capacity {
+		newRoot, err := table.newFsmNode(root.header.Level + 1)
+		if err != nil {
+			return -1, err
+		}
+		newRoot.header.Total = root.header.Total
+		newRoot.entries = []fsmEntry{{PageIdx: root.page.Index, Category: root.maxCategory()}}
+		err = table.writeFsmNode(newRoot)
+		if err != nil {
+			return -1, err
+		}
+		table.FreeSpaceMapIdx = newRoot.page.Index
+		root = newRoot
+	}
+
+	// Descend, creating the nodes missing on the path
+	path := []*fsmNode{root}
+	childIdxs := []int{}
+	node := root
+	for node.header.Level > 0 {
+		childIdx := fsmChildIdx(ordinal, node.header.Level)
+		var child *fsmNode
+		if childIdx == len(node.entries) {
+			child, err = table.newFsmNode(node.header.Level - 1)
+			if err != nil {
+				return -1, err
+			}
+			node.entries = append(node.entries, fsmEntry{PageIdx: child.page.Index})
+		} else {
+			child, err = table.readFsmNode(node.entries[childIdx].PageIdx)
+			if err != nil {
+				return -1, err
+			}
+		}
+		path = append(path, child)
+		childIdxs = append(childIdxs, childIdx)
+		node = child
+	}
+
+	node.entries = append(node.entries, fsmEntry{PageIdx: pageIdx, Category: category})
+	root.header.Total++
+
+	return ordinal, table.writeFsmPath(path, childIdxs)
+}
+
+// The number of data pages of the table
+func (table *Table) PageCount() (int64, error) {
+	if table.FreeSpaceMapIdx < 0 {
+		return 0, nil
+	}
+	root, err := table.readFsmNode(table.FreeSpaceMapIdx)
+	if err != nil {
+		return 0, err
+	}
+	return root.header.Total, nil
+}
+
+// The index of the data page with the given ordinal
+func (table *Table) fsmPageIdx(ordinal int64) (int64, error) {
+	node, err := table.readFsmNode(table.FreeSpaceMapIdx)
+	if err != nil {
+		return -1, err
+	}
+	for node.header.Level > 0 {
+		node, err = table.readFsmNode(node.entries[fsmChildIdx(ordinal, node.header.Level)].PageIdx)
+		if err != nil {
+			return -1, err
+		}
+	}
+	return node.entries[fsmChildIdx(ordinal, 0)].PageIdx, nil
+}
+
+// Records the free space category of the data page with the given ordinal
+func (table *Table) fsmSet(ordinal int64, category uint8) error {
+	node, err := table.readFsmNode(table.FreeSpaceMapIdx)
+	if err != nil {
+		return err
+	}
+
+	path := []*fsmNode{node}
+	childIdxs := []int{}
+	for node.header.Level > 0 {
+		childIdx := fsmChildIdx(ordinal, node.header.Level)
+		node, err = table.readFsmNode(node.entries[childIdx].PageIdx)
+		if err != nil {
+			return err
+		}
+		path = append(path, node)
+		childIdxs = append(childIdxs, childIdx)
+	}
+
+	node.entries[fsmChildIdx(ordinal, 0)].Category = category
+	return table.writeFsmPath(path, childIdxs)
+}
+
+// Finds a data page of at least the given category, other than the excluded one.
+// Returns -1 if there is none.
+func (table *Table) fsmFind(category uint8, excludedPageIdx int64) (int64, error) {
+	if table.FreeSpaceMapIdx < 0 {
+		return -1, nil
+	}
+	return table.fsmFindIn(table.FreeSpaceMapIdx, category, excludedPageIdx)
+}
+
+func (table *Table) fsmFindIn(nodeIdx int64, category uint8, excludedPageIdx int64) (int64, error) {
+	node, err := table.readFsmNode(nodeIdx)
+	if err != nil {
+		return -1, err
+	}
+
+	for _, entry := range node.entries {
+		if entry.Category < category {
+			continue
+		}
+		if node.header.Level == 0 {
+			if entry.PageIdx != excludedPageIdx {
+				return entry.PageIdx, nil
+			}
+			continue
+		}
+		pageIdx, err := table.fsmFindIn(entry.PageIdx, category, excludedPageIdx)
+		if err != nil || pageIdx >= 0 {
+			return pageIdx, err
+		}
+	}
+	return -1, nil
+}
+
+// Flushes the data page and records changes of its free space in the map
+func (table *Table) flushDataPage(dpage *DataPage) error {
+	category := freeSpaceCategory(dpage.AvailableSpace())
+	if category != dpage.Header.FreeSpaceCategory {
+		dpage.Header.FreeSpaceCategory = category
+		err := table.fsmSet(dpage.Header.FreeSpaceOrdinal, category)
+		if err != nil {
+			return err
+		}
+	}
+	return dpage.Flush()
+}
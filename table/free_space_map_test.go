@@ -0,0 +1,70 @@
+package table
+
+import (
+	"godb/pager"
+	"os"
+	"testing"
+)
+
+const FSM_TEST_FILE = "fsm_test.db"
+
+func TestFreeSpaceMap(t *testing.T) {
+	os.Remove(FSM_TEST_FILE)
+	os.Remove(FSM_TEST_FILE + pager.WAL_SUFFIX)
+	p, err := pager.OpenPager(FSM_TEST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		p.Close()
+		os.Remove(FSM_TEST_FILE)
+		os.Remove(FSM_TEST_FILE + pager.WAL_SUFFIX)
+	}()
+
+	table := &Table{Pager: p, FirstPageIdx: -1, LastPageIdx: -1, FreeSpaceMapIdx: -1}
+
+	// Enough entries for the map to grow a second level
+	count := fsmFanout() + 10
+	for i := int64(0); i < count; i++ {
+		ordinal, err := table.fsmAppend(1000+i, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ordinal != i {
+			t.Fatal("Wrong ordinal", ordinal, "for entry", i)
+		}
+	}
+
+	pageIdx, err := table.fsmFind(2, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pageIdx != -1 {
+		t.Error("Found page with too little space")
+	}
+
+	pageIdx, err = table.fsmPageIdx(count - 1)
+	if err != nil || pageIdx != 1000+count-1 {
+		t.Error("Wrong page for the last ordinal", pageIdx, err)
+	}
+
+	// One page in the first and one in the second leaf
+	table.fsmSet(3, 100)
+	table.fsmSet(count-1, 200)
+
+	pageIdx, err = table.fsmFind(requiredCategory(150*int(pager.PAGE_SIZE)/255), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pageIdx != 1000+count-1 {
+		t.Error("Wrong page found", pageIdx)
+	}
+
+	pageIdx, err = table.fsmFind(50, 1003)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pageIdx != 1000+count-1 {
+		t.Error("Excluded page not skipped", pageIdx)
+	}
+}
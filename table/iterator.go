@@ -0,0 +1,80 @@
+package table
+
+// Iterates over all rows of a table in page order.
+//
+// Only the position is kept between calls to Next, the current page is
+// fetched again every time. The table may therefore be modified while
+// iterating, rows stored behind the current position may or may not be
+// visited.
+type RowIterator struct {
+	table *Table
+	// The page and slot of the current row, PageIdx is -1 before the first row
+	rowId RowId
+	row   Row
+	err   error
+	done  bool
+}
+
+// Returns an iterator over all rows of the table
+func (table *Table) Scan() *RowIterator {
+	return &RowIterator{table: table, rowId: RowId{PageIdx: -1, Slot: -1}}
+}
+
+// Advances to the next row, returns false once all rows were visited or an
+// error occurred.
+func (it *RowIterator) Next() bool {
+	if it.err != nil || it.done {
+		return false
+	}
+
+	it.table.Pager.BeginOperation()
+	defer it.table.Pager.EndOperation()
+
+	pageIdx, slot := it.rowId.PageIdx, it.rowId.Slot+1
+	if pageIdx < 0 {
+		pageIdx, slot = it.table.FirstPageIdx, 0
+	}
+
+	for pageIdx >= 0 {
+		page, err := it.table.FetchDataPage(pageIdx)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		for ; slot < page.Header.RowPointersLength; slot++ {
+			if page.RowPointers[slot].Offset < 0 || page.EntryFlags(slot) == ROW_MOVED_IN {
+				// Moved in rows are visited through their forwarding entry
+				continue
+			}
+
+			it.rowId = RowId{PageIdx: pageIdx, Slot: slot}
+			it.row, it.err = it.table.FetchRow(it.rowId)
+			return it.err == nil
+		}
+
+		pageIdx, slot = page.Header.Next, 0
+	}
+
+	it.done = true
+	return false
+}
+
+// The current row
+func (it *RowIterator) Row() Row {
+	return it.row
+}
+
+// The location of the current row
+func (it *RowIterator) RowId() RowId {
+	return it.rowId
+}
+
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+func (it *RowIterator) Close() {
+	it.done = true
+	it.row = nil
+}
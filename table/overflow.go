@@ -0,0 +1,117 @@
+package table
+
+// Column values too large to be kept in their row are spilled into a chain of
+// overflow pages. The row only holds a reference to the first page of the
+// chain and the length of the encoded value.
+//
+// The layout of an overflow page is as follows:
+//   overflowPageHeader
+//   Length bytes of the encoded value
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"godb/pager"
+)
+
+type overflowPageHeader struct {
+	// Page index of the next page of the chain, -1 for the last one
+	Next int64
+	// The number of value bytes on this page
+	Length int16
+}
+
+type overflowRef struct {
+	FirstPageIdx int64
+	// The byte length of the whole encoded value
+	Length int64
+}
+
+var overflowPageHeaderSize = binary.Size(overflowPageHeader{})
+var overflowRefSize = binary.Size(overflowRef{})
+
+// The number of value bytes fitting on an overflow page
+func overflowPageCapacity() int {
+	return int(pager.PAGE_SIZE) - overflowPageHeaderSize
+}
+
+// Writes the encoded value into a new chain of overflow pages
+func (table *Table) writeOverflow(data []byte) (overflowRef, error) {
+	ref := overflowRef{FirstPageIdx: -1, Length: int64(len(data))}
+
+	// Written back to front, so every page knows its successor
+	next := int64(-1)
+	capacity := overflowPageCapacity()
+	chunkCount := (len(data) + capacity - 1) / capacity
+	for chunk := chunkCount - 1; chunk >= 0; chunk-- {
+		start := chunk * capacity
+		end := start + capacity
+		if end > len(data) {
+			end = len(data)
+		}
+
+		page, err := table.Pager.AllocatePage()
+		if err != nil {
+			return ref, err
+		}
+
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, overflowPageHeader{Next: next, Length: int16(end - start)})
+		copy(page.Memory, buf.Bytes())
+		copy(page.Memory[overflowPageHeaderSize:], data[start:end])
+		err = page.Flush()
+		if err != nil {
+			return ref, err
+		}
+
+		next = page.Index
+	}
+
+	ref.FirstPageIdx = next
+	return ref, nil
+}
+
+// Reads the encoded value back from its chain of overflow pages
+func (table *Table) readOverflow(ref overflowRef) ([]byte, error) {
+	data := make([]byte, 0, ref.Length)
+	pageIdx := ref.FirstPageIdx
+	for pageIdx >= 0 {
+		page, err := table.Pager.FetchPage(pageIdx)
+		if err != nil {
+			return nil, err
+		}
+
+		var header overflowPageHeader
+		binary.Read(bytes.NewReader(page.Memory[:overflowPageHeaderSize]), binary.BigEndian, &header)
+		data = append(data, page.Memory[overflowPageHeaderSize:overflowPageHeaderSize+int(header.Length)]...)
+
+		pageIdx = header.Next
+	}
+
+	if int64(len(data)) != ref.Length {
+		return nil, errors.New("Overflow chain is corrupted")
+	}
+	return data, nil
+}
+
+// Frees the pages of an overflow chain
+func (table *Table) freeOverflow(ref overflowRef) error {
+	pageIdx := ref.FirstPageIdx
+	for pageIdx >= 0 {
+		page, err := table.Pager.FetchPage(pageIdx)
+		if err != nil {
+			return err
+		}
+
+		var header overflowPageHeader
+		binary.Read(bytes.NewReader(page.Memory[:overflowPageHeaderSize]), binary.BigEndian, &header)
+
+		err = table.Pager.FreePage(pageIdx)
+		if err != nil {
+			return err
+		}
+		pageIdx = header.Next
+	}
+	return nil
+}
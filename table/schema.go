@@ -1,10 +1,21 @@
 package table
 
-import "errors"
+import (
+	"errors"
+	"strconv"
+)
 
 type ColumnDef struct {
 	Name string
 	Type *DataType
+	// NULL values are rejected
+	NotNull bool
+	// No two rows may have the same value, enforced by a unique index
+	Unique bool
+	// The column identifies the rows of its table. Implies NotNull and Unique.
+	PrimaryKey bool
+	// The value used if none is given, nil for NULL
+	Default ColumnValue
 }
 
 type TableSchema struct {
@@ -21,6 +32,8 @@ func (ts *TableSchema) FindColumnByName(name string) (*ColumnDef, int, error) {
 }
 
 type DataType struct {
+	// The name shown to users
+	Name string
 	// Decodes the value from a byte slice that starts with the value (can be longer)
 	// For variable length values the length can be encoded in the first bytes.
 	Decode func([]byte) (ColumnValue, error)
@@ -29,15 +42,21 @@ type DataType struct {
 
 type Row []ColumnValue
 
-// The byte length required to save this
+// The byte length required to save this.
+// NULL values are nil and take up no space.
 func (row *Row) Length() int {
 	length := 0
 	for _, col := range *row {
-		length += col.Length()
+		if col != nil {
+			length += col.Length()
+		}
 	}
 	return length
 }
 
+// Decides whether a row is selected by an operation
+type Predicate func(Row) (bool, error)
+
 type ColumnValue interface {
 	Type() *DataType
 	Length() int
@@ -48,10 +67,27 @@ type ColumnValue interface {
 
 // Check whether the row conforms to the schema
 func (ts *TableSchema) CheckSchema(row Row) bool {
+	return ts.Validate(row) == nil
+}
+
+// Checks the row against the schema and explains why it doesn't conform
+func (ts *TableSchema) Validate(row Row) error {
+	if len(row) != len(ts.Columns) {
+		return errors.New("Row has " + strconv.Itoa(len(row)) + " values, table has " +
+			strconv.Itoa(len(ts.Columns)) + " columns")
+	}
 	for idx, val := range row {
-		if val.Type() != ts.Columns[idx].Type {
-			return false
+		col := ts.Columns[idx]
+		if val == nil {
+			if col.NotNull || col.PrimaryKey {
+				return errors.New("Column '" + col.Name + "' can't be NULL")
+			}
+			continue
+		}
+		if val.Type() != col.Type {
+			return errors.New("Value for column '" + col.Name + "' is of type " + val.Type().Name +
+				", expected " + col.Type.Name)
 		}
 	}
-	return true
+	return nil
 }
@@ -0,0 +1,152 @@
+package table
+
+// The statistics of a table are estimated from a sample of its data pages.
+// Up to STATISTICS_SAMPLE_PAGES pages spread evenly over the table are read,
+// found through the free space map. Smaller tables are read completely, so
+// their statistics are exact.
+
+import (
+	"sort"
+)
+
+// The number of data pages read by Analyze at most
+var STATISTICS_SAMPLE_PAGES int64 = 300
+
+// The number of buckets of the column histograms
+const HISTOGRAM_BUCKETS = 10
+
+// What the planner knows about the rows of a table
+type Statistics struct {
+	Rows  int64
+	Pages int64
+	// By position of the column
+	Columns []ColumnStatistics
+}
+
+type ColumnStatistics struct {
+	// The number of distinct values other than NULL
+	Distinct int64
+	// The share of NULL values, from 0 to 1
+	NullFraction float64
+	// The smallest and largest value, nil if there are only NULLs
+	Min ColumnValue
+	Max ColumnValue
+	// The bounds of HISTOGRAM_BUCKETS buckets holding about the same number of
+	// values, from Min to Max. Empty if there are only NULLs.
+	Histogram []ColumnValue
+}
+
+// Estimates the statistics of the table from a sample of its data pages
+func (table *Table) Analyze() (*Statistics, error) {
+	pages, err := table.PageCount()
+	if err != nil {
+		return nil, err
+	}
+	stats := &Statistics{Pages: pages, Columns: make([]ColumnStatistics, len(table.Schema.Columns))}
+
+	samplePages := pages
+	if samplePages > STATISTICS_SAMPLE_PAGES {
+		samplePages = STATISTICS_SAMPLE_PAGES
+	}
+	values := make([][]ColumnValue, len(table.Schema.Columns))
+	sampledRows := int64(0)
+	for i := int64(0); i < samplePages; i++ {
+		pageIdx, err := table.fsmPageIdx(i * pages / samplePages)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := table.pageRows(pageIdx)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			for colIdx, value := range row {
+				if value != nil {
+					values[colIdx] = append(values[colIdx], value)
+				}
+			}
+		}
+		sampledRows += int64(len(rows))
+	}
+	if sampledRows == 0 {
+		return stats, nil
+	}
+	stats.Rows = sampledRows * pages / samplePages
+
+	for colIdx, colValues := range values {
+		col := &stats.Columns[colIdx]
+		col.NullFraction = float64(sampledRows-int64(len(colValues))) / float64(sampledRows)
+		if len(colValues) == 0 {
+			continue
+		}
+
+		sort.Slice(colValues, func(i, j int) bool {
+			// ColumnValue.Compare returns the order of the argument relative to the receiver
+			cmp, _ := colValues[j].Compare(colValues[i])
+			return cmp < 0
+		})
+		col.Min, col.Max = colValues[0], colValues[len(colValues)-1]
+		for bucket := 0; bucket <= HISTOGRAM_BUCKETS; bucket++ {
+			col.Histogram = append(col.Histogram, colValues[bucket*(len(colValues)-1)/HISTOGRAM_BUCKETS])
+		}
+
+		nonNullRows := int64(float64(stats.Rows) * (1 - col.NullFraction))
+		col.Distinct = estimateDistinct(colValues, nonNullRows, samplePages == pages)
+	}
+	return stats, nil
+}
+
+// Estimates the number of distinct values among all values of a column from
+// the sorted sample of its values
+func estimateDistinct(sample []ColumnValue, total int64, complete bool) int64 {
+	distinct, once := int64(0), int64(0)
+	for i := 0; i < len(sample); {
+		j := i + 1
+		for j < len(sample) {
+			if cmp, _ := sample[i].Compare(sample[j]); cmp != 0 {
+				break
+			}
+			j++
+		}
+		distinct++
+		if j-i == 1 {
+			once++
+		}
+		i = j
+	}
+	if complete || total <= int64(len(sample)) {
+		return distinct
+	}
+
+	// The estimator of Haas and Stokes: values seen once in the sample
+	// likely stand for many more values which weren't sampled
+	n := float64(len(sample))
+	estimate := int64(n * float64(distinct) / (n - float64(once) + float64(once)*n/float64(total)))
+	if estimate < distinct {
+		return distinct
+	}
+	if estimate > total {
+		return total
+	}
+	return estimate
+}
+
+// The rows stored on a data page, excluding those moved in from other pages
+func (table *Table) pageRows(pageIdx int64) ([]Row, error) {
+	page, err := table.FetchDataPage(pageIdx)
+	if err != nil {
+		return nil, err
+	}
+	rows := []Row{}
+	for slot := int16(0); slot < page.Header.RowPointersLength; slot++ {
+		if page.RowPointers[slot].Offset < 0 || page.EntryFlags(slot) == ROW_MOVED_IN {
+			continue
+		}
+		row, err := table.FetchRow(RowId{PageIdx: pageIdx, Slot: slot})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
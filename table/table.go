@@ -7,6 +7,13 @@ import (
 	"godb/pager"
 )
 
+// The location of a row: the data page it is stored on and the index of its
+// row pointer on that page
+type RowId struct {
+	PageIdx int64
+	Slot    int16
+}
+
 type Table struct {
 	Name string
 	// Pointer to the database pager
@@ -14,17 +21,20 @@ type Table struct {
 	// The index of the first DataPage
 	FirstPageIdx int64
 	LastPageIdx  int64
-	Schema       TableSchema
+	// The root of the free space map, -1 while the table has no pages
+	FreeSpaceMapIdx int64
+	Schema          TableSchema
 }
 
 func (table *Table) NewDataPage() (*DataPage, error) {
-	page, err := table.Pager.AppendPage()
+	page, err := table.Pager.AllocatePage()
 	if err != nil {
 		return nil, err
 	}
 
-	if table.LastPageIdx >= 0 {
-		prevPage, err := table.FetchDataPage(table.LastPageIdx)
+	prevPageIdx := table.LastPageIdx
+	if prevPageIdx >= 0 {
+		prevPage, err := table.FetchDataPage(prevPageIdx)
 		if err != nil {
 			return nil, err
 		}
@@ -39,11 +49,20 @@ func (table *Table) NewDataPage() (*DataPage, error) {
 		page: page,
 		Header: DataPageHeader{
 			Next:           -1,
-			Prev:           table.LastPageIdx,
+			Prev:           prevPageIdx,
 			FreeSpaceStart: int16(binary.Size(DataPageHeader{})),
 			FreeSpaceEnd:   int16(pager.PAGE_SIZE),
 		},
 	}
+
+	category := freeSpaceCategory(dataPage.AvailableSpace())
+	ordinal, err := table.fsmAppend(page.Index, category)
+	if err != nil {
+		return nil, err
+	}
+	dataPage.Header.FreeSpaceOrdinal = ordinal
+	dataPage.Header.FreeSpaceCategory = category
+
 	return dataPage, nil
 }
 
@@ -62,36 +81,30 @@ func (table *Table) FetchDataPage(pageIdx int64) (*DataPage, error) {
 }
 
 // Find page which still has sufficient space and create one if there is none.
-// TODO: Currently iterates through all pages. This should be handled using a free list or the like.
-func (table *Table) FindFreePage(requiredSpace int) (*DataPage, error) {
-	dpage, err := table.FetchDataPage(table.FirstPageIdx)
-
-	for {
-		if err != nil { // Error occurs when pageIdx is out of range, so there is no free space on any page
-			newPage, err := table.NewDataPage()
-			if err != nil {
-				return nil, err
-			}
-
-			// Update table
-			table.LastPageIdx = newPage.page.Index
-			if table.FirstPageIdx < 0 {
-				table.FirstPageIdx = table.LastPageIdx
-			}
+// The excluded page is never returned, -1 to allow all pages.
+func (table *Table) FindFreePage(requiredSpace int, excludedPageIdx int64) (*DataPage, error) {
+	requiredSpace = entryLength(requiredSpace)
+	if requiredSpace > MaxEntryLength() {
+		return nil, errors.New("Row too large to fit on a page")
+	}
 
-			return newPage, nil
-		}
-		if dpage.AvailableSpace() >= requiredSpace {
-			return dpage, nil
-		} else {
-			dpage, err = table.NextPage(dpage)
-		}
+	pageIdx, err := table.fsmFind(requiredCategory(requiredSpace), excludedPageIdx)
+	if err != nil {
+		return nil, err
 	}
+	if pageIdx >= 0 {
+		return table.FetchDataPage(pageIdx)
+	}
+
+	return table.NewDataPage()
 }
 
 func (row Row) Encode(targetBuffer []byte) {
 	offset := 0
 	for _, column := range row {
+		if column == nil {
+			continue
+		}
 		// TODO: There is probably a better way to insert a slice into another one
 		encoded := column.Encode()
 		for i := 0; i < int(column.Length()); i++ {
@@ -101,14 +114,100 @@ func (row Row) Encode(targetBuffer []byte) {
 	}
 }
 
+// Flags stored for every column in front of a row
+const (
+	// The value is stored in overflow pages, the row only holds an overflowRef
+	COLUMN_OVERFLOW = uint8(1)
+	// The value is NULL and not stored at all
+	COLUMN_NULL = uint8(2)
+)
+
+// Rows longer than this have their largest values moved to overflow pages
+var MaxRowLength = (int(pager.PAGE_SIZE) - binary.Size(DataPageHeader{})) / 4
+
+// Encodes a row the way it is stored on a data page.
+// Large values are written to overflow pages.
+//
+// The encoding is as follows:
+//
+//	1 byte per column: Column flags
+//
+// For each column
+//
+//	n bytes: The encoded value, an overflowRef if the value overflows or
+//	         nothing if it is NULL
+func (table *Table) encodeRow(row Row) ([]byte, error) {
+	flags := make([]uint8, len(row))
+	for i, col := range row {
+		if col == nil {
+			flags[i] = COLUMN_NULL
+		}
+	}
+	length := len(row) + row.Length()
+
+	// Move the largest values out of the row until it is short enough
+	for length > MaxRowLength {
+		largest := -1
+		for i, col := range row {
+			if flags[i] == 0 && col.Length() > overflowRefSize &&
+				(largest < 0 || col.Length() > row[largest].Length()) {
+				largest = i
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		flags[largest] |= COLUMN_OVERFLOW
+		length += overflowRefSize - row[largest].Length()
+	}
+
+	var buf bytes.Buffer
+	buf.Write(flags)
+	for i, col := range row {
+		if flags[i]&COLUMN_NULL != 0 {
+			continue
+		}
+		if flags[i]&COLUMN_OVERFLOW != 0 {
+			ref, err := table.writeOverflow(col.Encode())
+			if err != nil {
+				return nil, err
+			}
+			binary.Write(&buf, binary.BigEndian, ref)
+		} else {
+			buf.Write(col.Encode())
+		}
+	}
+	return buf.Bytes(), nil
+}
+
 // The given buffer starts with the row value, but can be longer.
 // This is necessary, because the length of the value is not yet known.
+// Values stored in overflow pages are read from there.
 //
 // Returns the row, the number of bytes read and optionally an error.
 func (table *Table) DecodeRow(buffer []byte, schema TableSchema) (Row, int64, error) {
-	row := make([]ColumnValue, len(table.Schema.Columns))
-	offset := int64(0)
+	columnCount := len(table.Schema.Columns)
+	row := make([]ColumnValue, columnCount)
+	offset := int64(columnCount)
 	for i, colDef := range table.Schema.Columns {
+		if buffer[i]&COLUMN_NULL != 0 {
+			continue
+		}
+		if buffer[i]&COLUMN_OVERFLOW != 0 {
+			ref := decodeOverflowRef(buffer[offset:])
+			encoded, err := table.readOverflow(ref)
+			if err != nil {
+				return nil, -1, err
+			}
+			val, err := colDef.Type.Decode(encoded)
+			if err != nil {
+				return nil, -1, err
+			}
+			row[i] = val
+			offset += int64(overflowRefSize)
+			continue
+		}
+
 		val, err := colDef.Type.Decode(buffer[offset:])
 		if err != nil {
 			return nil, -1, err
@@ -121,6 +220,334 @@ func (table *Table) DecodeRow(buffer []byte, schema TableSchema) (Row, int64, er
 	return row, offset, nil
 }
 
+// Returns the references to the overflow pages of an encoded row
+func (table *Table) overflowRefs(buffer []byte) ([]overflowRef, error) {
+	refs := []overflowRef{}
+	offset := int64(len(table.Schema.Columns))
+	for i, colDef := range table.Schema.Columns {
+		if buffer[i]&COLUMN_NULL != 0 {
+			continue
+		}
+		if buffer[i]&COLUMN_OVERFLOW != 0 {
+			refs = append(refs, decodeOverflowRef(buffer[offset:]))
+			offset += int64(overflowRefSize)
+			continue
+		}
+
+		val, err := colDef.Type.Decode(buffer[offset:])
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(val.Length())
+	}
+	return refs, nil
+}
+
+// Returns the references to the overflow pages of the row at the given location
+func (table *Table) rowOverflowRefs(rowId RowId) ([]overflowRef, error) {
+	page, slot, err := table.locateRow(rowId)
+	if err != nil {
+		return nil, err
+	}
+	entryBuffer, err := page.GetEntry(slot)
+	if err != nil {
+		return nil, err
+	}
+	return table.overflowRefs(entryBuffer)
+}
+
+// Frees the overflow pages of the row at the given location
+func (table *Table) freeRowOverflow(rowId RowId) error {
+	refs, err := table.rowOverflowRefs(rowId)
+	if err != nil {
+		return err
+	}
+	return table.freeOverflowRefs(refs)
+}
+
+func (table *Table) freeOverflowRefs(refs []overflowRef) error {
+	for _, ref := range refs {
+		err := table.freeOverflow(ref)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeOverflowRef(buffer []byte) overflowRef {
+	var ref overflowRef
+	binary.Read(bytes.NewReader(buffer[:overflowRefSize]), binary.BigEndian, &ref)
+	return ref
+}
+
+// Stores a new row on a page with sufficient space and returns its location
+func (table *Table) InsertRow(row Row) (RowId, error) {
+	table.Pager.BeginOperation()
+	defer table.Pager.EndOperation()
+	encoded, err := table.encodeRow(row)
+	if err != nil {
+		return RowId{}, err
+	}
+	return table.storeEntry(encoded, 0, -1)
+}
+
+// Stores the encoded row on any page but the excluded one
+func (table *Table) storeEntry(encoded []byte, flags uint8, excludedPageIdx int64) (RowId, error) {
+	page, err := table.FindFreePage(len(encoded), excludedPageIdx)
+	if err != nil {
+		return RowId{}, err
+	}
+
+	slot, entryBuffer, err := page.FindFreeEntry(len(encoded))
+	if err != nil {
+		return RowId{}, err
+	}
+	page.SetEntryFlags(slot, flags)
+
+	copy(entryBuffer, encoded)
+
+	err = table.flushDataPage(page)
+	if err != nil {
+		return RowId{}, err
+	}
+
+	return RowId{PageIdx: page.Index(), Slot: slot}, nil
+}
+
+func encodeForwarding(target RowId, buffer []byte) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, target)
+	copy(buffer, buf.Bytes())
+}
+
+func decodeForwarding(buffer []byte) RowId {
+	var target RowId
+	binary.Read(bytes.NewReader(buffer[:MinEntryLength]), binary.BigEndian, &target)
+	return target
+}
+
+// Resolves forwarding entries.
+// Returns the page and slot actually holding the row at the given location.
+func (table *Table) locateRow(rowId RowId) (*DataPage, int16, error) {
+	page, err := table.FetchDataPage(rowId.PageIdx)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	entryBuffer, err := page.GetEntry(rowId.Slot)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	switch page.EntryFlags(rowId.Slot) {
+	case ROW_FORWARDED:
+		target := decodeForwarding(entryBuffer)
+		targetPage, err := table.FetchDataPage(target.PageIdx)
+		if err != nil {
+			return nil, -1, err
+		}
+		return targetPage, target.Slot, nil
+	case ROW_MOVED_IN:
+		return nil, -1, errors.New("Row id doesn't point to the home location of a row")
+	}
+
+	return page, rowId.Slot, nil
+}
+
+// Reads the row at the given location
+func (table *Table) FetchRow(rowId RowId) (Row, error) {
+	table.Pager.BeginOperation()
+	defer table.Pager.EndOperation()
+	page, slot, err := table.locateRow(rowId)
+	if err != nil {
+		return nil, err
+	}
+
+	entryBuffer, err := page.GetEntry(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	row, _, err := table.DecodeRow(entryBuffer, table.Schema)
+	return row, err
+}
+
+// Removes the row at the given location
+func (table *Table) DeleteRow(rowId RowId) error {
+	table.Pager.BeginOperation()
+	defer table.Pager.EndOperation()
+	err := table.freeRowOverflow(rowId)
+	if err != nil {
+		return err
+	}
+
+	page, err := table.FetchDataPage(rowId.PageIdx)
+	if err != nil {
+		return err
+	}
+
+	entryBuffer, err := page.GetEntry(rowId.Slot)
+	if err != nil {
+		return err
+	}
+
+	if page.EntryFlags(rowId.Slot) == ROW_FORWARDED {
+		err = table.freeEntry(decodeForwarding(entryBuffer))
+		if err != nil {
+			return err
+		}
+	}
+
+	return table.freeEntry(rowId)
+}
+
+func (table *Table) freeEntry(rowId RowId) error {
+	page, err := table.FetchDataPage(rowId.PageIdx)
+	if err != nil {
+		return err
+	}
+
+	err = page.FreeEntry(rowId.Slot)
+	if err != nil {
+		return err
+	}
+
+	return table.flushDataPage(page)
+}
+
+// Replaces the row at the given location, which keeps its RowId.
+//
+// A grown row is kept on its page if possible, using the space reserved for
+// growth. Otherwise it is moved to another page and a forwarding entry is left
+// in its place. A forwarded row moves back once there is space again.
+func (table *Table) UpdateRow(rowId RowId, newRow Row) error {
+	table.Pager.BeginOperation()
+	defer table.Pager.EndOperation()
+
+	// The old values are replaced entirely, new overflow pages are written if
+	// necessary. The old ones are only freed once the new row is stored, so a
+	// failed update leaves the row intact.
+	oldRefs, err := table.rowOverflowRefs(rowId)
+	if err != nil {
+		return err
+	}
+	encoded, err := table.encodeRow(newRow)
+	if err != nil {
+		return err
+	}
+	err = table.replaceEntry(rowId, encoded)
+	if err != nil {
+		return err
+	}
+	return table.freeOverflowRefs(oldRefs)
+}
+
+// Replaces the encoded row stored at the given location
+func (table *Table) replaceEntry(rowId RowId, encoded []byte) error {
+	homePage, err := table.FetchDataPage(rowId.PageIdx)
+	if err != nil {
+		return err
+	}
+	homeBuffer, err := homePage.GetEntry(rowId.Slot)
+	if err != nil {
+		return err
+	}
+
+	switch homePage.EntryFlags(rowId.Slot) {
+	case ROW_MOVED_IN:
+		return errors.New("Row id doesn't point to the home location of a row")
+	case ROW_FORWARDED:
+		target := decodeForwarding(homeBuffer)
+
+		// Try to keep the row where it currently is
+		targetPage, err := table.FetchDataPage(target.PageIdx)
+		if err != nil {
+			return err
+		}
+		ok, err := table.resizeAndWrite(targetPage, target.Slot, encoded)
+		if err != nil || ok {
+			return err
+		}
+
+		// Moving back home makes the forwarding entry obsolete
+		ok, err = table.resizeAndWrite(homePage, rowId.Slot, encoded)
+		if err != nil {
+			return err
+		}
+		if ok {
+			homePage.SetEntryFlags(rowId.Slot, 0)
+			err = table.flushDataPage(homePage)
+			if err != nil {
+				return err
+			}
+			return table.freeEntry(target)
+		}
+
+		// Move to a third page
+		err = table.forward(homePage, rowId.Slot, encoded)
+		if err != nil {
+			return err
+		}
+		return table.freeEntry(target)
+	default:
+		ok, err := table.resizeAndWrite(homePage, rowId.Slot, encoded)
+		if err != nil || ok {
+			return err
+		}
+		return table.forward(homePage, rowId.Slot, encoded)
+	}
+}
+
+// Writes the encoded row into the entry, resizing it if necessary.
+// Returns false if the page doesn't have enough space.
+func (table *Table) resizeAndWrite(page *DataPage, slot int16, encoded []byte) (bool, error) {
+	entryBuffer, err := page.ResizeEntry(slot, len(encoded))
+	if err != nil {
+		// Not enough space on the page.
+		// The page may have been compacted trying to make space.
+		return false, table.flushDataPage(page)
+	}
+	copy(entryBuffer, encoded)
+	return true, table.flushDataPage(page)
+}
+
+// Moves the row to another page and turns its home entry into a forwarding entry
+func (table *Table) forward(homePage *DataPage, homeSlot int16, encoded []byte) error {
+	target, err := table.storeEntry(encoded, ROW_MOVED_IN, homePage.Index())
+	if err != nil {
+		return err
+	}
+
+	// Storing the row may have allocated a new page, replacing the cached home page
+	homePage, err = table.FetchDataPage(homePage.Index())
+	if err != nil {
+		return err
+	}
+	entryBuffer, err := homePage.ResizeEntry(homeSlot, MinEntryLength)
+	if err != nil {
+		return err
+	}
+	encodeForwarding(target, entryBuffer)
+	homePage.SetEntryFlags(homeSlot, ROW_FORWARDED)
+
+	return table.flushDataPage(homePage)
+}
+
+// Calls fn with every row of the table and its location, in page order.
+// Stops early if fn returns false or an error.
+func (table *Table) ForEachRow(fn func(RowId, Row) (bool, error)) error {
+	it := table.Scan()
+	defer it.Close()
+	for it.Next() {
+		cont, err := fn(it.RowId(), it.Row())
+		if err != nil || !cont {
+			return err
+		}
+	}
+	return it.Err()
+}
+
 func (table *Table) NextPage(currPage *DataPage) (*DataPage, error) {
 	if currPage.Header.Next < 0 {
 		return nil, errors.New("There is no next page, this is the last one")
@@ -147,7 +574,7 @@ func (table *Table) decodePage(page *pager.Page) (*DataPage, error) {
 	reader := bytes.NewReader(page.Memory[0:binary.Size(dataPage.Header)])
 	binary.Read(reader, binary.BigEndian, &dataPage.Header)
 
-	dataPage.RowPointers = make([]int16, dataPage.Header.RowPointersLength)
+	dataPage.RowPointers = make([]RowPointer, dataPage.Header.RowPointersLength)
 
 	reader = bytes.NewReader(page.Memory[binary.Size(dataPage.Header):dataPage.Header.FreeSpaceStart])
 	binary.Read(reader, binary.BigEndian, &dataPage.RowPointers)
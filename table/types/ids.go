@@ -1,6 +1,10 @@
 package types
 
-import "godb/table"
+import (
+	"errors"
+	"godb/table"
+	"strings"
+)
 
 var TypeIds = map[uint16]*table.DataType{}
 
@@ -9,3 +13,30 @@ func InitializeTypeIds() {
 	TypeIds[1] = TypeString
 	TypeIds[2] = TypeColDefs
 }
+
+// Maps the type names accepted in SQL to the ids of the types storing them
+var SqlTypeNames = map[string]uint16{
+	"LONG":     0,
+	"INT":      0,
+	"INTEGER":  0,
+	"BIGINT":   0,
+	"SMALLINT": 0,
+	"TINYINT":  0,
+	"STRING":   1,
+	"TEXT":     1,
+	"VARCHAR":  1,
+	"CHAR":     1,
+}
+
+// Finds the type of a column declared with the given SQL type name
+func TypeBySqlName(name string) (*table.DataType, error) {
+	id, ok := SqlTypeNames[strings.ToUpper(name)]
+	if !ok {
+		return nil, errors.New("Unknown type '" + name + "'")
+	}
+	dataType, ok := TypeIds[id]
+	if !ok {
+		return nil, errors.New("Type '" + name + "' is not registered")
+	}
+	return dataType, nil
+}
@@ -4,12 +4,25 @@ import (
 	"encoding/binary"
 	"errors"
 	"godb/table"
+	"strings"
+
+	"github.com/SananGuliyev/sqlparser"
 )
 
 // The byte length of the length stored in front of a string value
 const COLDEF_LEN_LEN = 8
 
+// Flags storing the constraints of a column
+const (
+	COLDEF_NOT_NULL    = uint8(1)
+	COLDEF_UNIQUE      = uint8(2)
+	COLDEF_PRIMARY_KEY = uint8(4)
+	// An encoded default value follows the flags
+	COLDEF_HAS_DEFAULT = uint8(8)
+)
+
 var TypeColDefs = &table.DataType{
+	Name: "COLDEFS",
 	Decode: func(encoded []byte) (table.ColumnValue, error) {
 		offset := 0
 		columnCount := binary.BigEndian.Uint64(encoded)
@@ -24,6 +37,23 @@ var TypeColDefs = &table.DataType{
 			name := string(encoded[offset : offset+int(nameLength)])
 			colDefs[idx].Name = name
 			offset += int(nameLength)
+
+			flags := encoded[offset]
+			offset++
+			colDefs[idx].NotNull = flags&COLDEF_NOT_NULL != 0
+			colDefs[idx].Unique = flags&COLDEF_UNIQUE != 0
+			colDefs[idx].PrimaryKey = flags&COLDEF_PRIMARY_KEY != 0
+			if flags&COLDEF_HAS_DEFAULT != 0 {
+				if colDefs[idx].Type == nil {
+					return nil, errors.New("Failed to decode default value of unknown type")
+				}
+				value, err := colDefs[idx].Type.Decode(encoded[offset:])
+				if err != nil {
+					return nil, err
+				}
+				colDefs[idx].Default = value
+				offset += value.Length()
+			}
 		}
 
 		return ColDefs(colDefs), nil
@@ -33,9 +63,31 @@ var TypeColDefs = &table.DataType{
 
 type ColDefs []table.ColumnDef
 
+// Formats the column defs like the column list of CREATE TABLE
 func (val ColDefs) String() string {
-	// TODO
-	return "ColDef String not implemented"
+	columns := make([]string, len(val))
+	for i, col := range val {
+		column := col.Name + " " + col.Type.Name
+		if col.PrimaryKey {
+			column += " PRIMARY KEY"
+		} else {
+			if col.NotNull {
+				column += " NOT NULL"
+			}
+			if col.Unique {
+				column += " UNIQUE"
+			}
+		}
+		if col.Default != nil {
+			if str, ok := col.Default.(String); ok {
+				column += " DEFAULT " + sqlparser.String(sqlparser.NewStrVal([]byte(str)))
+			} else {
+				column += " DEFAULT " + col.Default.String()
+			}
+		}
+		columns[i] = column
+	}
+	return strings.Join(columns, ", ")
 }
 
 func (val ColDefs) Type() *table.DataType {
@@ -48,6 +100,10 @@ func (val ColDefs) Length() int {
 		length += 2 // DataTypeId
 		length += 2 // Length of the name
 		length += len(col.Name)
+		length += 1 // Flags
+		if col.Default != nil {
+			length += col.Default.Length()
+		}
 	}
 	return length
 }
@@ -55,11 +111,16 @@ func (val ColDefs) Length() int {
 // Serialize the column defs
 //
 // The encoding is as follows:
-//   8 bytes uint64 Number of column defs that will follow
+//
+//	8 bytes uint64 Number of column defs that will follow
+//
 // For each column def
-//   2 bytes uint16 DataTypeId
-//   2 bytes uint16 Length of the name
-//   n bytes        The actual name
+//
+//	2 bytes uint16 DataTypeId
+//	2 bytes uint16 Length of the name
+//	n bytes        The actual name
+//	1 byte         Constraint flags
+//	n bytes        The encoded default value, if COLDEF_HAS_DEFAULT is set
 func (val ColDefs) Encode() []byte {
 	res := make([]byte, val.Length())
 	binary.BigEndian.PutUint64(res, uint64(len(val)))
@@ -72,6 +133,25 @@ func (val ColDefs) Encode() []byte {
 		offset += 2
 		copy(res[offset:], col.Name)
 		offset += len(col.Name)
+
+		flags := uint8(0)
+		if col.NotNull {
+			flags |= COLDEF_NOT_NULL
+		}
+		if col.Unique {
+			flags |= COLDEF_UNIQUE
+		}
+		if col.PrimaryKey {
+			flags |= COLDEF_PRIMARY_KEY
+		}
+		if col.Default != nil {
+			flags |= COLDEF_HAS_DEFAULT
+		}
+		res[offset] = flags
+		offset++
+		if col.Default != nil {
+			offset += copy(res[offset:], col.Default.Encode())
+		}
 	}
 
 	return res
@@ -8,12 +8,12 @@ import (
 )
 
 var TypeLong = &table.DataType{
+	Name: "LONG",
 	Decode: func(encoded []byte) (table.ColumnValue, error) {
-		result, n := binary.Varint(encoded[0:8])
-		if n <= 0 {
+		if len(encoded) < 8 {
 			return nil, errors.New("Failed to decode value")
 		}
-		return Long(result), nil
+		return Long(binary.BigEndian.Uint64(encoded)), nil
 	},
 	Id: 0,
 }
@@ -34,7 +34,7 @@ func (val Long) Length() int {
 
 func (val Long) Encode() []byte {
 	res := make([]byte, val.Length())
-	binary.PutVarint(res, int64(val))
+	binary.BigEndian.PutUint64(res, uint64(val))
 	return res
 }
 
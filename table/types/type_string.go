@@ -11,6 +11,7 @@ import (
 const STRING_LEN_LEN = 8
 
 var TypeString = &table.DataType{
+	Name: "STRING",
 	Decode: func(encoded []byte) (table.ColumnValue, error) {
 		// The byte length of the value field
 		valueLength := binary.BigEndian.Uint64(encoded)